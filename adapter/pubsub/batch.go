@@ -0,0 +1,149 @@
+package pubsub
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+DefaultBatchSize and DefaultBatchWait are the bounds applied to batches of
+deliveries when not set.
+*/
+var (
+	DefaultBatchSize = 100
+	DefaultBatchWait = time.Second
+)
+
+/*
+Batcher groups deliveries into batches. A batch is handled once it holds the
+maximum number of deliveries, or once the wait time has passed since its first
+delivery. Batches are handled one at a time, in the order deliveries have been
+added: Add blocks while a batch is being handled, so a slow handler slows down
+the receiver instead of exhausting memory.
+*/
+type Batcher struct {
+
+	// size and wait are the bounds of a batch.
+	size int
+	wait time.Duration
+
+	// handler handles a batch. The deliveries are outstanding until it returns.
+	handler func([]*Delivery)
+
+	// mutex protects pending, timer, and generation. It is held while a batch is
+	// being handled.
+	mutex sync.Mutex
+
+	// pending holds the deliveries of the current batch.
+	pending []*Delivery
+
+	// timer handles the current batch once the wait time has passed.
+	timer *time.Timer
+
+	// generation is incremented every time a batch is handled, so a timer firing
+	// after its batch has already been handled does not handle the next one.
+	generation uint64
+}
+
+/*
+NewBatcher returns a new batcher handling batches with the handler passed. The
+defaults are applied to the size and the wait time if zero.
+*/
+func NewBatcher(size int, wait time.Duration, handler func([]*Delivery)) *Batcher {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+
+	if wait <= 0 {
+		wait = DefaultBatchWait
+	}
+
+	return &Batcher{
+		size:    size,
+		wait:    wait,
+		handler: handler,
+		pending: make([]*Delivery, 0, size),
+	}
+}
+
+/*
+Add adds a delivery to the current batch. The batch is handled before returning
+if it is full.
+*/
+func (b *Batcher) Add(d *Delivery) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.pending = append(b.pending, d)
+	if len(b.pending) >= b.size {
+		b.flush()
+		return
+	}
+
+	if len(b.pending) == 1 {
+		generation := b.generation
+		b.timer = time.AfterFunc(b.wait, func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+
+			if b.generation == generation {
+				b.flush()
+			}
+		})
+	}
+}
+
+/*
+Close handles the current batch, if any. Add must not be called once the batcher
+has been closed.
+*/
+func (b *Batcher) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.flush()
+}
+
+/*
+flush handles the current batch and starts a new one. The mutex must be held.
+*/
+func (b *Batcher) flush() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	b.generation++
+	if len(b.pending) == 0 {
+		return
+	}
+
+	batch := b.pending
+	b.pending = make([]*Delivery, 0, b.size)
+	b.handler(batch)
+}
+
+/*
+SettleBatch settles every delivery of a batch given the error of its processing,
+at the same index. A delivery without error is acknowledged. A delivery with an
+error fails given the dead-letter policy, as with Fail. A missing error is
+considered nil. It settles every delivery no matter the errors, and returns the
+first one.
+*/
+func SettleBatch(tk *Toolkit, deliveries []*Delivery, fails []error, requeueAfter time.Duration, p *DeadLetterPolicy) error {
+	var first error
+	for i, d := range deliveries {
+		var err error
+		if i < len(fails) && fails[i] != nil {
+			err = Fail(tk, d, fails[i], requeueAfter, p)
+		} else {
+			err = d.Ack()
+		}
+
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
@@ -0,0 +1,159 @@
+package pubsub
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+batches records the sizes of the batches handled by a batcher.
+*/
+type batches struct {
+	mutex sync.Mutex
+	sizes []int
+}
+
+/*
+handle records the size of a batch.
+*/
+func (b *batches) handle(deliveries []*Delivery) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.sizes = append(b.sizes, len(deliveries))
+}
+
+/*
+assertSizes makes sure the batches handled have the sizes passed, in order.
+*/
+func (b *batches) assertSizes(t *testing.T, label string, sizes ...int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.sizes) != len(sizes) {
+		t.Fatalf("%s: expected batches of %v, found %v", label, sizes, b.sizes)
+	}
+
+	for i := range sizes {
+		if b.sizes[i] != sizes[i] {
+			t.Fatalf("%s: expected batches of %v, found %v", label, sizes, b.sizes)
+		}
+	}
+}
+
+/*
+TestBatcherSize makes sure a batch is handled as soon as it is full, and that the
+last one is handled on close.
+*/
+func TestBatcherSize(t *testing.T) {
+	handled := &batches{}
+	b := NewBatcher(3, time.Hour, handled.handle)
+	for i := 0; i < 7; i++ {
+		b.Add(keyed(i, ""))
+	}
+
+	handled.assertSizes(t, "Add", 3, 3)
+	b.Close()
+	handled.assertSizes(t, "Close", 3, 3, 1)
+	b.Close()
+	handled.assertSizes(t, "Close", 3, 3, 1)
+}
+
+/*
+TestBatcherWait makes sure a batch not full is handled once the wait time has
+passed since its first delivery.
+*/
+func TestBatcherWait(t *testing.T) {
+	handled := &batches{}
+	b := NewBatcher(10, 20*time.Millisecond, handled.handle)
+	b.Add(keyed(0, ""))
+	b.Add(keyed(1, ""))
+	handled.assertSizes(t, "Add")
+
+	time.Sleep(60 * time.Millisecond)
+	handled.assertSizes(t, "Wait", 2)
+
+	b.Add(keyed(2, ""))
+	b.Close()
+	handled.assertSizes(t, "Close", 2, 1)
+
+	time.Sleep(40 * time.Millisecond)
+	handled.assertSizes(t, "Wait", 2, 1)
+}
+
+/*
+TestBatcherConcurrent makes sure deliveries added concurrently are each handled
+once, and that batches are handled one at a time.
+*/
+func TestBatcherConcurrent(t *testing.T) {
+	var mutex sync.Mutex
+	handling, total := 0, 0
+	b := NewBatcher(7, 5*time.Millisecond, func(deliveries []*Delivery) {
+		mutex.Lock()
+		handling++
+		if handling > 1 {
+			t.Errorf("Add: expected batches to be handled one at a time")
+		}
+
+		total += len(deliveries)
+		mutex.Unlock()
+
+		time.Sleep(time.Millisecond)
+		mutex.Lock()
+		handling--
+		mutex.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				b.Add(keyed(w*25+i, ""))
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	b.Close()
+	if total != 100 {
+		t.Fatalf("Close: expected 100 deliveries handled, found %d", total)
+	}
+}
+
+/*
+TestSettleBatch makes sure every delivery of a batch is settled given its error,
+even when settling one of them fails.
+*/
+func TestSettleBatch(t *testing.T) {
+	acks := []*acknowledger{{}, {}, {}, {}}
+	deliveries := []*Delivery{}
+	for i, ack := range acks {
+		deliveries = append(deliveries, NewDelivery(&Message{}, uint16(i+1), ack))
+	}
+
+	acks[0].fail = &errors.Error{StatusCode: 503, Message: "pubsub/test: Failed to acknowledge message"}
+	fails := []error{nil, &errors.Error{Message: "boom"}, &errors.Error{Message: "boom"}}
+	f := &forwarder{}
+	err := SettleBatch(nil, deliveries, fails, time.Second, policy(f))
+	assertStatus(t, "SettleBatch", err, 503)
+
+	assertCalls(t, "SettleBatch", acks[0], "ack")
+	assertCalls(t, "SettleBatch", acks[1], "ack")
+	assertCalls(t, "SettleBatch", acks[2], "ack")
+	assertCalls(t, "SettleBatch", acks[3], "ack")
+	if len(f.forwarded("dead")) != 2 {
+		t.Fatalf("SettleBatch: expected failed deliveries at the maximum to be dead letters, found %d", len(f.forwarded("dead")))
+	}
+
+	retried := &acknowledger{}
+	if err := SettleBatch(nil, []*Delivery{NewDelivery(&Message{}, 1, retried)}, fails[1:], time.Second, policy(f)); err != nil {
+		t.Fatalf("SettleBatch: unexpected error: %v", err)
+	}
+
+	assertCalls(t, "SettleBatch", retried, "nack 1s")
+}
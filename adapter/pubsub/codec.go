@@ -0,0 +1,577 @@
+package pubsub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"strconv"
+	"sync"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+/*
+MetadataContentType and MetadataContentEncoding are the keys of a message's
+metadata holding the content type and the encoding of its body.
+*/
+var (
+	MetadataContentType     = "content-type"
+	MetadataContentEncoding = "content-encoding"
+)
+
+/*
+ContentTypeJSON is used to marshal messages as JSON. This is the content type of
+messages without content type, such as the ones published by previous versions.
+*/
+var ContentTypeJSON = "application/json"
+
+/*
+ContentTypeMessagePack is used to marshal messages as MessagePack. Keys are the
+ones of the JSON representation.
+*/
+var ContentTypeMessagePack = "application/msgpack"
+
+/*
+ContentTypeProtobuf is used to marshal messages as Protobuf. Values implementing
+proto.Message are marshaled as is. Other values are marshaled as a
+google.protobuf.Value given their JSON representation, so they can be decoded
+without sharing a schema.
+
+Note: google.protobuf.Value holds numbers as float64. Other values holding a
+number which can not be represented exactly as a float64, such as an int64 ID
+above 2^53 or a uint64 beyond the range of int64, fail to be marshaled instead of
+losing precision. Use JSON,
+MessagePack, or a proto.Message for such values.
+*/
+var ContentTypeProtobuf = "application/protobuf"
+
+/*
+EncodingIdentity is used to not compress messages. This is the encoding of messages
+without encoding, such as the ones published by previous versions.
+*/
+var EncodingIdentity = ""
+
+/*
+EncodingGzip is used to compress messages with gzip.
+*/
+var EncodingGzip = "gzip"
+
+/*
+EncodingZstd is used to compress messages with Zstandard.
+*/
+var EncodingZstd = "zstd"
+
+/*
+MaxDecompressedSize is the maximum size of the body of a message once
+decompressed. Decoding a message exceeding it fails, so a small compressed message
+can not exhaust the memory of the subscriber. It must be set before the first
+message is decoded. Custom compressors shall enforce it as well.
+*/
+var MaxDecompressedSize int64 = 64 << 20
+
+/*
+Codec marshals and unmarshals the body of messages for a content type.
+*/
+type Codec interface {
+
+	// ContentType returns the content type recorded in the metadata of messages.
+	//
+	// Example: "application/json"
+	ContentType() string
+
+	// Marshal returns the representation of a value.
+	Marshal(interface{}) ([]byte, error)
+
+	// Unmarshal parses a representation and stores the result in the value pointed.
+	Unmarshal([]byte, interface{}) error
+}
+
+/*
+Compressor compresses and decompresses the body of messages for an encoding.
+*/
+type Compressor interface {
+
+	// Encoding returns the encoding recorded in the metadata of messages.
+	//
+	// Example: "gzip"
+	Encoding() string
+
+	// Compress returns the compressed representation of a body.
+	Compress([]byte) ([]byte, error)
+
+	// Decompress returns the body of a compressed representation.
+	Decompress([]byte) ([]byte, error)
+}
+
+/*
+registry holds the codecs and compressors available, indexed by their content
+type and encoding.
+*/
+var registry = struct {
+	sync.RWMutex
+	codecs      map[string]Codec
+	compressors map[string]Compressor
+}{
+	codecs: map[string]Codec{
+		ContentTypeJSON:        codecJSON{},
+		ContentTypeMessagePack: codecMessagePack{},
+		ContentTypeProtobuf:    codecProtobuf{},
+	},
+	compressors: map[string]Compressor{
+		EncodingGzip: compressorGzip{},
+		EncodingZstd: compressorZstd{},
+	},
+}
+
+/*
+RegisterCodec makes a codec available for encoding and decoding messages. It
+replaces the codec registered for the same content type, if any. Every services
+exchanging messages must register the same codecs.
+*/
+func RegisterCodec(codec Codec) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.codecs[codec.ContentType()] = codec
+}
+
+/*
+RegisterCompressor makes a compressor available for encoding and decoding
+messages. It replaces the compressor registered for the same encoding, if any.
+Every services exchanging messages must register the same compressors.
+*/
+func RegisterCompressor(compressor Compressor) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.compressors[compressor.Encoding()] = compressor
+}
+
+/*
+ValidateCodec makes sure a content type and an encoding are registered. An empty
+content type is JSON, and an empty encoding is no compression. It returns a 400
+error otherwise. Drivers shall call it when validating their options.
+*/
+func ValidateCodec(contentType string, encoding string) error {
+	_, _, err := lookup("Failed to validate codec", contentType, encoding)
+	return err
+}
+
+/*
+Encode returns a message holding the representation of a value, marshaled with the
+codec of the content type and compressed with the compressor of the encoding. The
+content type and the encoding are recorded in the message's metadata.
+*/
+func Encode(v interface{}, contentType string, encoding string) (*Message, error) {
+	codec, compressor, err := lookup("Failed to encode message", contentType, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := codec.Marshal(v)
+	if err == nil && compressor != nil {
+		body, err = compressor.Compress(body)
+	}
+
+	if fail, ok := err.(*errors.Error); ok {
+		return nil, fail
+	}
+
+	if err != nil {
+		return nil, &errors.Error{
+			Message: "pubsub: Failed to encode message",
+			Validations: []errors.Validation{
+				{
+					Message: err.Error(),
+				},
+			},
+		}
+	}
+
+	m := &Message{
+		Body: body,
+		Metadata: map[string]string{
+			MetadataContentType: codec.ContentType(),
+		},
+	}
+
+	if compressor != nil {
+		m.Metadata[MetadataContentEncoding] = compressor.Encoding()
+	}
+
+	return m, nil
+}
+
+/*
+Decode parses the body of a message given the content type and the encoding of its
+metadata, and stores the result in the value pointed. A message without content
+type nor encoding is parsed as uncompressed JSON, so messages published by
+previous versions can still be decoded.
+*/
+func Decode(m *Message, v interface{}) error {
+	codec, compressor, err := lookup("Failed to decode message", m.Metadata[MetadataContentType], m.Metadata[MetadataContentEncoding])
+	if err != nil {
+		return err
+	}
+
+	body := m.Body
+	if compressor != nil {
+		body, err = compressor.Decompress(body)
+	}
+
+	if err == nil {
+		err = codec.Unmarshal(body, v)
+	}
+
+	if fail, ok := err.(*errors.Error); ok {
+		return fail
+	}
+
+	if err != nil {
+		return &errors.Error{
+			Message: "pubsub: Failed to decode message",
+			Validations: []errors.Validation{
+				{
+					Message: err.Error(),
+				},
+			},
+		}
+	}
+
+	return nil
+}
+
+/*
+lookup returns the codec and the compressor registered for a content type and an
+encoding. The compressor is nil for EncodingIdentity.
+*/
+func lookup(message string, contentType string, encoding string) (Codec, Compressor, error) {
+	fail := &errors.Error{
+		StatusCode:  400,
+		Message:     "pubsub: " + message,
+		Validations: []errors.Validation{},
+	}
+
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	codec := registry.codecs[contentType]
+	if codec == nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Content type not supported",
+			Path:    []string{"Metadata", MetadataContentType, contentType},
+		})
+	}
+
+	var compressor Compressor
+	if encoding != EncodingIdentity {
+		compressor = registry.compressors[encoding]
+		if compressor == nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: "Encoding not supported",
+				Path:    []string{"Metadata", MetadataContentEncoding, encoding},
+			})
+		}
+	}
+
+	if len(fail.Validations) > 0 {
+		return nil, nil, fail
+	}
+
+	return codec, compressor, nil
+}
+
+/*
+codecJSON implements the Codec interface for ContentTypeJSON.
+*/
+type codecJSON struct{}
+
+func (codecJSON) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (codecJSON) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codecJSON) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+/*
+codecMessagePack implements the Codec interface for ContentTypeMessagePack. The
+JSON tags of structs are used as keys.
+*/
+type codecMessagePack struct{}
+
+func (codecMessagePack) ContentType() string {
+	return ContentTypeMessagePack
+}
+
+func (codecMessagePack) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (codecMessagePack) Unmarshal(b []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+/*
+codecProtobuf implements the Codec interface for ContentTypeProtobuf.
+*/
+type codecProtobuf struct{}
+
+func (codecProtobuf) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (codecProtobuf) Marshal(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	generic, err = withFloats(generic)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := structpb.NewValue(generic)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(value)
+}
+
+func (codecProtobuf) Unmarshal(b []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(b, m)
+	}
+
+	value := &structpb.Value{}
+	if err := proto.Unmarshal(b, value); err != nil {
+		return err
+	}
+
+	generic, err := json.Marshal(value.AsInterface())
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(generic, v)
+}
+
+/*
+withFloats replaces the numbers of a JSON representation decoded with UseNumber by
+float64, as held by google.protobuf.Value. It returns an error for numbers which
+can not be represented exactly as a float64, such as integers above 2^53 or beyond
+the range of int64.
+*/
+func withFloats(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if math.IsInf(f, 0) {
+			return nil, &errors.Error{
+				Message: "pubsub: Failed to marshal number",
+				Validations: []errors.Validation{
+					{
+						Message: "Number " + string(v) + " is out of range",
+					},
+				},
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// The number round-trips if the shortest representation of its float64 has
+		// the same value, so 0.1 is accepted while 9007199254740993 is not.
+		exact, ok := new(big.Rat).SetString(string(v))
+		back, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+		if !ok || exact.Cmp(back) != 0 {
+			return nil, &errors.Error{
+				Message: "pubsub: Failed to marshal number",
+				Validations: []errors.Validation{
+					{
+						Message: "Number " + string(v) + " can not be represented exactly as a float64",
+					},
+				},
+			}
+		}
+
+		return f, nil
+
+	case []interface{}:
+		for i := range v {
+			item, err := withFloats(v[i])
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = item
+		}
+
+	case map[string]interface{}:
+		for k := range v {
+			item, err := withFloats(v[k])
+			if err != nil {
+				return nil, err
+			}
+
+			v[k] = item
+		}
+	}
+
+	return v, nil
+}
+
+/*
+compressorGzip implements the Compressor interface for EncodingGzip.
+*/
+type compressorGzip struct{}
+
+func (compressorGzip) Encoding() string {
+	return EncodingGzip
+}
+
+func (compressorGzip) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (compressorGzip) Decompress(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(r, MaxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > MaxDecompressedSize {
+		return nil, errDecompressedSize()
+	}
+
+	return body, nil
+}
+
+/*
+compressorZstd implements the Compressor interface for EncodingZstd. The encoder
+and decoder are safe for concurrent use, so they are shared. They are created on
+first use, so the decoder applies MaxDecompressedSize.
+*/
+type compressorZstd struct{}
+
+var zstdCodec struct {
+	sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+/*
+zstdInit creates the shared encoder and decoder, and returns the error which
+occurred when creating them, if any.
+*/
+func zstdInit() error {
+	zstdCodec.Do(func() {
+		zstdCodec.encoder, zstdCodec.err = zstd.NewWriter(nil)
+		if zstdCodec.err != nil {
+			return
+		}
+
+		zstdCodec.decoder, zstdCodec.err = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(MaxDecompressedSize)))
+	})
+
+	return zstdCodec.err
+}
+
+func (compressorZstd) Encoding() string {
+	return EncodingZstd
+}
+
+func (compressorZstd) Compress(b []byte) ([]byte, error) {
+	if err := zstdInit(); err != nil {
+		return nil, err
+	}
+
+	return zstdCodec.encoder.EncodeAll(b, nil), nil
+}
+
+func (compressorZstd) Decompress(b []byte) ([]byte, error) {
+	if err := zstdInit(); err != nil {
+		return nil, err
+	}
+
+	body, err := zstdCodec.decoder.DecodeAll(b, nil)
+	if err == zstd.ErrDecoderSizeExceeded {
+		return nil, errDecompressedSize()
+	}
+
+	return body, err
+}
+
+/*
+errDecompressedSize returns the error of a body exceeding MaxDecompressedSize once
+decompressed.
+*/
+func errDecompressedSize() error {
+	return &errors.Error{
+		StatusCode: 400,
+		Message:    "pubsub: Failed to decompress message",
+		Validations: []errors.Validation{
+			{
+				Message: "Body exceeds the maximum decompressed size of " + strconv.FormatInt(MaxDecompressedSize, 10) + " bytes",
+			},
+		},
+	}
+}
@@ -0,0 +1,222 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+/*
+queue returns a queue holding an event with a job and its latest transition, so
+every fields of the queue are covered by the round-trips.
+*/
+func queue() *store.Queue {
+	now := time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
+	return &store.Queue{
+		Events: []*store.Event{
+			{
+				ID:         "evt",
+				Tenant:     "acme",
+				Source:     "shop",
+				Trigger:    "order",
+				Context:    []byte(`{"ip":"127.0.0.1"}`),
+				Data:       []byte(`{"total":9.99}`),
+				ReceivedAt: now,
+				Jobs: []*store.Job{
+					{
+						ID:          "job",
+						Destination: "warehouse",
+						Action:      "load",
+						Priority:    3,
+						CreatedAt:   now,
+						Transitions: [1]*store.Transition{
+							{
+								ID:         "tr",
+								Attempt:    2,
+								StateAfter: store.StatusAwaiting,
+								CreatedAt:  now,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+/*
+assertJSON makes sure two values have the same JSON representation.
+*/
+func assertJSON(t *testing.T, label string, expected interface{}, found interface{}) {
+	a, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", label, err)
+	}
+
+	b, err := json.Marshal(found)
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", label, err)
+	}
+
+	if !bytes.Equal(a, b) {
+		t.Fatalf("%s: expected %s, found %s", label, a, b)
+	}
+}
+
+/*
+TestCodecsRoundTrip makes sure a queue encoded with every content types and
+encodings is decoded as is, and that the message's metadata records them.
+*/
+func TestCodecsRoundTrip(t *testing.T) {
+	contentTypes := []string{ContentTypeJSON, ContentTypeMessagePack, ContentTypeProtobuf}
+	encodings := []string{EncodingIdentity, EncodingGzip, EncodingZstd}
+	for _, contentType := range contentTypes {
+		for _, encoding := range encodings {
+			label := contentType + "+" + encoding
+			m, err := Encode(queue(), contentType, encoding)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", label, err)
+			}
+
+			if m.Metadata[MetadataContentType] != contentType || m.Metadata[MetadataContentEncoding] != encoding {
+				t.Fatalf("%s: expected the metadata to record the codec, found %v", label, m.Metadata)
+			}
+
+			decoded := &store.Queue{}
+			if err := Decode(m, decoded); err != nil {
+				t.Fatalf("%s: unexpected error: %v", label, err)
+			}
+
+			assertJSON(t, label, queue(), decoded)
+		}
+	}
+}
+
+/*
+TestCodecProtobufMessage makes sure values implementing proto.Message are marshaled
+as is with the Protobuf codec.
+*/
+func TestCodecProtobufMessage(t *testing.T) {
+	value, err := structpb.NewStruct(map[string]interface{}{
+		"id": "evt",
+	})
+
+	if err != nil {
+		t.Fatalf("NewStruct: unexpected error: %v", err)
+	}
+
+	m, err := Encode(value, ContentTypeProtobuf, EncodingZstd)
+	if err != nil {
+		t.Fatalf("Encode: unexpected error: %v", err)
+	}
+
+	decoded := &structpb.Struct{}
+	if err := Decode(m, decoded); err != nil {
+		t.Fatalf("Decode: unexpected error: %v", err)
+	}
+
+	if decoded.Fields["id"].GetStringValue() != "evt" {
+		t.Fatalf("Decode: expected the struct encoded, found %v", decoded)
+	}
+}
+
+/*
+TestCodecLegacy makes sure a message without content type nor encoding is decoded
+as uncompressed JSON, and that unsupported content types and encodings are
+rejected with a 400 error.
+*/
+func TestCodecLegacy(t *testing.T) {
+	legacy := &Message{
+		Body: []byte(`{"events":[{"id":"evt"}]}`),
+	}
+
+	decoded := &store.Queue{}
+	if err := Decode(legacy, decoded); err != nil || decoded.Events[0].ID != "evt" {
+		t.Fatalf("Decode: expected the legacy queue, found %v", err)
+	}
+
+	if _, err := Encode(queue(), "text/xml", ""); err == nil || errors.From(err).StatusCode != 400 {
+		t.Fatalf("Encode: expected a 400 error for an unsupported content type, found %v", err)
+	}
+
+	if err := ValidateCodec(ContentTypeJSON, "br"); err == nil || errors.From(err).StatusCode != 400 {
+		t.Fatalf("ValidateCodec: expected a 400 error for an unsupported encoding, found %v", err)
+	}
+}
+
+/*
+TestCodecProtobufNumbers makes sure numbers which can be represented exactly as a
+float64 round-trip with the Protobuf codec, and that others fail to be encoded
+instead of losing precision.
+*/
+func TestCodecProtobufNumbers(t *testing.T) {
+	exact := map[string]interface{}{
+		"max":      int64(1 << 53),
+		"min":      int64(-(1 << 53)),
+		"decimal":  0.1,
+		"exponent": 1e300,
+	}
+
+	m, err := Encode(exact, ContentTypeProtobuf, EncodingIdentity)
+	if err != nil {
+		t.Fatalf("Encode: unexpected error: %v", err)
+	}
+
+	decoded := map[string]interface{}{}
+	if err := Decode(m, &decoded); err != nil {
+		t.Fatalf("Decode: unexpected error: %v", err)
+	}
+
+	assertJSON(t, "Decode", exact, decoded)
+
+	inexact := map[string]interface{}{
+		"above":  int64(1<<53 + 1),
+		"below":  int64(-(1<<53 + 1)),
+		"int64":  int64(math.MaxInt64),
+		"uint64": uint64(math.MaxUint64),
+		"number": json.Number("0.10000000000000000001"),
+		"range":  json.Number("1e400"),
+	}
+
+	for name, v := range inexact {
+		if _, err := Encode(map[string]interface{}{"id": v}, ContentTypeProtobuf, EncodingIdentity); err == nil {
+			t.Fatalf("Encode: expected an error for %s %v", name, v)
+		}
+	}
+}
+
+/*
+TestCodecMaxDecompressedSize makes sure a compressed message exceeding the maximum
+decompressed size fails to be decoded with a 400 error.
+*/
+func TestCodecMaxDecompressedSize(t *testing.T) {
+	max := MaxDecompressedSize
+	MaxDecompressedSize = 1 << 20
+	defer func() {
+		MaxDecompressedSize = max
+	}()
+
+	body, err := compressorGzip{}.Compress(bytes.Repeat([]byte("a"), 4<<20))
+	if err != nil {
+		t.Fatalf("Compress: unexpected error: %v", err)
+	}
+
+	m := &Message{
+		Body: body,
+		Metadata: map[string]string{
+			MetadataContentEncoding: EncodingGzip,
+		},
+	}
+
+	var v interface{}
+	if err := Decode(m, &v); err == nil || errors.From(err).StatusCode != 400 {
+		t.Fatalf("Decode: expected a 400 error, found %v", err)
+	}
+}
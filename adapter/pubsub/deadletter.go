@@ -0,0 +1,252 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+MetadataDeadLetterError, MetadataDeadLetterAttempts, MetadataDeadLetterTopic,
+MetadataDeadLetterSubscription, and MetadataDeadLetterAt are the keys of a dead
+letter's metadata holding the details about its failure.
+*/
+var (
+	MetadataDeadLetterError        = "dead-letter-error"
+	MetadataDeadLetterAttempts     = "dead-letter-attempts"
+	MetadataDeadLetterTopic        = "dead-letter-topic"
+	MetadataDeadLetterSubscription = "dead-letter-subscription"
+	MetadataDeadLetterAt           = "dead-letter-at"
+)
+
+/*
+Forwarder can be implemented by publishers able to publish a message as is on any
+topic. It is required for forwarding messages to dead-letter topics and replaying
+them.
+*/
+type Forwarder interface {
+
+	// Forward publishes a message on a topic. It only returns after the message has
+	// been sent, or failed to be sent.
+	Forward(*Toolkit, string, *Message) error
+}
+
+/*
+DeadLetterPolicy defines what happens to a message failing too many times. It is
+built from the options of the adapter for the queues received by the scheduler,
+and from the subscription of a trigger for its messages.
+*/
+type DeadLetterPolicy struct {
+
+	// MaxDeliveries is the maximum number of times a message is delivered. Once a
+	// message has failed this many times, it is forwarded to the dead-letter topic.
+	// When zero, messages are delivered again until they succeed.
+	MaxDeliveries uint16 `json:"max_deliveries"`
+
+	// Topic is the dead-letter topic. When empty, messages exceeding the maximum
+	// number of deliveries are dropped.
+	Topic string `json:"topic,omitempty"`
+
+	// Source is the topic and subscription the messages are received from. It is
+	// recorded in the metadata of dead letters so they can be replayed.
+	SourceTopic        string `json:"source_topic,omitempty"`
+	SourceSubscription string `json:"source_subscription,omitempty"`
+
+	// Forwarder is used to publish the messages on the dead-letter topic.
+	Forwarder Forwarder `json:"-"`
+}
+
+/*
+DeadLetter holds the details about the failure of a dead letter, as recorded in
+its metadata.
+*/
+type DeadLetter struct {
+
+	// Error is the error returned by the last delivery of the message.
+	Error *errors.Error `json:"error"`
+
+	// Attempts is the number of times the message has been delivered.
+	Attempts uint16 `json:"attempts"`
+
+	// Topic and Subscription are the ones the message was received from.
+	Topic        string `json:"topic"`
+	Subscription string `json:"subscription"`
+
+	// At is the instant the message has been forwarded to the dead-letter topic.
+	At time.Time `json:"at"`
+}
+
+/*
+Exceeded reports if a message has been delivered more times than the maximum of
+the policy, meaning its last attempt has never been settled, such as when the
+receiver stopped while processing it. A receiver shall reject such a delivery
+without processing it.
+*/
+func (p *DeadLetterPolicy) Exceeded(d *Delivery) bool {
+	return p != nil && p.MaxDeliveries > 0 && d.Attempt > p.MaxDeliveries
+}
+
+/*
+ValidateDeadLetter makes sure a dead-letter policy can be applied. The dead-letter
+topic must not be the topic messages are received from, which would deliver them
+again forever, and a forwarder must be set when there is a dead-letter topic. It
+returns a 400 error otherwise. Drivers and the gateway shall call it when
+validating their options, so a policy is never found invalid once a message must
+be forwarded.
+*/
+func ValidateDeadLetter(p *DeadLetterPolicy) error {
+	fail := &errors.Error{
+		StatusCode:  400,
+		Message:     "pubsub: Failed to validate dead-letter policy",
+		Validations: []errors.Validation{},
+	}
+
+	if p == nil || p.Topic == "" {
+		return nil
+	}
+
+	if p.Topic == p.SourceTopic {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Dead-letter topic must not be the topic messages are received from",
+			Path:    []string{"DeadLetterPolicy", "Topic"},
+		})
+	}
+
+	if p.Forwarder == nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Publisher does not support forwarding messages",
+			Path:    []string{"DeadLetterPolicy", "Forwarder"},
+		})
+	}
+
+	if len(fail.Validations) > 0 {
+		return fail
+	}
+
+	return nil
+}
+
+/*
+Fail settles a delivery whose processing failed. If it reached the maximum number
+of deliveries of the policy, the delivery is rejected. Otherwise, it is nacked so
+the message is delivered again once the duration has passed.
+*/
+func Fail(tk *Toolkit, d *Delivery, fail error, requeueAfter time.Duration, p *DeadLetterPolicy) error {
+	if p == nil || p.MaxDeliveries == 0 || d.Attempt < p.MaxDeliveries {
+		return d.Nack(requeueAfter)
+	}
+
+	return Reject(tk, d, fail, p)
+}
+
+/*
+Reject settles a delivery which must never be delivered again, such as a message
+which can not be decoded. The message is forwarded to the dead-letter topic of
+the policy with the failure details in its metadata, or dropped if there is none.
+The delivery is then acknowledged. The policy must have been validated with
+ValidateDeadLetter.
+*/
+func Reject(tk *Toolkit, d *Delivery, fail error, p *DeadLetterPolicy) error {
+	if p == nil || p.Topic == "" {
+		if tk != nil && tk.Logger != nil {
+			tk.Logger.WithField("attempts", d.Attempt).Warn("pubsub: Dropping message without dead-letter topic")
+		}
+
+		return d.Ack()
+	}
+
+	letter := copyMetadata(d.Message)
+	letter.Metadata[MetadataDeadLetterError] = errors.From(fail).Error()
+	letter.Metadata[MetadataDeadLetterAttempts] = strconv.Itoa(int(d.Attempt))
+	letter.Metadata[MetadataDeadLetterTopic] = p.SourceTopic
+	letter.Metadata[MetadataDeadLetterSubscription] = p.SourceSubscription
+	letter.Metadata[MetadataDeadLetterAt] = time.Now().UTC().Format(time.RFC3339Nano)
+	if err := p.Forwarder.Forward(tk, p.Topic, letter); err != nil {
+		return err
+	}
+
+	return d.Ack()
+}
+
+/*
+DeadLetterOf returns the details about the failure of a dead letter. It returns
+false if the message is not a dead letter.
+*/
+func DeadLetterOf(m *Message) (*DeadLetter, bool) {
+	if _, ok := m.Metadata[MetadataDeadLetterAttempts]; !ok {
+		return nil, false
+	}
+
+	letter := &DeadLetter{
+		Error:        &errors.Error{},
+		Topic:        m.Metadata[MetadataDeadLetterTopic],
+		Subscription: m.Metadata[MetadataDeadLetterSubscription],
+	}
+
+	if err := json.Unmarshal([]byte(m.Metadata[MetadataDeadLetterError]), letter.Error); err != nil {
+		letter.Error.Message = m.Metadata[MetadataDeadLetterError]
+	}
+
+	attempts, _ := strconv.Atoi(m.Metadata[MetadataDeadLetterAttempts])
+	letter.Attempts = uint16(attempts)
+	letter.At, _ = time.Parse(time.RFC3339Nano, m.Metadata[MetadataDeadLetterAt])
+	return letter, true
+}
+
+/*
+Revive returns a copy of a dead letter without the details about its failure, as
+it was originally received. A trigger subscribing to a dead-letter topic can then
+extract it as any other message.
+*/
+func Revive(m *Message) *Message {
+	out := copyMetadata(m)
+	delete(out.Metadata, MetadataDeadLetterError)
+	delete(out.Metadata, MetadataDeadLetterAttempts)
+	delete(out.Metadata, MetadataDeadLetterTopic)
+	delete(out.Metadata, MetadataDeadLetterSubscription)
+	delete(out.Metadata, MetadataDeadLetterAt)
+
+	return out
+}
+
+/*
+Replay publishes a dead letter back on the topic it was originally received from,
+without the details about its failure. It returns a 400 error if the message is
+not a dead letter or if its original topic is unknown.
+*/
+func Replay(tk *Toolkit, f Forwarder, m *Message) error {
+	letter, ok := DeadLetterOf(m)
+	if !ok || letter.Topic == "" {
+		return &errors.Error{
+			StatusCode: 400,
+			Message:    "pubsub: Failed to replay message",
+			Validations: []errors.Validation{
+				{
+					Message: "Message is not a dead letter or its topic is unknown",
+					Path:    []string{"Message", "Metadata", MetadataDeadLetterTopic},
+				},
+			},
+		}
+	}
+
+	return f.Forward(tk, letter.Topic, Revive(m))
+}
+
+/*
+copyMetadata returns a copy of a message with its own metadata. The body is
+shared.
+*/
+func copyMetadata(m *Message) *Message {
+	out := &Message{
+		Body:     m.Body,
+		Metadata: map[string]string{},
+	}
+
+	for k, v := range m.Metadata {
+		out.Metadata[k] = v
+	}
+
+	return out
+}
@@ -0,0 +1,270 @@
+package pubsub
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+forwarder implements the Forwarder interface by recording the messages forwarded,
+indexed by topic. The error set is returned instead of forwarding messages.
+*/
+type forwarder struct {
+	mutex    sync.Mutex
+	messages map[string][]*Message
+	fail     error
+}
+
+/*
+Forward records the message forwarded on a topic.
+*/
+func (f *forwarder) Forward(tk *Toolkit, topic string, m *Message) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.fail != nil {
+		return f.fail
+	}
+
+	if f.messages == nil {
+		f.messages = map[string][]*Message{}
+	}
+
+	f.messages[topic] = append(f.messages[topic], m)
+	return nil
+}
+
+/*
+forwarded returns the messages forwarded on a topic.
+*/
+func (f *forwarder) forwarded(topic string) []*Message {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.messages[topic]
+}
+
+/*
+policy returns a dead-letter policy forwarding messages delivered twice from the
+topic "orders" to the topic "dead".
+*/
+func policy(f Forwarder) *DeadLetterPolicy {
+	return &DeadLetterPolicy{
+		MaxDeliveries:      2,
+		Topic:              "dead",
+		SourceTopic:        "orders",
+		SourceSubscription: "warehouse",
+		Forwarder:          f,
+	}
+}
+
+/*
+message returns a message with a body and some metadata.
+*/
+func message() *Message {
+	return &Message{
+		Body: []byte(`{"id":"evt"}`),
+		Metadata: map[string]string{
+			MetadataContentType: ContentTypeJSON,
+		},
+	}
+}
+
+/*
+TestValidateDeadLetter makes sure a policy forwarding messages to the topic they
+are received from or without forwarder is rejected with a 400 error.
+*/
+func TestValidateDeadLetter(t *testing.T) {
+	if err := ValidateDeadLetter(nil); err != nil {
+		t.Fatalf("ValidateDeadLetter: unexpected error without policy: %v", err)
+	}
+
+	if err := ValidateDeadLetter(&DeadLetterPolicy{MaxDeliveries: 2}); err != nil {
+		t.Fatalf("ValidateDeadLetter: unexpected error without dead-letter topic: %v", err)
+	}
+
+	if err := ValidateDeadLetter(policy(&forwarder{})); err != nil {
+		t.Fatalf("ValidateDeadLetter: unexpected error: %v", err)
+	}
+
+	loop := policy(&forwarder{})
+	loop.Topic = loop.SourceTopic
+	assertStatus(t, "ValidateDeadLetter", ValidateDeadLetter(loop), 400)
+
+	missing := policy(nil)
+	err := ValidateDeadLetter(missing)
+	assertStatus(t, "ValidateDeadLetter", err, 400)
+	if fail := errors.From(err); len(fail.Validations) != 1 || fail.Validations[0].Path[1] != "Forwarder" {
+		t.Fatalf("ValidateDeadLetter: expected the forwarder to be required, found %+v", fail.Validations)
+	}
+}
+
+/*
+TestFail makes sure a failed delivery is nacked until it reaches the maximum number
+of deliveries, and is then forwarded to the dead-letter topic and acknowledged.
+*/
+func TestFail(t *testing.T) {
+	f := &forwarder{}
+	first := &acknowledger{}
+	if err := Fail(nil, NewDelivery(message(), 1, first), &errors.Error{Message: "boom"}, time.Second, policy(f)); err != nil {
+		t.Fatalf("Fail: unexpected error: %v", err)
+	}
+
+	assertCalls(t, "Fail", first, "nack 1s")
+	if len(f.forwarded("dead")) != 0 {
+		t.Fatalf("Fail: expected no dead letter before the maximum")
+	}
+
+	last := &acknowledger{}
+	if err := Fail(nil, NewDelivery(message(), 2, last), &errors.Error{Message: "boom"}, time.Second, policy(f)); err != nil {
+		t.Fatalf("Fail: unexpected error: %v", err)
+	}
+
+	assertCalls(t, "Fail", last, "ack")
+	if len(f.forwarded("dead")) != 1 {
+		t.Fatalf("Fail: expected a dead letter once the maximum is reached, found %d", len(f.forwarded("dead")))
+	}
+
+	forever := &acknowledger{}
+	if err := Fail(nil, NewDelivery(message(), 100, forever), &errors.Error{Message: "boom"}, 0, nil); err != nil {
+		t.Fatalf("Fail: unexpected error: %v", err)
+	}
+
+	assertCalls(t, "Fail", forever, "nack 0s")
+}
+
+/*
+TestReject makes sure a rejected delivery is forwarded with the details about its
+failure, without altering the message received, and is only acknowledged once
+forwarded.
+*/
+func TestReject(t *testing.T) {
+	f := &forwarder{}
+	m := message()
+	ack := &acknowledger{}
+	before := time.Now().UTC()
+	if err := Reject(nil, NewDelivery(m, 3, ack), &errors.Error{StatusCode: 422, Message: "boom"}, policy(f)); err != nil {
+		t.Fatalf("Reject: unexpected error: %v", err)
+	}
+
+	assertCalls(t, "Reject", ack, "ack")
+	if len(m.Metadata) != 1 {
+		t.Fatalf("Reject: expected the message received to be left untouched, found %v", m.Metadata)
+	}
+
+	letters := f.forwarded("dead")
+	if len(letters) != 1 || string(letters[0].Body) != string(m.Body) || letters[0].Metadata[MetadataContentType] != ContentTypeJSON {
+		t.Fatalf("Reject: expected the message to be forwarded, found %+v", letters)
+	}
+
+	letter, ok := DeadLetterOf(letters[0])
+	if !ok || letter.Attempts != 3 || letter.Topic != "orders" || letter.Subscription != "warehouse" {
+		t.Fatalf("DeadLetterOf: expected the details about the failure, found %+v", letter)
+	}
+
+	if letter.Error.StatusCode != 422 || letter.Error.Message != "boom" || letter.At.Before(before) {
+		t.Fatalf("DeadLetterOf: expected the error and instant of the failure, found %+v", letter)
+	}
+
+	if _, ok := DeadLetterOf(m); ok {
+		t.Fatalf("DeadLetterOf: expected the message received not to be a dead letter")
+	}
+
+	broken := &forwarder{
+		fail: &errors.Error{StatusCode: 503, Message: "pubsub/test: Failed to forward message"},
+	}
+
+	unsettled := &acknowledger{}
+	assertStatus(t, "Reject", Reject(nil, NewDelivery(message(), 3, unsettled), &errors.Error{Message: "boom"}, policy(broken)), 503)
+	assertCalls(t, "Reject", unsettled)
+
+	dropped := &acknowledger{}
+	if err := Reject(nil, NewDelivery(message(), 3, dropped), &errors.Error{Message: "boom"}, &DeadLetterPolicy{}); err != nil {
+		t.Fatalf("Reject: unexpected error: %v", err)
+	}
+
+	assertCalls(t, "Reject", dropped, "ack")
+}
+
+/*
+TestReplay makes sure a dead letter is revived and published back on the topic it
+was received from, and that other messages can not be replayed.
+*/
+func TestReplay(t *testing.T) {
+	f := &forwarder{}
+	if err := Reject(nil, NewDelivery(message(), 2, &acknowledger{}), &errors.Error{Message: "boom"}, policy(f)); err != nil {
+		t.Fatalf("Reject: unexpected error: %v", err)
+	}
+
+	letter := f.forwarded("dead")[0]
+	if err := Replay(nil, f, letter); err != nil {
+		t.Fatalf("Replay: unexpected error: %v", err)
+	}
+
+	replayed := f.forwarded("orders")
+	if len(replayed) != 1 || string(replayed[0].Body) != `{"id":"evt"}` {
+		t.Fatalf("Replay: expected the message on its original topic, found %+v", replayed)
+	}
+
+	if _, ok := DeadLetterOf(replayed[0]); ok || len(replayed[0].Metadata) != 1 {
+		t.Fatalf("Replay: expected the details about the failure to be removed, found %v", replayed[0].Metadata)
+	}
+
+	if _, ok := DeadLetterOf(letter); !ok {
+		t.Fatalf("Replay: expected the dead letter to be left untouched")
+	}
+
+	assertStatus(t, "Replay", Replay(nil, f, message()), 400)
+}
+
+/*
+TestRevive makes sure a revived dead letter only loses the details about its
+failure.
+*/
+func TestRevive(t *testing.T) {
+	letter := message()
+	letter.Metadata[MetadataDeadLetterError] = "boom"
+	letter.Metadata[MetadataDeadLetterAttempts] = "2"
+	letter.Metadata[MetadataDeadLetterTopic] = "orders"
+	letter.Metadata[MetadataDeadLetterSubscription] = "warehouse"
+	letter.Metadata[MetadataDeadLetterAt] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	revived := Revive(letter)
+	if len(revived.Metadata) != 1 || revived.Metadata[MetadataContentType] != ContentTypeJSON {
+		t.Fatalf("Revive: expected the original metadata, found %v", revived.Metadata)
+	}
+
+	if len(letter.Metadata) != 6 {
+		t.Fatalf("Revive: expected the dead letter to be left untouched, found %v", letter.Metadata)
+	}
+}
+
+/*
+TestFailConcurrent makes sure deliveries failing concurrently are each forwarded
+once to the dead-letter topic.
+*/
+func TestFailConcurrent(t *testing.T) {
+	f := &forwarder{}
+	p := policy(f)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			d := NewDelivery(message(), 2, &acknowledger{})
+			if err := Fail(nil, d, &errors.Error{Message: "boom"}, 0, p); err != nil {
+				t.Errorf("Fail: unexpected error: %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if len(f.forwarded("dead")) != 20 {
+		t.Fatalf("Fail: expected 20 dead letters, found %d", len(f.forwarded("dead")))
+	}
+}
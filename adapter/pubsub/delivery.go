@@ -0,0 +1,144 @@
+package pubsub
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+Acknowledger is implemented by drivers to settle a message received. It is not
+used directly but through a Delivery, which makes sure the semantics are the same
+across drivers.
+*/
+type Acknowledger interface {
+
+	// Ack acknowledges the message, so it is never delivered again.
+	Ack() error
+
+	// Nack gives the message back to the broker, so it is delivered again once the
+	// duration has passed.
+	Nack(time.Duration) error
+
+	// Extend postpones the deadline of the message. The message is delivered again
+	// if it has not been acknowledged before the deadline.
+	Extend(time.Time) error
+}
+
+/*
+Delivery is a message received by a subscriber. It must be settled with Ack or
+Nack once processed. A delivery neither acknowledged nor extended before the
+deadline of the driver is delivered again, so a message is never lost if the
+receiver stops before settling it.
+
+A delivery can only be settled once: Ack, Nack, and Extend return an error once
+the delivery has been acknowledged or nacked.
+*/
+type Delivery struct {
+
+	// Message is the message received.
+	Message *Message `json:"message"`
+
+	// Queue is the queue held by the message. It is only set for deliveries returned
+	// by the Subscriber's Receive function, since messages of subscription triggers
+	// can hold any content.
+	Queue *store.Queue `json:"queue,omitempty"`
+
+	// Attempt is the number of times the message has been delivered, including
+	// this one. It starts at 1.
+	Attempt uint16 `json:"attempt"`
+
+	// mutex protects settled.
+	mutex sync.Mutex
+
+	// settled is true once the delivery has been acknowledged or nacked.
+	settled bool
+
+	// acknowledger is the driver's implementation settling the message.
+	acknowledger Acknowledger
+}
+
+/*
+NewDelivery returns a new delivery for a message, settled with the acknowledger of
+the driver.
+*/
+func NewDelivery(m *Message, attempt uint16, acknowledger Acknowledger) *Delivery {
+	return &Delivery{
+		Message:      m,
+		Attempt:      attempt,
+		acknowledger: acknowledger,
+	}
+}
+
+/*
+Ack acknowledges the message, so it is never delivered again. The scheduler shall
+only acknowledge a queue once the transitions of its jobs have been persisted in
+the store.
+*/
+func (d *Delivery) Ack() error {
+	return d.settle("Failed to acknowledge message", true, d.acknowledger.Ack)
+}
+
+/*
+Nack gives the message back to the broker, so it is delivered again once the
+duration has passed. A duration of zero makes the message immediately available.
+*/
+func (d *Delivery) Nack(requeueAfter time.Duration) error {
+	if requeueAfter < 0 {
+		return &errors.Error{
+			StatusCode: 400,
+			Message:    "pubsub: Failed to nack message",
+			Validations: []errors.Validation{
+				{
+					Message: "Duration must not be negative",
+					Path:    []string{"Delivery", "Nack", "RequeueAfter"},
+				},
+			},
+		}
+	}
+
+	return d.settle("Failed to nack message", true, func() error {
+		return d.acknowledger.Nack(requeueAfter)
+	})
+}
+
+/*
+Extend postpones the deadline of the message, for processing taking longer than
+the driver's deadline. It can be called several times before settling the delivery.
+*/
+func (d *Delivery) Extend(deadline time.Time) error {
+	return d.settle("Failed to extend message deadline", false, func() error {
+		return d.acknowledger.Extend(deadline)
+	})
+}
+
+/*
+settle calls the acknowledger's function if the delivery has not been settled yet.
+The delivery is marked as settled if final is true and the function succeeded.
+*/
+func (d *Delivery) settle(message string, final bool, fn func() error) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.settled {
+		return &errors.Error{
+			StatusCode: 409,
+			Message:    "pubsub: " + message,
+			Validations: []errors.Validation{
+				{
+					Message: "Delivery has already been settled",
+					Path:    []string{"Delivery"},
+				},
+			},
+		}
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	d.settled = final
+	return nil
+}
@@ -0,0 +1,207 @@
+package pubsub
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+acknowledger implements the Acknowledger interface by recording the calls made by
+a delivery. The error set is returned by every calls.
+*/
+type acknowledger struct {
+	mutex  sync.Mutex
+	calls  []string
+	fail   error
+	extend time.Time
+}
+
+/*
+record records a call and returns the error set.
+*/
+func (a *acknowledger) record(call string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.calls = append(a.calls, call)
+	return a.fail
+}
+
+/*
+Ack records the acknowledgement.
+*/
+func (a *acknowledger) Ack() error {
+	return a.record("ack")
+}
+
+/*
+Nack records the nack along its duration.
+*/
+func (a *acknowledger) Nack(requeueAfter time.Duration) error {
+	return a.record("nack " + requeueAfter.String())
+}
+
+/*
+Extend records the extension and keeps its deadline.
+*/
+func (a *acknowledger) Extend(deadline time.Time) error {
+	a.mutex.Lock()
+	a.extend = deadline
+	a.mutex.Unlock()
+
+	return a.record("extend")
+}
+
+/*
+assertCalls makes sure the acknowledger has received the calls passed, in order.
+*/
+func assertCalls(t *testing.T, label string, a *acknowledger, calls ...string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.calls) != len(calls) {
+		t.Fatalf("%s: expected calls %v, found %v", label, calls, a.calls)
+	}
+
+	for i := range calls {
+		if a.calls[i] != calls[i] {
+			t.Fatalf("%s: expected calls %v, found %v", label, calls, a.calls)
+		}
+	}
+}
+
+/*
+assertStatus makes sure an error is an error with the status code passed.
+*/
+func assertStatus(t *testing.T, label string, err error, status int) {
+	if err == nil {
+		t.Fatalf("%s: expected an error", label)
+	}
+
+	if fail := errors.From(err); fail.StatusCode != status {
+		t.Fatalf("%s: expected a %d error, found %d: %v", label, status, fail.StatusCode, err)
+	}
+}
+
+/*
+TestDeliveryAck makes sure a delivery can only be acknowledged once, and can not
+be nacked nor extended once acknowledged.
+*/
+func TestDeliveryAck(t *testing.T) {
+	ack := &acknowledger{}
+	d := NewDelivery(&Message{}, 1, ack)
+	if err := d.Ack(); err != nil {
+		t.Fatalf("Ack: unexpected error: %v", err)
+	}
+
+	assertStatus(t, "Ack", d.Ack(), 409)
+	assertStatus(t, "Nack", d.Nack(0), 409)
+	assertStatus(t, "Extend", d.Extend(time.Now()), 409)
+	assertCalls(t, "Ack", ack, "ack")
+}
+
+/*
+TestDeliveryNack makes sure a nacked delivery is settled, and that a negative
+duration is rejected without settling the delivery.
+*/
+func TestDeliveryNack(t *testing.T) {
+	ack := &acknowledger{}
+	d := NewDelivery(&Message{}, 1, ack)
+	assertStatus(t, "Nack", d.Nack(-time.Second), 400)
+	if err := d.Nack(time.Second); err != nil {
+		t.Fatalf("Nack: unexpected error: %v", err)
+	}
+
+	assertStatus(t, "Ack", d.Ack(), 409)
+	assertCalls(t, "Nack", ack, "nack 1s")
+}
+
+/*
+TestDeliveryExtend makes sure a delivery can be extended several times before
+being settled.
+*/
+func TestDeliveryExtend(t *testing.T) {
+	ack := &acknowledger{}
+	d := NewDelivery(&Message{}, 1, ack)
+	deadline := time.Now().Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if err := d.Extend(deadline); err != nil {
+			t.Fatalf("Extend: unexpected error: %v", err)
+		}
+	}
+
+	if !ack.extend.Equal(deadline) {
+		t.Fatalf("Extend: expected deadline %s, found %s", deadline, ack.extend)
+	}
+
+	if err := d.Ack(); err != nil {
+		t.Fatalf("Ack: unexpected error: %v", err)
+	}
+
+	assertCalls(t, "Extend", ack, "extend", "extend", "ack")
+}
+
+/*
+TestDeliveryFailure makes sure a delivery is not settled when the driver fails to
+settle it, so it can be settled again.
+*/
+func TestDeliveryFailure(t *testing.T) {
+	ack := &acknowledger{
+		fail: &errors.Error{
+			StatusCode: 503,
+			Message:    "pubsub/test: Failed to acknowledge message",
+		},
+	}
+
+	d := NewDelivery(&Message{}, 1, ack)
+	assertStatus(t, "Ack", d.Ack(), 503)
+
+	ack.mutex.Lock()
+	ack.fail = nil
+	ack.mutex.Unlock()
+	if err := d.Ack(); err != nil {
+		t.Fatalf("Ack: unexpected error once the driver succeeds: %v", err)
+	}
+
+	assertCalls(t, "Ack", ack, "ack", "ack")
+}
+
+/*
+TestDeliveryConcurrent makes sure a delivery settled concurrently is settled by
+the driver exactly once.
+*/
+func TestDeliveryConcurrent(t *testing.T) {
+	ack := &acknowledger{}
+	d := NewDelivery(&Message{}, 1, ack)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	settled := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var err error
+			if i%2 == 0 {
+				err = d.Ack()
+			} else {
+				err = d.Nack(0)
+			}
+
+			if err == nil {
+				mutex.Lock()
+				settled++
+				mutex.Unlock()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	if settled != 1 {
+		t.Fatalf("Ack: expected the delivery to be settled once, found %d", settled)
+	}
+}
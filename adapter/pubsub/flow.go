@@ -0,0 +1,276 @@
+package pubsub
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+DefaultFlowControl is the flow control applied to subscription triggers. When not
+set, these values will automatically be applied.
+*/
+var DefaultFlowControl = &FlowControl{
+	MaxOutstandingMessages: 1000,
+	MaxOutstandingBytes:    100 << 20,
+	Concurrency:            10,
+}
+
+/*
+FlowControl limits the messages received but not processed yet, and how they are
+processed. It is built from the subscription of a trigger.
+*/
+type FlowControl struct {
+
+	// MaxOutstandingMessages is the maximum number of messages received but not
+	// processed yet. No more messages are received until some have been processed.
+	// When zero, the default is applied. When negative, there is no limit.
+	MaxOutstandingMessages int `json:"max_outstanding_messages"`
+
+	// MaxOutstandingBytes is the maximum size of the bodies of the messages received
+	// but not processed yet. A message larger than this size is still received when
+	// no other message is outstanding. When zero, the default is applied. When
+	// negative, there is no limit.
+	MaxOutstandingBytes int `json:"max_outstanding_bytes"`
+
+	// Concurrency is the number of messages processed at the same time. When zero,
+	// the default is applied.
+	Concurrency int `json:"concurrency"`
+
+	// OrderingKey is the key of the messages' metadata holding their ordering key.
+	// Messages with the same ordering key are processed one at a time, in the order
+	// they have been received. Messages without ordering key are processed in any
+	// order. When empty, messages are not ordered.
+	//
+	// Example: "user_id"
+	OrderingKey string `json:"ordering_key,omitempty"`
+}
+
+/*
+ValidateFlowControl makes sure the concurrency of a flow control is not negative.
+It returns a 400 error otherwise.
+*/
+func ValidateFlowControl(fc *FlowControl) error {
+	if fc == nil || fc.Concurrency >= 0 {
+		return nil
+	}
+
+	return &errors.Error{
+		StatusCode: 400,
+		Message:    "pubsub: Failed to validate flow control",
+		Validations: []errors.Validation{
+			{
+				Message: "Concurrency must not be negative",
+				Path:    []string{"FlowControl", "Concurrency"},
+			},
+		},
+	}
+}
+
+/*
+Dispatcher processes deliveries given a flow control. Dispatch blocks while the
+outstanding limits are reached, so a slow handler slows down the receiver instead
+of exhausting memory. Deliveries are processed by a fixed number of workers, and
+deliveries with the same ordering key are always processed by the same worker.
+*/
+type Dispatcher struct {
+
+	// fc is the flow control with the defaults applied.
+	fc FlowControl
+
+	// handler processes a delivery. A delivery is outstanding until the handler
+	// returns.
+	handler func(*Delivery)
+
+	// mutex protects messages, bytes, and changed.
+	mutex sync.Mutex
+
+	// messages and bytes are the number and the size of the outstanding deliveries.
+	messages int
+	bytes    int
+
+	// changed is closed, and replaced, every time an outstanding delivery has been
+	// processed. This wakes up the pending dispatches.
+	changed chan struct{}
+
+	// ordered holds a channel per worker, for deliveries with an ordering key.
+	// unordered is shared by all workers, for deliveries without ordering key.
+	ordered   []chan *Delivery
+	unordered chan *Delivery
+
+	// wg waits for the workers to return once the dispatcher has been closed.
+	wg sync.WaitGroup
+}
+
+/*
+NewDispatcher returns a new dispatcher processing deliveries with the handler
+passed. The defaults are applied to the flow control if not set. It returns an
+error if the flow control is not valid.
+*/
+func NewDispatcher(fc *FlowControl, handler func(*Delivery)) (*Dispatcher, error) {
+	if err := ValidateFlowControl(fc); err != nil {
+		return nil, err
+	}
+
+	d := &Dispatcher{
+		fc:      *DefaultFlowControl,
+		handler: handler,
+		changed: make(chan struct{}),
+	}
+
+	if fc != nil {
+		if fc.MaxOutstandingMessages != 0 {
+			d.fc.MaxOutstandingMessages = fc.MaxOutstandingMessages
+		}
+
+		if fc.MaxOutstandingBytes != 0 {
+			d.fc.MaxOutstandingBytes = fc.MaxOutstandingBytes
+		}
+
+		if fc.Concurrency != 0 {
+			d.fc.Concurrency = fc.Concurrency
+		}
+
+		d.fc.OrderingKey = fc.OrderingKey
+	}
+
+	buffer := d.fc.MaxOutstandingMessages
+	if buffer < 0 {
+		buffer = DefaultFlowControl.MaxOutstandingMessages
+	}
+
+	d.unordered = make(chan *Delivery, buffer)
+	d.ordered = make([]chan *Delivery, d.fc.Concurrency)
+	for i := range d.ordered {
+		d.ordered[i] = make(chan *Delivery, buffer)
+		d.wg.Add(1)
+		go d.work(d.ordered[i])
+	}
+
+	return d, nil
+}
+
+/*
+Dispatch queues a delivery for processing. It blocks while the outstanding limits
+are reached, and returns the context's error if it is done before the delivery
+could be queued. The delivery is then left unsettled.
+*/
+func (d *Dispatcher) Dispatch(ctx context.Context, delivery *Delivery) error {
+	size := len(delivery.Message.Body)
+	if err := d.acquire(ctx, size); err != nil {
+		return err
+	}
+
+	queue := d.unordered
+	if d.fc.OrderingKey != "" {
+		if key := delivery.Message.Metadata[d.fc.OrderingKey]; key != "" {
+			h := fnv.New32a()
+			h.Write([]byte(key))
+			queue = d.ordered[h.Sum32()%uint32(len(d.ordered))]
+		}
+	}
+
+	select {
+	case queue <- delivery:
+		return nil
+	case <-ctx.Done():
+		d.release(size)
+		return ctx.Err()
+	}
+}
+
+/*
+Close waits for the deliveries queued to be processed and stops the workers.
+Dispatch must not be called once the dispatcher has been closed.
+*/
+func (d *Dispatcher) Close() {
+	for _, queue := range d.ordered {
+		close(queue)
+	}
+
+	close(d.unordered)
+	d.wg.Wait()
+}
+
+/*
+work processes the deliveries of a worker's queue and of the shared queue until
+both are closed.
+*/
+func (d *Dispatcher) work(ordered chan *Delivery) {
+	defer d.wg.Done()
+
+	unordered := d.unordered
+	for ordered != nil || unordered != nil {
+		select {
+		case delivery, ok := <-ordered:
+			if !ok {
+				ordered = nil
+				continue
+			}
+
+			d.process(delivery)
+
+		case delivery, ok := <-unordered:
+			if !ok {
+				unordered = nil
+				continue
+			}
+
+			d.process(delivery)
+		}
+	}
+}
+
+/*
+process calls the handler for a delivery, and releases it from the outstanding
+limits once done.
+*/
+func (d *Dispatcher) process(delivery *Delivery) {
+	defer d.release(len(delivery.Message.Body))
+	d.handler(delivery)
+}
+
+/*
+acquire blocks until a delivery of the size passed fits in the outstanding limits
+and adds it to them. A delivery always fits when none is outstanding.
+*/
+func (d *Dispatcher) acquire(ctx context.Context, size int) error {
+	for {
+		d.mutex.Lock()
+		fits := d.messages == 0 ||
+			((d.fc.MaxOutstandingMessages < 0 || d.messages < d.fc.MaxOutstandingMessages) &&
+				(d.fc.MaxOutstandingBytes < 0 || d.bytes+size <= d.fc.MaxOutstandingBytes))
+
+		if fits {
+			d.messages++
+			d.bytes += size
+			d.mutex.Unlock()
+			return nil
+		}
+
+		changed := d.changed
+		d.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+/*
+release removes a delivery of the size passed from the outstanding limits, and
+wakes up the pending dispatches.
+*/
+func (d *Dispatcher) release(size int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.messages--
+	d.bytes -= size
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
@@ -0,0 +1,227 @@
+package pubsub
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+keyed returns a delivery whose body is the index passed, with the ordering key
+"user_id" in its metadata if not empty.
+*/
+func keyed(i int, key string) *Delivery {
+	m := &Message{
+		Body:     []byte(strconv.Itoa(i)),
+		Metadata: map[string]string{},
+	}
+
+	if key != "" {
+		m.Metadata["user_id"] = key
+	}
+
+	return NewDelivery(m, 1, &acknowledger{})
+}
+
+/*
+TestValidateFlowControl makes sure a negative concurrency is rejected with a 400
+error.
+*/
+func TestValidateFlowControl(t *testing.T) {
+	if err := ValidateFlowControl(nil); err != nil {
+		t.Fatalf("ValidateFlowControl: unexpected error without flow control: %v", err)
+	}
+
+	assertStatus(t, "ValidateFlowControl", ValidateFlowControl(&FlowControl{Concurrency: -1}), 400)
+	if _, err := NewDispatcher(&FlowControl{Concurrency: -1}, func(*Delivery) {}); err == nil {
+		t.Fatalf("NewDispatcher: expected an error for a negative concurrency")
+	}
+}
+
+/*
+TestDispatcherOrderingKey makes sure deliveries with the same ordering key are
+processed one at a time in the order they have been dispatched, while no more
+deliveries than the concurrency are processed at the same time.
+*/
+func TestDispatcherOrderingKey(t *testing.T) {
+	var mutex sync.Mutex
+	processed := map[string][]int{}
+	processing := map[string]int{}
+	running, peak := 0, 0
+
+	d, err := NewDispatcher(&FlowControl{
+		MaxOutstandingMessages: 5,
+		Concurrency:            4,
+		OrderingKey:            "user_id",
+	}, func(delivery *Delivery) {
+		key := delivery.Message.Metadata["user_id"]
+		mutex.Lock()
+		processing[key]++
+		running++
+		if running > peak {
+			peak = running
+		}
+
+		if processing[key] > 1 {
+			t.Errorf("Dispatch: expected deliveries of %s to be processed one at a time", key)
+		}
+
+		mutex.Unlock()
+		time.Sleep(time.Millisecond)
+
+		i, _ := strconv.Atoi(string(delivery.Message.Body))
+		mutex.Lock()
+		processed[key] = append(processed[key], i)
+		processing[key]--
+		running--
+		mutex.Unlock()
+	})
+
+	if err != nil {
+		t.Fatalf("NewDispatcher: unexpected error: %v", err)
+	}
+
+	for i := 0; i < 200; i++ {
+		if err := d.Dispatch(context.Background(), keyed(i, strconv.Itoa(i%7))); err != nil {
+			t.Fatalf("Dispatch: unexpected error: %v", err)
+		}
+	}
+
+	d.Close()
+	total := 0
+	for key, indexes := range processed {
+		total += len(indexes)
+		for i := 1; i < len(indexes); i++ {
+			if indexes[i] < indexes[i-1] {
+				t.Fatalf("Dispatch: expected deliveries of %s in order, found %v", key, indexes)
+			}
+		}
+	}
+
+	if total != 200 {
+		t.Fatalf("Close: expected 200 deliveries processed, found %d", total)
+	}
+
+	if peak > 4 {
+		t.Fatalf("Dispatch: expected at most 4 deliveries processed at the same time, found %d", peak)
+	}
+}
+
+/*
+TestDispatcherUnordered makes sure deliveries without ordering key are processed
+concurrently, and that every delivery is processed once the dispatcher is closed.
+*/
+func TestDispatcherUnordered(t *testing.T) {
+	var mutex sync.Mutex
+	running, peak, total := 0, 0, 0
+	d, err := NewDispatcher(&FlowControl{
+		Concurrency: 4,
+		OrderingKey: "user_id",
+	}, func(delivery *Delivery) {
+		mutex.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+
+		mutex.Unlock()
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		total++
+		mutex.Unlock()
+	})
+
+	if err != nil {
+		t.Fatalf("NewDispatcher: unexpected error: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := d.Dispatch(context.Background(), keyed(i, "")); err != nil {
+			t.Fatalf("Dispatch: unexpected error: %v", err)
+		}
+	}
+
+	d.Close()
+	if total != 20 || peak < 2 || peak > 4 {
+		t.Fatalf("Close: expected 20 deliveries processed concurrently, found %d with %d at the same time", total, peak)
+	}
+}
+
+/*
+TestDispatcherMaxOutstandingMessages makes sure Dispatch blocks once the maximum
+number of outstanding deliveries is reached, until one has been processed.
+*/
+func TestDispatcherMaxOutstandingMessages(t *testing.T) {
+	release := make(chan struct{})
+	d, err := NewDispatcher(&FlowControl{
+		MaxOutstandingMessages: 2,
+		Concurrency:            1,
+	}, func(*Delivery) {
+		<-release
+	})
+
+	if err != nil {
+		t.Fatalf("NewDispatcher: unexpected error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := d.Dispatch(context.Background(), keyed(i, "")); err != nil {
+			t.Fatalf("Dispatch: unexpected error: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := d.Dispatch(ctx, keyed(2, "")); err != context.DeadlineExceeded {
+		t.Fatalf("Dispatch: expected to block once the limit is reached, found %v", err)
+	}
+
+	release <- struct{}{}
+	if err := d.Dispatch(context.Background(), keyed(3, "")); err != nil {
+		t.Fatalf("Dispatch: unexpected error once a delivery has been processed: %v", err)
+	}
+
+	close(release)
+	d.Close()
+}
+
+/*
+TestDispatcherMaxOutstandingBytes makes sure a delivery larger than the maximum
+size is dispatched when no other is outstanding, and that Dispatch blocks until it
+has been processed.
+*/
+func TestDispatcherMaxOutstandingBytes(t *testing.T) {
+	release := make(chan struct{})
+	d, err := NewDispatcher(&FlowControl{
+		MaxOutstandingBytes: 10,
+		Concurrency:         2,
+	}, func(*Delivery) {
+		<-release
+	})
+
+	if err != nil {
+		t.Fatalf("NewDispatcher: unexpected error: %v", err)
+	}
+
+	large := NewDelivery(&Message{Body: make([]byte, 50)}, 1, &acknowledger{})
+	if err := d.Dispatch(context.Background(), large); err != nil {
+		t.Fatalf("Dispatch: unexpected error for a large delivery: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := d.Dispatch(ctx, keyed(1, "")); err != context.DeadlineExceeded {
+		t.Fatalf("Dispatch: expected to block while the large delivery is outstanding, found %v", err)
+	}
+
+	close(release)
+	if err := d.Dispatch(context.Background(), keyed(2, "")); err != nil {
+		t.Fatalf("Dispatch: unexpected error once the large delivery has been processed: %v", err)
+	}
+
+	d.Close()
+}
@@ -0,0 +1,350 @@
+package mempubsub
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/pubsub"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+DefaultBroker is the broker used by the adapters returned by New. Since it is
+shared within the process, a publisher and a subscriber created separately (such
+as by the gateway and the scheduler) exchange messages as long as they use the
+same topic.
+*/
+var DefaultBroker = NewBroker()
+
+/*
+Broker dispatches messages published on topics to their subscriptions. Every
+subscription of a topic receives every messages published on the topic, and each
+message of a subscription is delivered to a single receiver at a time. A message
+is delivered again if it is nacked or not acknowledged before its deadline. It is
+safe for concurrent use.
+*/
+type Broker struct {
+
+	// mutex protects the topics below.
+	mutex sync.Mutex
+
+	// topics holds the subscriptions of every topics, indexed by their name.
+	topics map[string]map[string]*subscription
+}
+
+/*
+subscription holds the messages of a subscription not acknowledged yet, in the
+order they have been published.
+*/
+type subscription struct {
+
+	// mutex protects the envelopes below.
+	mutex sync.Mutex
+
+	// envelopes are the messages not acknowledged yet, being delivered or not.
+	envelopes []*envelope
+
+	// ready is signaled every time a message may be available for delivery.
+	ready chan struct{}
+}
+
+/*
+envelope holds a message of a subscription along its delivery state.
+*/
+type envelope struct {
+
+	// message is the message published.
+	message *pubsub.Message
+
+	// attempt is the number of times the message has been delivered.
+	attempt uint16
+
+	// token identifies the current delivery of the message. It changes every time
+	// the message is delivered, so a receiver can not settle a message which has
+	// been delivered again to another one.
+	token uint64
+
+	// inflight is true while the message is being delivered.
+	inflight bool
+
+	// at is the instant from which the message can be delivered. For a message in
+	// flight, this is its deadline.
+	at time.Time
+}
+
+/*
+NewBroker returns a new broker, with no topic.
+*/
+func NewBroker() *Broker {
+	return &Broker{
+		topics: map[string]map[string]*subscription{},
+	}
+}
+
+/*
+Subscribe creates a subscription on a topic if it does not exist yet. Messages are
+only kept for the subscriptions existing when they are published, so a subscription
+must be created before publishing messages it shall receive.
+*/
+func (b *Broker) Subscribe(topic string, name string) {
+	b.subscription(topic, name)
+}
+
+/*
+Publish publishes messages on a topic. Each subscription of the topic receives a
+copy of every messages. Messages published on a topic without subscription are
+dropped.
+*/
+func (b *Broker) Publish(topic string, messages ...*pubsub.Message) {
+	b.mutex.Lock()
+	subscriptions := []*subscription{}
+	for _, sub := range b.topics[topic] {
+		subscriptions = append(subscriptions, sub)
+	}
+
+	b.mutex.Unlock()
+	for _, sub := range subscriptions {
+		for _, m := range messages {
+			sub.push(copyMessage(m))
+		}
+	}
+}
+
+/*
+Receive returns the next delivery of a subscription, blocking until a message is
+available or the context is done. The delivery must be settled before the deadline
+passed in params, otherwise the message is delivered again. The subscription is
+created if it does not exist yet.
+*/
+func (b *Broker) Receive(ctx context.Context, topic string, name string, deadline time.Duration) (*pubsub.Delivery, error) {
+	sub := b.subscription(topic, name)
+	for {
+		d, next := sub.pop(time.Now(), deadline)
+		if d != nil {
+			return d, nil
+		}
+
+		var timer *time.Timer
+		var wake <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			wake = timer.C
+		}
+
+		var err error
+		select {
+		case <-sub.ready:
+		case <-wake:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+/*
+subscription returns a subscription of a topic, creating it if needed.
+*/
+func (b *Broker) subscription(topic string, name string) *subscription {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.topics[topic] == nil {
+		b.topics[topic] = map[string]*subscription{}
+	}
+
+	sub := b.topics[topic][name]
+	if sub == nil {
+		sub = &subscription{
+			envelopes: []*envelope{},
+			ready:     make(chan struct{}, 1),
+		}
+
+		b.topics[topic][name] = sub
+	}
+
+	return sub
+}
+
+/*
+push adds a message to the subscription and wakes up a receiver.
+*/
+func (sub *subscription) push(m *pubsub.Message) {
+	sub.mutex.Lock()
+	sub.envelopes = append(sub.envelopes, &envelope{
+		message: m,
+	})
+
+	sub.mutex.Unlock()
+	sub.signal()
+}
+
+/*
+pop delivers the first message available at the instant passed in params: either
+a message not in flight whose delay has passed, or a message in flight whose
+deadline has passed. If none is available, it returns the next instant a message
+will be, or a zero instant if it depends on a message being published or nacked.
+*/
+func (sub *subscription) pop(now time.Time, deadline time.Duration) (*pubsub.Delivery, time.Time) {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+
+	var next time.Time
+	for _, e := range sub.envelopes {
+		if e.at.After(now) {
+			if next.IsZero() || e.at.Before(next) {
+				next = e.at
+			}
+
+			continue
+		}
+
+		e.attempt++
+		e.token++
+		e.inflight = true
+		e.at = now.Add(deadline)
+		ack := &acknowledger{
+			subscription: sub,
+			envelope:     e,
+			token:        e.token,
+		}
+
+		if sub.available(now) {
+			sub.signal()
+		}
+
+		return pubsub.NewDelivery(copyMessage(e.message), e.attempt, ack), time.Time{}
+	}
+
+	return nil, next
+}
+
+/*
+available reports if a message is available for delivery at the instant passed
+in params. Since signals are dropped when a receiver has already been signaled,
+pop calls it after each delivery to wake up the next receiver while messages are
+left. The mutex must be held.
+*/
+func (sub *subscription) available(now time.Time) bool {
+	for _, e := range sub.envelopes {
+		if !e.at.After(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+signal wakes up a receiver waiting for a message, if any. It never blocks: the
+signal is dropped if a receiver has already been signaled and has not woken up
+yet.
+*/
+func (sub *subscription) signal() {
+	select {
+	case sub.ready <- struct{}{}:
+	default:
+	}
+}
+
+/*
+acknowledger implements the pubsub.Acknowledger interface for a delivery of a
+message.
+*/
+type acknowledger struct {
+	subscription *subscription
+	envelope     *envelope
+	token        uint64
+}
+
+/*
+Ack removes the message from the subscription.
+*/
+func (a *acknowledger) Ack() error {
+	return a.settle("Failed to acknowledge message", func(sub *subscription) {
+		for i, e := range sub.envelopes {
+			if e == a.envelope {
+				sub.envelopes = append(sub.envelopes[:i], sub.envelopes[i+1:]...)
+				break
+			}
+		}
+	})
+}
+
+/*
+Nack makes the message available again once the duration has passed.
+*/
+func (a *acknowledger) Nack(requeueAfter time.Duration) error {
+	err := a.settle("Failed to nack message", func(sub *subscription) {
+		a.envelope.inflight = false
+		a.envelope.at = time.Now().Add(requeueAfter)
+	})
+
+	a.subscription.signal()
+	return err
+}
+
+/*
+Extend postpones the deadline of the message.
+*/
+func (a *acknowledger) Extend(deadline time.Time) error {
+	return a.settle("Failed to extend message deadline", func(sub *subscription) {
+		a.envelope.at = deadline
+	})
+}
+
+/*
+settle applies a function on the subscription if the message is still in flight
+for this delivery. It returns an error if the message has been delivered again
+since then.
+*/
+func (a *acknowledger) settle(message string, fn func(*subscription)) error {
+	sub := a.subscription
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+
+	if !a.envelope.inflight || a.envelope.token != a.token {
+		return &errors.Error{
+			StatusCode: 409,
+			Message:    "pubsub/memory: " + message,
+			Validations: []errors.Validation{
+				{
+					Message: "Message has been delivered again since its deadline has passed",
+					Path:    []string{"Delivery"},
+				},
+			},
+		}
+	}
+
+	fn(sub)
+	return nil
+}
+
+/*
+copyMessage returns a deep copy of a message, so subscriptions and deliveries
+never share the same body nor metadata.
+*/
+func copyMessage(m *pubsub.Message) *pubsub.Message {
+	out := &pubsub.Message{
+		Metadata: map[string]string{},
+	}
+
+	if m.Body != nil {
+		out.Body = make([]byte, len(m.Body))
+		copy(out.Body, m.Body)
+	}
+
+	for k, v := range m.Metadata {
+		out.Metadata[k] = v
+	}
+
+	return out
+}
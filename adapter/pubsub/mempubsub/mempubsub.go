@@ -0,0 +1,122 @@
+package mempubsub
+
+import (
+	"context"
+
+	"github.com/nunchistudio/blacksmith/adapter/pubsub"
+)
+
+/*
+PubSub implements the pubsub.PubSub interface on top of an in-process broker.
+*/
+type PubSub struct {
+
+	// options are the options originally passed when creating the adapter.
+	options *pubsub.Options
+
+	// publisher and subscriber are the ones returned by the adapter.
+	publisher  *Publisher
+	subscriber *Subscriber
+}
+
+/*
+New returns a new in-memory Pub / Sub adapter relying on the DefaultBroker. The
+options' driver is always overridden to pubsub.DriverMemory. The topic, the
+subscription, the ack deadline, and the content type are set to the defaults if
+not set. It returns an error if the content type or the encoding is not supported,
+or if the dead-letter topic is the topic of the options.
+*/
+func New(opts *pubsub.Options) (*PubSub, error) {
+	return NewWithBroker(opts, DefaultBroker)
+}
+
+/*
+NewWithBroker returns a new in-memory Pub / Sub adapter relying on the broker
+passed in params. This allows tests to isolate their messages from the ones of
+the rest of the process.
+*/
+func NewWithBroker(opts *pubsub.Options, broker *Broker) (*PubSub, error) {
+	if opts == nil {
+		opts = &pubsub.Options{}
+	}
+
+	if opts.Topic == "" {
+		opts.Topic = pubsub.Defaults.Topic
+	}
+
+	if opts.Subscription == "" {
+		opts.Subscription = pubsub.Defaults.Subscription
+	}
+
+	if opts.AckDeadline == 0 {
+		opts.AckDeadline = pubsub.Defaults.AckDeadline
+	}
+
+	if opts.ContentType == "" {
+		opts.ContentType = pubsub.Defaults.ContentType
+	}
+
+	if err := pubsub.ValidateCodec(opts.ContentType, opts.Encoding); err != nil {
+		return nil, err
+	}
+
+	opts.From = pubsub.DriverMemory
+	ctx, cancel := context.WithCancel(context.Background())
+	publisher := &Publisher{
+		broker:       broker,
+		topic:        opts.Topic,
+		subscription: opts.Subscription,
+		contentType:  opts.ContentType,
+		encoding:     opts.Encoding,
+	}
+
+	policy := opts.DeadLetterPolicy(publisher)
+	if err := pubsub.ValidateDeadLetter(policy); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	ps := &PubSub{
+		options:   opts,
+		publisher: publisher,
+		subscriber: &Subscriber{
+			broker:       broker,
+			topic:        opts.Topic,
+			subscription: opts.Subscription,
+			deadline:     opts.AckDeadline,
+			policy:       policy,
+			ctx:          ctx,
+			cancel:       cancel,
+		},
+	}
+
+	return ps, nil
+}
+
+/*
+String returns the string representation of the adapter.
+*/
+func (ps *PubSub) String() string {
+	return string(pubsub.DriverMemory)
+}
+
+/*
+Options returns the options originally passed when creating the adapter.
+*/
+func (ps *PubSub) Options() *pubsub.Options {
+	return ps.options
+}
+
+/*
+Publisher returns the interface in charge of publishing messages in realtime.
+*/
+func (ps *PubSub) Publisher() pubsub.Publisher {
+	return ps.publisher
+}
+
+/*
+Subscriber returns the interface in charge of subscribing to messages in realtime.
+*/
+func (ps *PubSub) Subscriber() pubsub.Subscriber {
+	return ps.subscriber
+}
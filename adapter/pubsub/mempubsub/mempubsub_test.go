@@ -0,0 +1,419 @@
+package mempubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/pubsub"
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+open returns a new adapter relying on its own broker, along the broker. The
+subscription is created so queues sent by the test are not dropped.
+*/
+func open(t *testing.T, opts *pubsub.Options) (*PubSub, *Broker) {
+	broker := NewBroker()
+	ps, err := NewWithBroker(opts, broker)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	if err := ps.Publisher().Init(&pubsub.Toolkit{}); err != nil {
+		t.Fatalf("Init: unexpected error: %v", err)
+	}
+
+	t.Cleanup(func() {
+		ps.Subscriber().Shutdown(&pubsub.Toolkit{})
+	})
+
+	return ps, broker
+}
+
+/*
+send sends a queue holding a single event with the ID passed in params.
+*/
+func send(t *testing.T, ps *PubSub, id string) {
+	queue := &store.Queue{
+		Events: []*store.Event{
+			{ID: id},
+		},
+	}
+
+	if err := ps.Publisher().Send(&pubsub.Toolkit{}, queue); err != nil {
+		t.Fatalf("Send: unexpected error: %v", err)
+	}
+}
+
+/*
+receive returns the next delivery of a subscription, failing the test if none is
+available within the timeout.
+*/
+func receive(t *testing.T, broker *Broker, topic string, name string, deadline time.Duration) *pubsub.Delivery {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	d, err := broker.Receive(ctx, topic, name, deadline)
+	if err != nil {
+		t.Fatalf("Receive: expected a delivery on %s, found %v", name, err)
+	}
+
+	return d
+}
+
+/*
+assertEmpty makes sure no message is delivered on a subscription within the
+duration passed.
+*/
+func assertEmpty(t *testing.T, broker *Broker, topic string, name string, within time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), within)
+	defer cancel()
+
+	if d, err := broker.Receive(ctx, topic, name, time.Minute); err == nil {
+		t.Fatalf("Receive: expected no delivery on %s, found attempt %d", name, d.Attempt)
+	}
+}
+
+/*
+assertConflict makes sure an error is a 409 error, returned when settling a
+delivery which can not be settled anymore.
+*/
+func assertConflict(t *testing.T, label string, err error) {
+	if err == nil {
+		t.Fatalf("%s: expected an error", label)
+	}
+
+	if fail := errors.From(err); fail.StatusCode != 409 {
+		t.Fatalf("%s: expected a 409 error, found %d: %v", label, fail.StatusCode, err)
+	}
+}
+
+/*
+TestBrokerFanOut makes sure every subscription of a topic receives its own copy of
+every messages, and that messages published on a topic without subscription are
+dropped.
+*/
+func TestBrokerFanOut(t *testing.T) {
+	broker := NewBroker()
+	broker.Subscribe("orders", "warehouse")
+	broker.Subscribe("orders", "billing")
+	broker.Publish("nowhere", &pubsub.Message{Body: []byte("lost")})
+	broker.Publish("orders", &pubsub.Message{
+		Body: []byte("order"),
+		Metadata: map[string]string{
+			"source": "shop",
+		},
+	})
+
+	warehouse := receive(t, broker, "orders", "warehouse", time.Minute)
+	billing := receive(t, broker, "orders", "billing", time.Minute)
+	for _, d := range []*pubsub.Delivery{warehouse, billing} {
+		if string(d.Message.Body) != "order" || d.Message.Metadata["source"] != "shop" || d.Attempt != 1 {
+			t.Fatalf("Receive: expected the message published, found %+v", d)
+		}
+	}
+
+	warehouse.Message.Body[0] = 'x'
+	warehouse.Message.Metadata["source"] = "changed"
+	if string(billing.Message.Body) != "order" || billing.Message.Metadata["source"] != "shop" {
+		t.Fatalf("Receive: expected subscriptions not to share messages, found %+v", billing.Message)
+	}
+
+	if err := warehouse.Ack(); err != nil {
+		t.Fatalf("Ack: unexpected error: %v", err)
+	}
+
+	assertEmpty(t, broker, "orders", "warehouse", 20*time.Millisecond)
+	assertEmpty(t, broker, "nowhere", "late", 20*time.Millisecond)
+}
+
+/*
+TestBrokerReceivers makes sure every receivers waiting on a subscription are woken
+up when several messages are published at once.
+*/
+func TestBrokerReceivers(t *testing.T) {
+	broker := NewBroker()
+	broker.Subscribe("orders", "warehouse")
+
+	received := make(chan *pubsub.Delivery, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			d, err := broker.Receive(ctx, "orders", "warehouse", time.Minute)
+			if err == nil {
+				received <- d
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	broker.Publish("orders", &pubsub.Message{}, &pubsub.Message{})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatalf("Receive: expected receiver %d to be woken up", i+1)
+		}
+	}
+}
+
+/*
+TestAck makes sure every queue sent is received and acknowledged exactly once
+across concurrent receivers, and that a delivery can only be acknowledged once.
+*/
+func TestAck(t *testing.T) {
+	ps, _ := open(t, nil)
+	for i := 0; i < 50; i++ {
+		send(t, ps, "evt")
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	received := 0
+	for w := 0; w < 5; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				d, err := ps.Subscriber().Receive(&pubsub.Toolkit{})
+				if err != nil {
+					return
+				}
+
+				if d.Queue.Events[0].ID != "evt" || d.Attempt != 1 {
+					t.Errorf("Receive: expected the first delivery of the queue sent, found %+v", d)
+				}
+
+				if err := d.Ack(); err != nil {
+					t.Errorf("Ack: unexpected error: %v", err)
+				}
+
+				if err := d.Ack(); err == nil {
+					t.Errorf("Ack: expected an error when acknowledging twice")
+				}
+
+				mutex.Lock()
+				received++
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	ps.Subscriber().Shutdown(&pubsub.Toolkit{})
+	wg.Wait()
+
+	if received != 50 {
+		t.Fatalf("Receive: expected 50 queues received, found %d", received)
+	}
+}
+
+/*
+TestRedelivery makes sure a delivery not settled before its deadline is delivered
+again, and that the stale delivery can not be settled anymore.
+*/
+func TestRedelivery(t *testing.T) {
+	ps, broker := open(t, &pubsub.Options{
+		AckDeadline: 30 * time.Millisecond,
+	})
+
+	send(t, ps, "evt")
+	first := receive(t, broker, "blacksmith", "blacksmith", 30*time.Millisecond)
+	start := time.Now()
+	second := receive(t, broker, "blacksmith", "blacksmith", time.Minute)
+	if second.Attempt != 2 || time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("Receive: expected a second attempt after the deadline, found attempt %d after %s", second.Attempt, time.Since(start))
+	}
+
+	assertConflict(t, "Ack", first.Ack())
+	assertConflict(t, "Nack", first.Nack(0))
+	assertConflict(t, "Extend", first.Extend(time.Now().Add(time.Hour)))
+	if err := second.Ack(); err != nil {
+		t.Fatalf("Ack: unexpected error: %v", err)
+	}
+
+	assertEmpty(t, broker, "blacksmith", "blacksmith", 50*time.Millisecond)
+}
+
+/*
+TestNack makes sure a nacked delivery is delivered again once the duration has
+passed, and not before.
+*/
+func TestNack(t *testing.T) {
+	ps, broker := open(t, nil)
+	send(t, ps, "evt")
+
+	d, err := ps.Subscriber().Receive(&pubsub.Toolkit{})
+	if err != nil {
+		t.Fatalf("Receive: unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	if err := d.Nack(40 * time.Millisecond); err != nil {
+		t.Fatalf("Nack: unexpected error: %v", err)
+	}
+
+	if err := d.Ack(); err == nil {
+		t.Fatalf("Ack: expected an error once nacked")
+	}
+
+	again := receive(t, broker, "blacksmith", "blacksmith", time.Minute)
+	if again.Attempt != 2 || time.Since(start) < 30*time.Millisecond {
+		t.Fatalf("Receive: expected a second attempt after the delay, found attempt %d after %s", again.Attempt, time.Since(start))
+	}
+
+	if err := again.Nack(0); err != nil {
+		t.Fatalf("Nack: unexpected error: %v", err)
+	}
+
+	if d := receive(t, broker, "blacksmith", "blacksmith", time.Minute); d.Attempt != 3 {
+		t.Fatalf("Receive: expected a third attempt without delay, found attempt %d", d.Attempt)
+	}
+}
+
+/*
+TestExtend makes sure an extended delivery is not delivered again before its new
+deadline, and can still be acknowledged afterwards.
+*/
+func TestExtend(t *testing.T) {
+	ps, broker := open(t, &pubsub.Options{
+		AckDeadline: 20 * time.Millisecond,
+	})
+
+	send(t, ps, "evt")
+	d := receive(t, broker, "blacksmith", "blacksmith", 20*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err := d.Extend(time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Extend: unexpected error: %v", err)
+		}
+	}
+
+	assertEmpty(t, broker, "blacksmith", "blacksmith", 60*time.Millisecond)
+	if err := d.Ack(); err != nil {
+		t.Fatalf("Ack: unexpected error: %v", err)
+	}
+
+	assertConflict(t, "Extend", d.Extend(time.Now().Add(time.Hour)))
+}
+
+/*
+TestShutdown makes sure pending receives return once the subscriber has been shut
+down, and that the subscriber can receive again once initialized.
+*/
+func TestShutdown(t *testing.T) {
+	ps, _ := open(t, nil)
+	tk := &pubsub.Toolkit{}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ps.Subscriber().Receive(tk)
+		done <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	ps.Subscriber().Shutdown(tk)
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("Receive: expected an error once shut down")
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("Receive: expected the pending receive to return once shut down")
+	}
+
+	if err := ps.Subscriber().Init(tk); err != nil {
+		t.Fatalf("Init: unexpected error: %v", err)
+	}
+
+	send(t, ps, "evt")
+	if _, err := ps.Subscriber().Receive(tk); err != nil {
+		t.Fatalf("Receive: unexpected error once initialized again: %v", err)
+	}
+}
+
+/*
+TestDeadLetter makes sure a delivery failing or never settled more times than the
+maximum is forwarded to the dead-letter topic, and can be replayed from there.
+*/
+func TestDeadLetter(t *testing.T) {
+	if _, err := NewWithBroker(&pubsub.Options{Topic: "orders", DeadLetterTopic: "orders"}, NewBroker()); err == nil {
+		t.Fatalf("New: expected an error when the dead-letter topic is the topic")
+	}
+
+	tk := &pubsub.Toolkit{}
+	broker := NewBroker()
+	broker.Subscribe("dead", "letters")
+	ps, err := NewWithBroker(&pubsub.Options{
+		AckDeadline:     30 * time.Millisecond,
+		MaxDeliveries:   2,
+		DeadLetterTopic: "dead",
+	}, broker)
+
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	ps.Publisher().Init(tk)
+	t.Cleanup(func() {
+		ps.Subscriber().Shutdown(tk)
+	})
+
+	send(t, ps, "evt")
+	policy := ps.Options().DeadLetterPolicy(ps.publisher)
+	for attempt := uint16(1); attempt <= 2; attempt++ {
+		d, err := ps.Subscriber().Receive(tk)
+		if err != nil || d.Attempt != attempt {
+			t.Fatalf("Receive: expected attempt %d, found %+v and %v", attempt, d, err)
+		}
+
+		if err := pubsub.Fail(tk, d, &errors.Error{Message: "boom"}, 0, policy); err != nil {
+			t.Fatalf("Fail: unexpected error: %v", err)
+		}
+	}
+
+	dl := receive(t, broker, "dead", "letters", time.Minute)
+	letter, ok := pubsub.DeadLetterOf(dl.Message)
+	if !ok || letter.Attempts != 2 || letter.Topic != "blacksmith" || letter.Error.Message != "boom" {
+		t.Fatalf("DeadLetterOf: expected the dead letter of the second attempt, found %+v", letter)
+	}
+
+	if err := pubsub.Replay(tk, ps.publisher, dl.Message); err != nil {
+		t.Fatalf("Replay: unexpected error: %v", err)
+	}
+
+	dl.Ack()
+	d, err := ps.Subscriber().Receive(tk)
+	if err != nil {
+		t.Fatalf("Receive: unexpected error: %v", err)
+	}
+
+	if _, ok := pubsub.DeadLetterOf(d.Message); ok || d.Attempt != 1 || d.Queue.Events[0].ID != "evt" {
+		t.Fatalf("Receive: expected the original queue to be replayed, found %+v", d)
+	}
+
+	// The replayed delivery is never settled: it is delivered again once, and then
+	// forwarded to the dead-letter topic when delivered a third time.
+	if d, err = ps.Subscriber().Receive(tk); err != nil || d.Attempt != 2 {
+		t.Fatalf("Receive: expected attempt 2, found %+v and %v", d, err)
+	}
+
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		ps.Subscriber().Shutdown(tk)
+	}()
+
+	if _, err := ps.Subscriber().Receive(tk); err == nil {
+		t.Fatalf("Receive: expected the third attempt to be rejected")
+	}
+
+	dl = receive(t, broker, "dead", "letters", time.Minute)
+	if letter, _ := pubsub.DeadLetterOf(dl.Message); letter.Attempts != 3 {
+		t.Fatalf("DeadLetterOf: expected the dead letter of the third attempt, found %+v", letter)
+	}
+}
@@ -0,0 +1,9 @@
+/*
+Package mempubsub provides an in-process implementation of the pubsub adapter.
+Messages are exchanged through a broker living in the running process, so the
+gateway and scheduler can load jobs in realtime when running in the same process,
+without a running broker. This is useful for local development, demos, and tests.
+
+Messages are lost when the process stops. It shall not be used in production.
+*/
+package mempubsub
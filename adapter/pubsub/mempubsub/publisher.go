@@ -0,0 +1,67 @@
+package mempubsub
+
+import (
+	"github.com/nunchistudio/blacksmith/adapter/pubsub"
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+Publisher implements the pubsub.Publisher interface by publishing queues on the
+topic of the adapter's options.
+*/
+type Publisher struct {
+
+	// broker is the broker the queues are published on.
+	broker *Broker
+
+	// topic and subscription are the ones of the adapter's options.
+	topic        string
+	subscription string
+
+	// contentType and encoding are the ones of the adapter's options, used to
+	// encode queues.
+	contentType string
+	encoding    string
+}
+
+/*
+Init creates the subscription of the adapter's options, so queues sent before the
+subscriber starts receiving are not dropped.
+*/
+func (p *Publisher) Init(tk *pubsub.Toolkit) error {
+	p.broker.Subscribe(p.topic, p.subscription)
+	return nil
+}
+
+/*
+Send publishes a queue, encoded given the content type and encoding of the
+adapter's options. It returns once the queue is available to the subscriptions
+of the topic.
+*/
+func (p *Publisher) Send(tk *pubsub.Toolkit, queue *store.Queue) error {
+	m, err := pubsub.Encode(queue, p.contentType, p.encoding)
+	if err != nil {
+		return err
+	}
+
+	p.broker.Publish(p.topic, m)
+	return nil
+}
+
+/*
+Forward implements the pubsub.Forwarder interface by publishing a message as is
+on a topic. This is used for forwarding dead letters and replaying them. The
+message is dropped if the topic has no subscription.
+*/
+func (p *Publisher) Forward(tk *pubsub.Toolkit, topic string, m *pubsub.Message) error {
+	p.broker.Publish(topic, m)
+	return nil
+}
+
+/*
+Shutdown does nothing since queues are available to subscriptions as soon as they
+are sent.
+*/
+func (p *Publisher) Shutdown(tk *pubsub.Toolkit) error {
+	return nil
+}
@@ -0,0 +1,130 @@
+package mempubsub
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/pubsub"
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+Subscriber implements the pubsub.Subscriber interface by receiving queues from the
+subscription of the adapter's options.
+*/
+type Subscriber struct {
+
+	// broker is the broker the queues are received from.
+	broker *Broker
+
+	// topic and subscription are the ones of the adapter's options.
+	topic        string
+	subscription string
+
+	// deadline is the ack deadline of the adapter's options.
+	deadline time.Duration
+
+	// policy is the dead-letter policy of the adapter's options.
+	policy *pubsub.DeadLetterPolicy
+
+	// mutex protects ctx and cancel.
+	mutex sync.Mutex
+
+	// ctx is done once the subscriber has been shut down, which unblocks pending
+	// receives.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+/*
+Init creates the subscription of the adapter's options if it does not exist yet.
+A subscriber which has been shut down can receive again once initialized.
+*/
+func (s *Subscriber) Init(tk *pubsub.Toolkit) error {
+	s.mutex.Lock()
+	if s.ctx.Err() != nil {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+
+	s.mutex.Unlock()
+	s.broker.Subscribe(s.topic, s.subscription)
+	return nil
+}
+
+/*
+Receive returns the next delivery of the subscription, holding a queue, blocking
+until one is sent. The queue is decoded given the content type and encoding of the
+message's metadata. It returns an error once the subscriber has been shut down.
+
+A message delivered more times than the maximum of the adapter's options is
+rejected without being returned, since its last attempt has never been settled.
+A message which can not be decoded is rejected as well, since it would never be,
+and an error is returned. Rejected messages are forwarded to the dead-letter
+topic, if any.
+*/
+func (s *Subscriber) Receive(tk *pubsub.Toolkit) (*pubsub.Delivery, error) {
+	fail := &errors.Error{
+		Message:     "pubsub/memory: Failed to receive queue",
+		Validations: []errors.Validation{},
+	}
+
+	s.mutex.Lock()
+	ctx := s.ctx
+	s.mutex.Unlock()
+
+	for {
+		d, err := s.broker.Receive(ctx, s.topic, s.subscription, s.deadline)
+		if err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: "Subscriber has been shut down",
+			})
+
+			return nil, fail
+		}
+
+		if s.policy.Exceeded(d) {
+			exceeded := &errors.Error{
+				Message: "pubsub/memory: Failed to receive queue",
+				Validations: []errors.Validation{
+					{
+						Message: "Maximum number of deliveries exceeded",
+						Path:    []string{"Options", "MaxDeliveries"},
+					},
+				},
+			}
+
+			if err := pubsub.Reject(tk, d, exceeded, s.policy); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		d.Queue = &store.Queue{}
+		if err := pubsub.Decode(d.Message, d.Queue); err != nil {
+			if rerr := pubsub.Reject(tk, d, err, s.policy); rerr != nil {
+				return nil, rerr
+			}
+
+			return nil, err
+		}
+
+		return d, nil
+	}
+}
+
+/*
+Shutdown stops the subscriber. Pending and subsequent receives return an error,
+until the subscriber is initialized again.
+Queues not received yet are kept in the subscription, and deliveries not settled
+yet are delivered again once their deadline has passed.
+*/
+func (s *Subscriber) Shutdown(tk *pubsub.Toolkit) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cancel()
+	return nil
+}
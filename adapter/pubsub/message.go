@@ -9,6 +9,7 @@ type Message struct {
 	// Body is the marshaled content of the message.
 	Body []byte `json:"body"`
 
-	// Metadata can hold some metadata about the message.
+	// Metadata can hold some metadata about the message. For messages encoded with
+	// Encode, it holds the content type and the encoding of the body.
 	Metadata map[string]string `json:"meta"`
 }
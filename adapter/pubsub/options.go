@@ -1,5 +1,9 @@
 package pubsub
 
+import (
+	"time"
+)
+
 /*
 Driver is a custom type allowing the user to only pass supported drivers when
 configuring the Pub / Sub adapter.
@@ -37,6 +41,13 @@ DriverRabbitMQ is used to leverage RabbitMQ as the Pub / Sub adapter.
 */
 var DriverRabbitMQ Driver = "rabbitmq"
 
+/*
+DriverMemory is used to leverage an in-process broker as the Pub / Sub adapter.
+Messages are only exchanged within the running process and are lost when it stops,
+so it shall only be used for development and testing purposes.
+*/
+var DriverMemory Driver = "memory"
+
 /*
 Defaults are the defaults options set for the pubsub. When not set, these values
 will automatically be applied.
@@ -44,6 +55,9 @@ will automatically be applied.
 var Defaults = &Options{
 	Topic:        "blacksmith",
 	Subscription: "blacksmith",
+	AckDeadline:  30 * time.Second,
+	ContentType:  ContentTypeJSON,
+	Encoding:     EncodingIdentity,
 }
 
 /*
@@ -65,6 +79,7 @@ type Options struct {
 	// Format for Apache Kafka: "<topic>"
 	// Format for NATS: "<subject>"
 	// Format for RabbitMQ: "<exchange>"
+	// Format for memory: "<topic>"
 	Topic string `json:"topic"`
 
 	// Subscription is the queue or subscription name the pubsub adapter will use
@@ -76,5 +91,55 @@ type Options struct {
 	// Format for Apache Kafka: "<consumer-group>"
 	// Format for NATS: "<queue>"
 	// Format for RabbitMQ: "<queue>"
+	// Format for memory: "<subscription>"
 	Subscription string `json:"subscription"`
+
+	// AckDeadline is the duration a subscriber has to settle a delivery. Once the
+	// deadline has passed, the message is delivered again. It can be postponed for
+	// each delivery with Extend.
+	//
+	// Note: Some brokers manage the deadline on their own, in which case this is a
+	// best effort.
+	AckDeadline time.Duration `json:"ack_deadline"`
+
+	// ContentType is the content type used by the publisher to marshal messages.
+	// Subscribers decode messages given the content type recorded in their metadata,
+	// no matter this option.
+	//
+	// Note: Subscribers must support the content type before publishers start using
+	// it. When rolling out a new content type, upgrade the scheduler first.
+	ContentType string `json:"content_type,omitempty"`
+
+	// Encoding is the compression used by the publisher for messages. It is empty
+	// for no compression. As for the content type, subscribers decode messages given
+	// the encoding recorded in their metadata.
+	Encoding string `json:"encoding,omitempty"`
+
+	// MaxDeliveries is the maximum number of times a queue is delivered to the
+	// scheduler. Once a queue has failed this many times, it is forwarded to the
+	// dead-letter topic. When zero, queues are delivered again until they succeed.
+	MaxDeliveries uint16 `json:"max_deliveries,omitempty"`
+
+	// DeadLetterTopic is the topic queues are forwarded to once they have failed
+	// MaxDeliveries times, with the failure details in their metadata. When empty,
+	// such queues are dropped.
+	//
+	// Format: Same as Topic.
+	DeadLetterTopic string `json:"dead_letter_topic,omitempty"`
+}
+
+/*
+DeadLetterPolicy returns the dead-letter policy of the options for the queues
+received by the scheduler. Dead letters are forwarded with the forwarder passed,
+which is usually the adapter's publisher. Drivers validate it with
+ValidateDeadLetter when created.
+*/
+func (opts *Options) DeadLetterPolicy(f Forwarder) *DeadLetterPolicy {
+	return &DeadLetterPolicy{
+		MaxDeliveries:      opts.MaxDeliveries,
+		Topic:              opts.DeadLetterTopic,
+		SourceTopic:        opts.Topic,
+		SourceSubscription: opts.Subscription,
+		Forwarder:          f,
+	}
 }
@@ -60,9 +60,13 @@ type Subscriber interface {
 	Init(*Toolkit) error
 
 	// Receive receives and returns the next queue from the Subscriber, blocking and
-	// polling if none are available.
-	Receive(*Toolkit) (*store.Queue, error)
+	// polling if none are available. The delivery returned holds the queue and must
+	// be settled once processed: the scheduler only acknowledges it once the jobs'
+	// transitions have been persisted in the store, so a queue is delivered again
+	// if the scheduler stops in between.
+	Receive(*Toolkit) (*Delivery, error)
 
-	// Shutdown flushes pending ack sends and disconnects the Subscriber.
+	// Shutdown flushes pending ack sends and disconnects the Subscriber. Deliveries
+	// not settled yet are delivered again once their deadline has passed.
 	Shutdown(*Toolkit) error
 }
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+/*
+DefaultSweepInterval is the interval used by SweepLeases when none is set.
+*/
+var DefaultSweepInterval = 30 * time.Second
+
+/*
+LeaseExpired returns the error recorded on the "awaiting" transition created when
+the lease of a job has expired. The error is retryable since the job has not been
+run to completion.
+*/
+func LeaseExpired(owner string) *errors.Error {
+	return &errors.Error{
+		Message: "Lease expired",
+		Validations: []errors.Validation{
+			{
+				Message: "Job has been abandoned by " + owner,
+				Path:    []string{"Transition", "Owner"},
+			},
+		},
+		Retryable: true,
+	}
+}
+
+/*
+ValidateClaim returns the validation errors of a claim given the owner and the
+lease duration. Drivers shall call it before claiming any job.
+*/
+func ValidateClaim(owner string, lease time.Duration) []errors.Validation {
+	fail := []errors.Validation{}
+	if owner == "" {
+		fail = append(fail, errors.Validation{
+			Message: "Owner must be set",
+			Path:    []string{"Claim", "Owner"},
+		})
+	}
+
+	if lease <= 0 {
+		fail = append(fail, errors.Validation{
+			Message: "Lease must be greater than 0",
+			Path:    []string{"Claim", "Lease"},
+		})
+	}
+
+	return fail
+}
+
+/*
+ValidateOwnership returns the validation errors of a transition made on behalf of
+the owner passed in params, given the latest transition of its job at the instant
+passed in params. A job claimed with ClaimJobs can only transition on behalf of
+its owner while the lease has not expired, so a scheduler instance whose lease has
+expired can not override the work of the next owner. A transition made on behalf
+of an owner is only accepted on a job claimed by this owner. Drivers shall call it
+for every lease extended, and through ValidateTransition for every transition
+added.
+*/
+func ValidateOwnership(latest *Transition, owner string, now time.Time) []errors.Validation {
+	fail := []errors.Validation{}
+	claimed := latest != nil && latest.StateAfter == StatusExecuting && latest.Owner != ""
+	switch {
+	case claimed && latest.Owner != owner:
+		fail = append(fail, errors.Validation{
+			Message: "Job is claimed by another owner",
+			Path:    []string{"Transition", "Owner"},
+		})
+
+	case claimed && latest.LeaseExpiresAt != nil && !now.Before(*latest.LeaseExpiresAt):
+		fail = append(fail, errors.Validation{
+			Message: "Lease has expired",
+			Path:    []string{"Transition", "LeaseExpiresAt"},
+		})
+
+	case !claimed && owner != "":
+		fail = append(fail, errors.Validation{
+			Message: "Job is not claimed by this owner",
+			Path:    []string{"Transition", "Owner"},
+		})
+	}
+
+	return fail
+}
+
+/*
+ValidateTransition returns the validation errors of a transition added to a job
+given the latest transition of the job, as ValidateOwnership does at the instant
+passed in params. The instant a transition has been created is not taken into
+account, so a transition can not bypass a lease by being created in the past.
+Transitions of an archive are restored with RestoreTransitions instead. Drivers
+shall call it for every transition added.
+*/
+func ValidateTransition(latest *Transition, t *Transition, now time.Time) []errors.Validation {
+	return ValidateOwnership(latest, t.Owner, now)
+}
+
+/*
+SweepLeases calls ExpireLeases on the store at every interval until the context
+is done, so jobs abandoned by a scheduler instance are brought back to "awaiting".
+Every instance of the scheduler can run it: the store makes sure a job is only
+brought back once. Errors are logged and do not stop the sweeper.
+*/
+func SweepLeases(ctx context.Context, tk *Toolkit, s Store, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			transitions, err := s.ExpireLeases(tk)
+			if err != nil {
+				tk.Logger.WithFields(logrus.Fields{
+					"error": err,
+				}).Error("store: Failed to expire leases")
+
+				continue
+			}
+
+			if len(transitions) > 0 {
+				tk.Logger.WithFields(logrus.Fields{
+					"jobs": len(transitions),
+				}).Warn("store: Leases expired, jobs are awaiting again")
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+Encryption is the interface used by drivers to encrypt the context and data of
+events and jobs before persisting them, and to decrypt them when reading them back.
+Every payloads are encrypted with the current key, while every keys still known
+can be used for decryption. This allows to rotate keys without downtime.
+
+See package storecrypto for an AES-GCM implementation using a local keyring file.
+*/
+type Encryption interface {
+
+	// KeyID returns the ID of the current key, used to encrypt new payloads.
+	KeyID() string
+
+	// Encrypt encrypts a payload with the current key. It returns the ID of the
+	// key used along the ciphertext.
+	Encrypt([]byte) (string, []byte, error)
+
+	// Decrypt decrypts a ciphertext given the ID of the key it was encrypted with.
+	Decrypt(string, []byte) ([]byte, error)
+}
+
+/*
+sealedPrefix is the prefix of every sealed payloads. It can not be the beginning
+of a valid JSON, so payloads persisted before encryption was enabled can still be
+read in clear text.
+*/
+var sealedPrefix = []byte("enc:v1:")
+
+/*
+Seal returns the representation of a payload to persist, encrypted with the
+current key of the encryption. The ID of the key is kept along the ciphertext so
+the payload can be decrypted once the key has been rotated. Empty payloads and
+nil encryption are returned as is.
+*/
+func Seal(enc Encryption, payload []byte) ([]byte, error) {
+	if enc == nil || len(payload) == 0 {
+		return payload, nil
+	}
+
+	id, ciphertext, err := enc.Encrypt(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := append([]byte{}, sealedPrefix...)
+	sealed = append(sealed, id...)
+	sealed = append(sealed, ':')
+	sealed = append(sealed, base64.RawStdEncoding.EncodeToString(ciphertext)...)
+	return sealed, nil
+}
+
+/*
+Unseal returns the payload in clear text of a payload persisted by Seal. Payloads
+not sealed are returned as is. It returns an error if a payload is sealed but the
+encryption is nil or the key is unknown.
+*/
+func Unseal(enc Encryption, sealed []byte) ([]byte, error) {
+	id, ok := SealedWith(sealed)
+	if !ok {
+		return sealed, nil
+	}
+
+	if enc == nil {
+		return nil, &errors.Error{
+			Message: "store: Payload is encrypted but no encryption is set",
+		}
+	}
+
+	rest := sealed[len(sealedPrefix)+len(id)+1:]
+	ciphertext, err := base64.RawStdEncoding.DecodeString(string(rest))
+	if err != nil {
+		return nil, err
+	}
+
+	return enc.Decrypt(id, ciphertext)
+}
+
+/*
+SealedWith returns the ID of the key a payload has been sealed with. It returns
+false if the payload is not sealed. Drivers can leverage it to find the payloads
+to re-encrypt after a key rotation.
+*/
+func SealedWith(sealed []byte) (string, bool) {
+	if !bytes.HasPrefix(sealed, sealedPrefix) {
+		return "", false
+	}
+
+	rest := sealed[len(sealedPrefix):]
+	end := bytes.IndexByte(rest, ':')
+	if end < 0 {
+		return "", false
+	}
+
+	return string(rest[:end]), true
+}
+
+/*
+Reseal returns a payload sealed with the current key of the encryption, and true
+if it has changed. Payloads already sealed with the current key and empty ones are
+returned as is, while payloads in clear text are sealed. Drivers shall leverage
+it to re-encrypt existing entries after a key rotation.
+*/
+func Reseal(enc Encryption, sealed []byte) ([]byte, bool, error) {
+	if enc == nil || len(sealed) == 0 {
+		return sealed, false, nil
+	}
+
+	if id, ok := SealedWith(sealed); ok && id == enc.KeyID() {
+		return sealed, false, nil
+	}
+
+	payload, err := Unseal(enc, sealed)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resealed, err := Seal(enc, payload)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return resealed, true, nil
+}
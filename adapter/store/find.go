@@ -13,12 +13,18 @@ looking for entries (events, jobs, or transitions).
 type Meta struct {
 
 	// Count is the number of entries found that match the constraints applied to
-	// the query (without the limit).
-	Count uint16 `json:"count"`
+	// the query (without the limit and cursors).
+	Count uint64 `json:"count"`
 
 	// Pagination is the pagination details based on the count, offset, and limit.
+	// It is nil when the query uses a cursor, since pages can not be computed.
 	Pagination *rest.Pagination `json:"pagination"`
 
+	// Cursors holds the cursors to retrieve the next and previous entries of the
+	// query. They are set regardless of the query using offset or cursors, so a
+	// client can switch to keyset pagination at any time.
+	Cursors *rest.Cursors `json:"cursors"`
+
 	// Where is the constraints applied to the query to find events, jobs, or
 	// transitions. This is included in the meta because the store can set defaults
 	// or override some constraints (such as a maximum limit). This allows to be aware
@@ -32,6 +38,20 @@ the store.
 */
 type WhereEvents struct {
 
+	// TenantsIn makes sure the entries returned by the query belong to any of the
+	// tenants present in the slice.
+	//
+	// Note: Unlike other constraints, it is also applied when EventID or JobID is
+	// set.
+	TenantsIn []string `json:"events.tenants_in,omitempty"`
+
+	// TenantsNotIn makes sure the entries returned by the query do not belong to any
+	// of the tenants present in the slice.
+	//
+	// Note: Unlike other constraints, it is also applied when EventID or JobID is
+	// set.
+	TenantsNotIn []string `json:"events.tenants_notin,omitempty"`
+
 	// SourcesIn makes sure the entries returned by the query have any of the source
 	// name present in the slice.
 	SourcesIn []string `json:"events.sources_in,omitempty"`
@@ -64,17 +84,48 @@ type WhereEvents struct {
 	// an event received after this instant.
 	ReceivedAfter *time.Time `json:"events.received_after,omitempty"`
 
+	// OlderThan makes sure the entries returned by the query are related to an
+	// event received more than this duration ago. It is resolved when the query
+	// runs, which allows to define retention windows in static options.
+	//
+	// Example: 30 * 24 * time.Hour
+	OlderThan time.Duration `json:"events.older_than,omitempty"`
+
+	// NewerThan makes sure the entries returned by the query are related to an
+	// event received less than this duration ago. It is resolved when the query
+	// runs.
+	NewerThan time.Duration `json:"events.newer_than,omitempty"`
+
+	// Predicates makes sure the entries returned by the query are related to an
+	// event whose context and data match every predicates.
+	Predicates []*Predicate `json:"events.predicates,omitempty"`
+
 	// AndWhereJobs lets you define additional constraints related to the jobs for
 	// the entries you are looking for.
 	AndWhereJobs *WhereJobs `json:"jobs,omitempty"`
 
+	// After is an opaque cursor returned in a query's meta. When set, only the
+	// entries positioned after the cursor are returned. Entries are positioned
+	// given their timestamp (the reception date for events, the creation date for
+	// jobs and transitions) and then their ID.
+	//
+	// Note: When a cursor is set, the offset is not applied.
+	After string `json:"after,omitempty"`
+
+	// Before is an opaque cursor returned in a query's meta. When set, only the
+	// entries positioned before the cursor are returned. When After is not set,
+	// the entries returned are the closest ones to the cursor.
+	//
+	// Note: When a cursor is set, the offset is not applied.
+	Before string `json:"before,omitempty"`
+
 	// Offset specifies the number of entries to skip before starting to return entries
 	// from the query.
-	Offset uint16 `json:"offset"`
+	Offset uint64 `json:"offset"`
 
 	// Limit specifies the number of entries to return after the offset clause has
 	// been processed.
-	Limit uint16 `json:"limit"`
+	Limit uint64 `json:"limit"`
 }
 
 /*
@@ -85,7 +136,7 @@ type WhereJobs struct {
 	// EventID allows to find every entries related to a specific event ID.
 	//
 	// Note: When set, other constraints are not applied (except parent offset and
-	// limit).
+	// limit, and tenants).
 	EventID string `json:"event.id,omitempty"`
 
 	// DestinationsIn makes sure the entries returned by the query have any of the
@@ -120,6 +171,22 @@ type WhereJobs struct {
 	// job created after this instant.
 	CreatedAfter *time.Time `json:"jobs.created_after,omitempty"`
 
+	// MinPriority makes sure the entries returned by the query are related to a
+	// job having a priority equal to or greater than this one.
+	MinPriority *int `json:"jobs.min_priority,omitempty"`
+
+	// MaxPriority makes sure the entries returned by the query are related to a
+	// job having a priority equal to or lesser than this one.
+	MaxPriority *int `json:"jobs.max_priority,omitempty"`
+
+	// ReadyAt makes sure the entries returned by the query are related to a job
+	// allowed to run at this instant: its NotBefore is not set or is not after it.
+	ReadyAt *time.Time `json:"jobs.ready_at,omitempty"`
+
+	// Predicates makes sure the entries returned by the query are related to a job
+	// whose context and data match every predicates.
+	Predicates []*Predicate `json:"jobs.predicates,omitempty"`
+
 	// AndWhereTransitions lets you define additional constraints related to the
 	// transitions for the entries you are looking for.
 	AndWhereTransitions *WhereTransitions `json:"transitions,omitempty"`
@@ -134,7 +201,7 @@ type WhereTransitions struct {
 	// JobID allows to find every entries related to a specific job ID.
 	//
 	// Note: When set, other constraints are not applied (except parent offset and
-	// limit).
+	// limit, and tenants).
 	JobID string `json:"job.id,omitempty"`
 
 	// StatusIn makes sure the entries returned by the query have any of the status
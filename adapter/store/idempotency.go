@@ -0,0 +1,75 @@
+package store
+
+import (
+	"time"
+)
+
+/*
+Deduplicate returns the events of a queue to insert given their idempotency key,
+and the duplicates found along the ID of their original event. An event is a
+duplicate when an event of the same tenant and source having the same key has
+been received after the instant passed, either in the store or earlier in the
+queue. lookup returns the ID of the latest such event in the store, or an empty
+string if there is none.
+
+Drivers shall call it within AddEvents, while holding the lock or the transaction
+used for inserting the events, so concurrent duplicates are detected as well.
+Duplicates are not inserted, neither are their jobs. Sub-events of a duplicate are
+related to its original event instead: such events are copied so the queue passed
+is left untouched.
+*/
+func Deduplicate(events []*Event, since time.Time, lookup func(*Event) (string, error)) ([]*Event, map[*Event]string, error) {
+	type idempotency struct {
+		tenant string
+		source string
+		key    string
+	}
+
+	seen := map[idempotency]string{}
+	duplicates := map[*Event]string{}
+	originals := map[string]string{}
+	for _, e := range events {
+		if e.IdempotencyKey == "" {
+			continue
+		}
+
+		k := idempotency{e.Tenant, e.Source, e.IdempotencyKey}
+		original := seen[k]
+		if original == "" {
+			id, err := lookup(e)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			original = id
+		}
+
+		if original != "" {
+			duplicates[e] = original
+			originals[e.ID] = original
+			continue
+		}
+
+		if e.ReceivedAt.After(since) {
+			seen[k] = e.ID
+		}
+	}
+
+	insert := []*Event{}
+	for _, e := range events {
+		if _, ok := duplicates[e]; ok {
+			continue
+		}
+
+		if e.ParentEventID != nil && originals[*e.ParentEventID] != "" {
+			sub := *e
+			parent := originals[*e.ParentEventID]
+			sub.ParentEventID = &parent
+			e = &sub
+		}
+
+		insert = append(insert, e)
+	}
+
+	return insert, duplicates, nil
+}
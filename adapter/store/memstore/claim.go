@@ -0,0 +1,190 @@
+package memstore
+
+import (
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"github.com/segmentio/ksuid"
+)
+
+/*
+ClaimJobs moves "awaiting" jobs matching the constraints to "executing" on behalf
+of the owner, with a lease of the given duration. Jobs having a NotBefore in the
+future are not claimed. At most Limit jobs are claimed, by descending priority and
+then in chronological order. Since the write lock is held while claiming, a job can
+never be claimed twice.
+*/
+func (s *Store) ClaimJobs(tk *store.Toolkit, where *store.WhereEvents, owner string, lease time.Duration) ([]*store.Job, error) {
+	if validations := store.ValidateClaim(owner, lease); len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  400,
+			Message:     "store/memory: Failed to claim jobs",
+			Validations: validations,
+		}
+	}
+
+	where = tk.Scope(where)
+	if err := s.validate(where); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	matched := []*store.Job{}
+	for _, j := range s.jobs {
+		latest := s.latest(j.ID)
+		if latest == nil || latest.StateAfter != store.StatusAwaiting {
+			continue
+		}
+
+		if j.NotBefore != nil && j.NotBefore.After(now) {
+			continue
+		}
+
+		if s.matchJob(j, where) {
+			matched = append(matched, j)
+		}
+	}
+
+	sortByPriority(matched)
+	limit := applied(where).Limit
+	if uint64(len(matched)) > limit {
+		matched = matched[:limit]
+	}
+
+	// Decrypt the payloads before claiming any job, so the store is left untouched
+	// if an error occurred.
+	jobs := []*store.Job{}
+	for _, j := range matched {
+		job, err := s.openJob(j)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	expires := now.Add(lease)
+	transitions := []*store.Transition{}
+	for i, j := range matched {
+		latest := s.latest(j.ID)
+		before := latest.StateAfter
+		created := now
+		if created.Before(latest.CreatedAt) {
+			created = latest.CreatedAt
+		}
+
+		t := &store.Transition{
+			ID:             ksuid.New().String(),
+			Attempt:        latest.Attempt + 1,
+			StateBefore:    &before,
+			StateAfter:     store.StatusExecuting,
+			Owner:          owner,
+			LeaseExpiresAt: &expires,
+			CreatedAt:      created,
+			EventID:        j.EventID,
+			JobID:          j.ID,
+		}
+
+		s.insertTransition(t, now)
+		transitions = append(transitions, t)
+		jobs[i].Transitions[0] = copyTransition(t)
+	}
+
+	s.notifier.NotifyTransitions(transitions, s.tenantsOf(transitions))
+	return jobs, nil
+}
+
+/*
+ExtendLease postpones the lease of a job claimed by the owner, so it expires once
+the duration has elapsed. The lease is updated on the latest transition of the
+job, which keeps the history of the job untouched.
+*/
+func (s *Store) ExtendLease(tk *store.Toolkit, jobID string, owner string, lease time.Duration) (*store.Transition, error) {
+	if validations := store.ValidateClaim(owner, lease); len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  400,
+			Message:     "store/memory: Failed to extend lease",
+			Validations: validations,
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	j := s.jobs[jobID]
+	if j == nil || !tk.Owns(j.Tenant) {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/memory: Job not found",
+		}
+	}
+
+	now := time.Now().UTC()
+	latest := s.latest(jobID)
+	if validations := store.ValidateOwnership(latest, owner, now); len(validations) > 0 {
+		return nil, &errors.Error{
+			StatusCode:  409,
+			Message:     "store/memory: Failed to extend lease",
+			Validations: validations,
+		}
+	}
+
+	expires := now.Add(lease)
+	latest.LeaseExpiresAt = &expires
+	return copyTransition(latest), nil
+}
+
+/*
+ExpireLeases inserts a new "awaiting" transition for every "executing" jobs whose
+lease has expired. Jobs are brought back in chronological order.
+*/
+func (s *Store) ExpireLeases(tk *store.Toolkit) ([]*store.Transition, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	expired := []*store.Job{}
+	for _, j := range s.jobs {
+		latest := s.latest(j.ID)
+		if latest == nil || latest.StateAfter != store.StatusExecuting || !tk.Owns(j.Tenant) {
+			continue
+		}
+
+		if latest.LeaseExpiresAt != nil && !latest.LeaseExpiresAt.After(now) {
+			expired = append(expired, j)
+		}
+	}
+
+	sortJobs(expired)
+	transitions := []*store.Transition{}
+	for _, j := range expired {
+		latest := s.latest(j.ID)
+		before := latest.StateAfter
+		created := now
+		if created.Before(latest.CreatedAt) {
+			created = latest.CreatedAt
+		}
+
+		t := &store.Transition{
+			ID:          ksuid.New().String(),
+			Attempt:     latest.Attempt,
+			StateBefore: &before,
+			StateAfter:  store.StatusAwaiting,
+			Error:       store.LeaseExpired(latest.Owner),
+			CreatedAt:   created,
+			EventID:     j.EventID,
+			JobID:       j.ID,
+		}
+
+		s.insertTransition(t, now)
+		transitions = append(transitions, copyTransition(t))
+	}
+
+	s.notifier.NotifyTransitions(transitions, s.tenantsOf(transitions))
+	return transitions, nil
+}
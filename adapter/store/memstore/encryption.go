@@ -0,0 +1,117 @@
+package memstore
+
+import (
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+seal returns the context and data to keep in memory, encrypted with the encryption
+set in the options if any.
+*/
+func (s *Store) seal(context []byte, data []byte) ([]byte, []byte, error) {
+	context, err := store.Seal(s.options.Encryption, context)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err = store.Seal(s.options.Encryption, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return context, data, nil
+}
+
+/*
+unseal returns the context and data kept in memory, decrypted with the encryption
+set in the options if they are encrypted. Errors are returned as a 500 error of
+the store.
+*/
+func (s *Store) unseal(context []byte, data []byte) ([]byte, []byte, error) {
+	context, err := store.Unseal(s.options.Encryption, context)
+	if err == nil {
+		data, err = store.Unseal(s.options.Encryption, data)
+	}
+
+	if err != nil {
+		return nil, nil, &errors.Error{
+			Message: "store/memory: Failed to decrypt payloads",
+			Validations: []errors.Validation{
+				{
+					Message: err.Error(),
+				},
+			},
+		}
+	}
+
+	return context, data, nil
+}
+
+/*
+Reencrypt encrypts the context and data of every events and jobs with the current
+key of the encryption set in the options. The store is locked during the whole
+operation. Since entries already encrypted with the current key are left untouched,
+it can safely be run again if an error occurred.
+*/
+func (s *Store) Reencrypt(tk *store.Toolkit) (uint64, error) {
+	fail := &errors.Error{
+		Message:     "store/memory: Failed to re-encrypt entries",
+		Validations: []errors.Validation{},
+	}
+
+	if s.options.Encryption == nil {
+		fail.StatusCode = 400
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Encryption must be set",
+			Path:    []string{"Options", "Store", "Encryption"},
+		})
+
+		return 0, fail
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var count uint64
+	reseal := func(context *[]byte, data *[]byte) error {
+		c, contextChanged, err := store.Reseal(s.options.Encryption, *context)
+		if err != nil {
+			return err
+		}
+
+		d, dataChanged, err := store.Reseal(s.options.Encryption, *data)
+		if err != nil {
+			return err
+		}
+
+		if contextChanged || dataChanged {
+			*context, *data = c, d
+			count++
+		}
+
+		return nil
+	}
+
+	for _, e := range s.events {
+		if err := reseal(&e.Context, &e.Data); err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: err.Error(),
+			})
+
+			return count, fail
+		}
+	}
+
+	for _, j := range s.jobs {
+		if err := reseal(&j.Context, &j.Data); err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: err.Error(),
+			})
+
+			return count, fail
+		}
+	}
+
+	return count, nil
+}
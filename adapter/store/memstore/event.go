@@ -0,0 +1,249 @@
+package memstore
+
+import (
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+	"github.com/nunchistudio/blacksmith/helper/rest"
+)
+
+/*
+AddEvents inserts a queue of events into the store, including their jobs and the
+jobs' transitions if any. Either every entries are inserted, or none are. Duplicate
+events are detected while holding the write lock, so they are never inserted twice.
+*/
+func (s *Store) AddEvents(tk *store.Toolkit, queue []*store.Event) error {
+	fail := &errors.Error{
+		Message:     "store/memory: Failed to add events",
+		Validations: []errors.Validation{},
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	since := time.Now().UTC().Add(-s.options.IdempotencyWindow)
+	events, duplicates, err := store.Deduplicate(queue, since, func(e *store.Event) (string, error) {
+		original := s.findByIdempotencyKey(e.Tenant, e.Source, e.IdempotencyKey, since)
+
+		if original == nil {
+			return "", nil
+		}
+
+		return original.ID, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Make sure every entries can be inserted before inserting any of them. Parent
+	// events can be part of the same queue.
+	batch := map[string]*store.Event{}
+	for _, e := range events {
+		if e.ID == "" || s.events[e.ID] != nil || batch[e.ID] != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: "Event ID must be unique and not empty",
+				Path:    []string{"Event", e.ID, "ID"},
+			})
+		}
+
+		if !tk.Owns(e.Tenant) {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: "Event must belong to the tenant of the toolkit",
+				Path:    []string{"Event", e.ID, "Tenant"},
+			})
+		}
+
+		batch[e.ID] = e
+	}
+
+	// Jobs are always related to the event they are part of, and sub-events must
+	// belong to the tenant of their parent event.
+	jobs := []*store.Job{}
+	for _, e := range events {
+		if e.ParentEventID != nil {
+			parent := s.events[*e.ParentEventID]
+			if parent == nil {
+				parent = batch[*e.ParentEventID]
+			}
+
+			if parent == nil || !tk.Owns(parent.Tenant) {
+				fail.Validations = append(fail.Validations, errors.Validation{
+					Message: "Parent event does not exist",
+					Path:    []string{"Event", e.ID, "ParentEventID"},
+				})
+			} else if parent.Tenant != e.Tenant {
+				fail.Validations = append(fail.Validations, errors.Validation{
+					Message: "Parent event must belong to the same tenant",
+					Path:    []string{"Event", e.ID, "ParentEventID"},
+				})
+			}
+		}
+
+		for _, j := range e.Jobs {
+			job := *j
+			job.EventID = e.ID
+			jobs = append(jobs, &job)
+		}
+	}
+
+	fail.Validations = append(fail.Validations, s.validateJobs(tk, jobs, batch)...)
+	if len(fail.Validations) > 0 {
+		fail.StatusCode = 400
+		return fail
+	}
+
+	// Encrypt the payloads before inserting any entry, so the store is left
+	// untouched if an error occurred.
+	entries := []*store.Event{}
+	for _, e := range events {
+		entry := copyEvent(e)
+		context, data, err := s.seal(entry.Context, entry.Data)
+		if err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: err.Error(),
+			})
+
+			return fail
+		}
+
+		entry.Context, entry.Data = context, data
+		entries = append(entries, entry)
+	}
+
+	jobs, err = s.sealJobs(jobs)
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return fail
+	}
+
+	// Insert the events along their jobs and transitions.
+	now := time.Now().UTC()
+	for _, entry := range entries {
+		entry.IngestedAt = &now
+		s.events[entry.ID] = entry
+	}
+
+	for _, j := range jobs {
+		s.insertJob(j, now)
+	}
+
+	for e, id := range duplicates {
+		e.ID = id
+	}
+
+	s.notifier.NotifyEvents(events)
+	return nil
+}
+
+/*
+FindEvent returns an event given its ID, including its jobs with their latest
+transition.
+*/
+func (s *Store) FindEvent(tk *store.Toolkit, id string) (*store.Event, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	e := s.events[id]
+	if e == nil || !tk.Owns(e.Tenant) {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/memory: Event not found",
+		}
+	}
+
+	return s.withJobs(e)
+}
+
+/*
+FindEventByIdempotencyKey returns the latest event of a tenant and source having
+the key, received within the idempotency window. It returns a 404 error if there
+is none.
+*/
+func (s *Store) FindEventByIdempotencyKey(tk *store.Toolkit, tenant string, source string, key string) (*store.Event, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var found *store.Event
+	if tk.Owns(tenant) {
+		since := time.Now().UTC().Add(-s.options.IdempotencyWindow)
+		found = s.findByIdempotencyKey(tenant, source, key, since)
+	}
+
+	if found == nil {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/memory: Event not found",
+		}
+	}
+
+	return s.withJobs(found)
+}
+
+/*
+findByIdempotencyKey returns the latest event of a tenant and source having the
+key, received after the instant passed. It returns nil if there is none. It must
+be called with the lock held.
+*/
+func (s *Store) findByIdempotencyKey(tenant string, source string, key string, since time.Time) *store.Event {
+	var found *store.Event
+	for _, e := range s.events {
+		if key == "" || e.Tenant != tenant || e.Source != source || e.IdempotencyKey != key || !e.ReceivedAt.After(since) {
+			continue
+		}
+
+		if found == nil || (rest.Cursor{At: found.ReceivedAt, ID: found.ID}).Before(rest.Cursor{At: e.ReceivedAt, ID: e.ID}) {
+			found = e
+		}
+	}
+
+	return found
+}
+
+/*
+FindEvents returns a list of events matching the constraints, including their
+jobs with their latest transition.
+*/
+func (s *Store) FindEvents(tk *store.Toolkit, where *store.WhereEvents) ([]*store.Event, *store.Meta, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	where = applied(tk.Scope(where))
+	if err := s.validate(where); err != nil {
+		return nil, nil, err
+	}
+
+	matched := []*store.Event{}
+	for _, e := range s.events {
+		if s.matchEventWithJobs(e, where) {
+			matched = append(matched, e)
+		}
+	}
+
+	sortEvents(matched)
+	keys := []rest.Cursor{}
+	for _, e := range matched {
+		keys = append(keys, rest.Cursor{At: e.ReceivedAt, ID: e.ID})
+	}
+
+	start, end, err := paginate(keys, where)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := []*store.Event{}
+	for _, e := range matched[start:end] {
+		event, err := s.withJobs(e)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, metaOf(keys, start, end, where), nil
+}
@@ -0,0 +1,284 @@
+package memstore
+
+import (
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+batch returns a copy of the constraints to use for an iteration. Offset and cursors
+are removed, and the limit is set to the default one, which is the size of every
+batch.
+*/
+func batch(where *store.WhereEvents) *store.WhereEvents {
+	out := applied(where)
+	out.Offset = 0
+	out.After = ""
+	out.Before = ""
+	out.Limit = DefaultLimit
+
+	return out
+}
+
+/*
+batches splits IDs in batches of at most limit IDs, and calls fn for every batch
+until it returns an error.
+*/
+func batches(ids []string, limit uint64, fn func([]string) error) error {
+	for len(ids) > 0 {
+		size := len(ids)
+		if uint64(size) > limit {
+			size = int(limit)
+		}
+
+		if err := fn(ids[:size]); err != nil {
+			return err
+		}
+
+		ids = ids[size:]
+	}
+
+	return nil
+}
+
+/*
+IterateEvents calls fn for every events matching the constraints. The events are
+sorted once when the iteration starts, and then retrieved by batches so the store
+is not locked while fn is running, allowing fn to write into the store. Events
+added once the iteration has started are not visited, and events deleted or no
+longer matching the constraints are skipped.
+*/
+func (s *Store) IterateEvents(tk *store.Toolkit, where *store.WhereEvents, fn func(*store.Event) error) error {
+	where = batch(tk.Scope(where))
+	ids, err := s.matchingEvents(where)
+	if err != nil {
+		return err
+	}
+
+	return batches(ids, where.Limit, func(ids []string) error {
+		events, err := s.batchOfEvents(ids, where)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range events {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+matchingEvents returns the IDs of the events matching the constraints, sorted in
+chronological order.
+*/
+func (s *Store) matchingEvents(where *store.WhereEvents) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if err := s.validate(where); err != nil {
+		return nil, err
+	}
+
+	matched := []*store.Event{}
+	for _, e := range s.events {
+		if s.matchEventWithJobs(e, where) {
+			matched = append(matched, e)
+		}
+	}
+
+	sortEvents(matched)
+	ids := []string{}
+	for _, e := range matched {
+		ids = append(ids, e.ID)
+	}
+
+	return ids, nil
+}
+
+/*
+batchOfEvents returns the events given their IDs, including their jobs with their
+latest transition. Events deleted or no longer matching the constraints are
+skipped.
+*/
+func (s *Store) batchOfEvents(ids []string, where *store.WhereEvents) ([]*store.Event, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	events := []*store.Event{}
+	for _, id := range ids {
+		e := s.events[id]
+		if e == nil || !s.matchEventWithJobs(e, where) {
+			continue
+		}
+
+		event, err := s.withJobs(e)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+/*
+IterateJobs calls fn for every jobs matching the constraints. The jobs are sorted
+once when the iteration starts, and then retrieved by batches so the store is not
+locked while fn is running, allowing fn to write into the store. Jobs added once
+the iteration has started are not visited, and jobs deleted or no longer matching
+the constraints are skipped.
+*/
+func (s *Store) IterateJobs(tk *store.Toolkit, where *store.WhereEvents, fn func(*store.Job) error) error {
+	where = batch(tk.Scope(where))
+	ids, err := s.matchingJobs(where)
+	if err != nil {
+		return err
+	}
+
+	return batches(ids, where.Limit, func(ids []string) error {
+		jobs, err := s.batchOfJobs(ids, where)
+		if err != nil {
+			return err
+		}
+
+		for _, j := range jobs {
+			if err := fn(j); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+matchingJobs returns the IDs of the jobs matching the constraints, sorted in
+chronological order.
+*/
+func (s *Store) matchingJobs(where *store.WhereEvents) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if err := s.validate(where); err != nil {
+		return nil, err
+	}
+
+	matched := []*store.Job{}
+	for _, j := range s.jobs {
+		if s.matchJob(j, where) {
+			matched = append(matched, j)
+		}
+	}
+
+	sortJobs(matched)
+	ids := []string{}
+	for _, j := range matched {
+		ids = append(ids, j.ID)
+	}
+
+	return ids, nil
+}
+
+/*
+batchOfJobs returns the jobs given their IDs, including their latest transition.
+Jobs deleted or no longer matching the constraints are skipped.
+*/
+func (s *Store) batchOfJobs(ids []string, where *store.WhereEvents) ([]*store.Job, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	jobs := []*store.Job{}
+	for _, id := range ids {
+		j := s.jobs[id]
+		if j == nil || !s.matchJob(j, where) {
+			continue
+		}
+
+		job, err := s.withLatest(j)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+/*
+IterateTransitions calls fn for every transitions matching the constraints. The
+transitions are sorted once when the iteration starts, and then retrieved by
+batches so the store is not locked while fn is running, allowing fn to write into
+the store. Transitions added once the iteration has started are not visited, and
+transitions deleted or no longer matching the constraints are skipped.
+*/
+func (s *Store) IterateTransitions(tk *store.Toolkit, where *store.WhereEvents, fn func(*store.Transition) error) error {
+	where = batch(tk.Scope(where))
+	ids, err := s.matchingTransitions(where)
+	if err != nil {
+		return err
+	}
+
+	return batches(ids, where.Limit, func(ids []string) error {
+		for _, t := range s.batchOfTransitions(ids, where) {
+			if err := fn(t); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+matchingTransitions returns the IDs of the transitions matching the constraints,
+sorted in chronological order.
+*/
+func (s *Store) matchingTransitions(where *store.WhereEvents) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if err := s.validate(where); err != nil {
+		return nil, err
+	}
+
+	matched := []*store.Transition{}
+	for _, t := range s.transitions {
+		if s.matchTransition(t, where) {
+			matched = append(matched, t)
+		}
+	}
+
+	sortTransitions(matched)
+	ids := []string{}
+	for _, t := range matched {
+		ids = append(ids, t.ID)
+	}
+
+	return ids, nil
+}
+
+/*
+batchOfTransitions returns the transitions given their IDs. Transitions deleted
+or no longer matching the constraints are skipped.
+*/
+func (s *Store) batchOfTransitions(ids []string, where *store.WhereEvents) []*store.Transition {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	transitions := []*store.Transition{}
+	for _, id := range ids {
+		t := s.transitions[id]
+		if t == nil || !s.matchTransition(t, where) {
+			continue
+		}
+
+		transitions = append(transitions, copyTransition(t))
+	}
+
+	return transitions
+}
@@ -0,0 +1,260 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+	"github.com/nunchistudio/blacksmith/helper/rest"
+)
+
+/*
+AddJobs inserts a list of jobs into the store, including their transition if
+any. Either every entries are inserted, or none are.
+*/
+func (s *Store) AddJobs(tk *store.Toolkit, jobs []*store.Job) error {
+	fail := &errors.Error{
+		Message:     "store/memory: Failed to add jobs",
+		Validations: []errors.Validation{},
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fail.Validations = append(fail.Validations, s.validateJobs(tk, jobs, nil)...)
+	if len(fail.Validations) > 0 {
+		fail.StatusCode = 400
+		return fail
+	}
+
+	jobs, err := s.sealJobs(jobs)
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return fail
+	}
+
+	now := time.Now().UTC()
+	inserted := []*store.Job{}
+	for _, j := range jobs {
+		inserted = append(inserted, s.insertJob(j, now))
+	}
+
+	s.notifier.NotifyJobs(inserted)
+	return nil
+}
+
+/*
+FindJob returns a job given its ID, including its latest transition.
+*/
+func (s *Store) FindJob(tk *store.Toolkit, id string) (*store.Job, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	j := s.jobs[id]
+	if j == nil || !tk.Owns(j.Tenant) {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/memory: Job not found",
+		}
+	}
+
+	return s.withLatest(j)
+}
+
+/*
+FindJobHistory returns a job given its ID, including its latest transition and
+every transitions in chronological order. Transitions created at the same instant
+are kept in insertion order.
+*/
+func (s *Store) FindJobHistory(tk *store.Toolkit, id string) (*store.Job, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	j := s.jobs[id]
+	if j == nil || !tk.Owns(j.Tenant) {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/memory: Job not found",
+		}
+	}
+
+	out, err := s.withLatest(j)
+	if err != nil {
+		return nil, err
+	}
+
+	out.History = []*store.Transition{}
+	for _, tid := range s.transitionsOf[id] {
+		out.History = append(out.History, copyTransition(s.transitions[tid]))
+	}
+
+	sort.SliceStable(out.History, func(a, b int) bool {
+		return out.History[a].CreatedAt.Before(out.History[b].CreatedAt)
+	})
+
+	return out, nil
+}
+
+/*
+FindJobs returns a list of jobs matching the constraints, including their latest
+transition.
+*/
+func (s *Store) FindJobs(tk *store.Toolkit, where *store.WhereEvents) ([]*store.Job, *store.Meta, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	where = applied(tk.Scope(where))
+	if err := s.validate(where); err != nil {
+		return nil, nil, err
+	}
+
+	matched := []*store.Job{}
+	for _, j := range s.jobs {
+		if s.matchJob(j, where) {
+			matched = append(matched, j)
+		}
+	}
+
+	sortJobs(matched)
+	keys := []rest.Cursor{}
+	for _, j := range matched {
+		keys = append(keys, rest.Cursor{At: j.CreatedAt, ID: j.ID})
+	}
+
+	start, end, err := paginate(keys, where)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jobs := []*store.Job{}
+	for _, j := range matched[start:end] {
+		job, err := s.withLatest(j)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, metaOf(keys, start, end, where), nil
+}
+
+/*
+validateJobs returns the validation errors of jobs about to be inserted. events
+holds the events being inserted in the same batch, if any. Jobs must be related
+to an event within the scope of the toolkit, and child jobs must belong to the
+tenant of their parent job. It must be called with the lock held.
+*/
+func (s *Store) validateJobs(tk *store.Toolkit, jobs []*store.Job, events map[string]*store.Event) []errors.Validation {
+	validations := []errors.Validation{}
+	tenants := map[string]string{}
+	transitions := map[string]bool{}
+	for _, j := range jobs {
+		if _, exists := tenants[j.ID]; j.ID == "" || s.jobs[j.ID] != nil || exists {
+			validations = append(validations, errors.Validation{
+				Message: "Job ID must be unique and not empty",
+				Path:    []string{"Job", j.ID, "ID"},
+			})
+		}
+
+		e := s.events[j.EventID]
+		if e == nil {
+			e = events[j.EventID]
+		}
+
+		if e == nil || !tk.Owns(e.Tenant) {
+			validations = append(validations, errors.Validation{
+				Message: "Event does not exist",
+				Path:    []string{"Job", j.ID, "EventID"},
+			})
+
+			tenants[j.ID] = tk.Tenant
+			continue
+		}
+
+		tenants[j.ID] = e.Tenant
+	}
+
+	for _, j := range jobs {
+		if j.ParentJobID != nil {
+			tenant, exists := tenants[*j.ParentJobID]
+			if parent := s.jobs[*j.ParentJobID]; parent != nil {
+				tenant, exists = parent.Tenant, tk.Owns(parent.Tenant)
+			}
+
+			if !exists {
+				validations = append(validations, errors.Validation{
+					Message: "Parent job does not exist",
+					Path:    []string{"Job", j.ID, "ParentJobID"},
+				})
+			} else if tenant != tenants[j.ID] {
+				validations = append(validations, errors.Validation{
+					Message: "Parent job must belong to the same tenant",
+					Path:    []string{"Job", j.ID, "ParentJobID"},
+				})
+			}
+		}
+
+		if t := j.Transitions[0]; t != nil {
+			if t.ID == "" || s.transitions[t.ID] != nil || transitions[t.ID] {
+				validations = append(validations, errors.Validation{
+					Message: "Transition ID must be unique and not empty",
+					Path:    []string{"Job", j.ID, "Transitions", "0", "ID"},
+				})
+			}
+
+			transitions[t.ID] = true
+		}
+	}
+
+	return validations
+}
+
+/*
+sealJobs returns a copy of the jobs with their payloads encrypted, ready to be
+inserted.
+*/
+func (s *Store) sealJobs(jobs []*store.Job) ([]*store.Job, error) {
+	sealed := []*store.Job{}
+	for _, j := range jobs {
+		job := *j
+		context, data, err := s.seal(j.Context, j.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		job.Context, job.Data = context, data
+		sealed = append(sealed, &job)
+	}
+
+	return sealed, nil
+}
+
+/*
+insertJob inserts a job and its transition if any. Timestamps not set are set to
+now, and the tenant is set from the job's event, which must exist. It returns the
+job inserted. It must be called with the write lock held.
+*/
+func (s *Store) insertJob(j *store.Job, now time.Time) *store.Job {
+	entry := copyJob(j)
+	entry.Tenant = s.events[j.EventID].Tenant
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = now
+	}
+
+	s.jobs[j.ID] = entry
+	s.jobsOf[j.EventID] = append(s.jobsOf[j.EventID], j.ID)
+
+	if t := j.Transitions[0]; t != nil {
+		transition := copyTransition(t)
+		transition.EventID = j.EventID
+		transition.JobID = j.ID
+		s.insertTransition(transition, now)
+	}
+
+	return entry
+}
@@ -0,0 +1,258 @@
+package memstore
+
+import (
+	"sync"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+DefaultLimit is the limit applied to queries when none is set in the constraints.
+*/
+var DefaultLimit uint64 = 100
+
+/*
+Store implements the store.Store interface by keeping every entries in memory.
+It is safe for concurrent use.
+*/
+type Store struct {
+
+	// options are the options originally passed when creating the store.
+	options *store.Options
+
+	// mutex protects the entries below from concurrent reads and writes.
+	mutex sync.RWMutex
+
+	// events, jobs, and transitions hold the entries of the store indexed by their
+	// ID. Events do not hold their jobs and jobs do not hold their transitions:
+	// relations are resolved at query time.
+	events      map[string]*store.Event
+	jobs        map[string]*store.Job
+	transitions map[string]*store.Transition
+
+	// jobsOf holds the job IDs of each event, and transitionsOf holds the transition
+	// IDs of each job. Both are kept in insertion order.
+	jobsOf        map[string][]string
+	transitionsOf map[string][]string
+
+	// notifier dispatches notifications to the watchers of the store.
+	notifier store.Notifier
+}
+
+/*
+New returns a new in-memory store. The options' driver is always overridden to
+store.DriverMemory.
+*/
+func New(opts *store.Options) (*Store, error) {
+	if opts == nil {
+		opts = &store.Options{}
+	}
+
+	if opts.PurgePolicies == nil {
+		opts.PurgePolicies = store.Defaults.PurgePolicies
+	}
+
+	if opts.IdempotencyWindow == 0 {
+		opts.IdempotencyWindow = store.Defaults.IdempotencyWindow
+	}
+
+	opts.From = store.DriverMemory
+	s := &Store{
+		options:     opts,
+		events:      map[string]*store.Event{},
+		jobs:        map[string]*store.Job{},
+		transitions: map[string]*store.Transition{},
+
+		jobsOf:        map[string][]string{},
+		transitionsOf: map[string][]string{},
+	}
+
+	return s, nil
+}
+
+/*
+String returns the string representation of the adapter.
+*/
+func (s *Store) String() string {
+	return string(store.DriverMemory)
+}
+
+/*
+Options returns the options originally passed when creating the store.
+*/
+func (s *Store) Options() *store.Options {
+	return s.options
+}
+
+/*
+latest returns the latest transition of a job, or nil if the job has none. When
+several transitions are created at the same instant, the last one inserted wins.
+It must be called with the lock held.
+*/
+func (s *Store) latest(jobID string) *store.Transition {
+	var last *store.Transition
+	for _, id := range s.transitionsOf[jobID] {
+		t := s.transitions[id]
+		if last == nil || !t.CreatedAt.Before(last.CreatedAt) {
+			last = t
+		}
+	}
+
+	return last
+}
+
+/*
+withJobs returns a copy of an event including its jobs, each one having its latest
+transition. Payloads are decrypted. It must be called with the lock held.
+*/
+func (s *Store) withJobs(e *store.Event) (*store.Event, error) {
+	out, err := s.openEvent(e)
+	if err != nil {
+		return nil, err
+	}
+
+	out.Jobs = []*store.Job{}
+	for _, j := range s.jobsOfEvent(e.ID) {
+		job, err := s.withLatest(j)
+		if err != nil {
+			return nil, err
+		}
+
+		out.Jobs = append(out.Jobs, job)
+	}
+
+	return out, nil
+}
+
+/*
+withLatest returns a copy of a job including its latest transition. Payloads are
+decrypted. It must be called with the lock held.
+*/
+func (s *Store) withLatest(j *store.Job) (*store.Job, error) {
+	out, err := s.openJob(j)
+	if err != nil {
+		return nil, err
+	}
+
+	if t := s.latest(j.ID); t != nil {
+		out.Transitions[0] = copyTransition(t)
+	}
+
+	return out, nil
+}
+
+/*
+openEvent returns a copy of an event, without its jobs, with its payloads
+decrypted.
+*/
+func (s *Store) openEvent(e *store.Event) (*store.Event, error) {
+	out := copyEvent(e)
+	context, data, err := s.unseal(out.Context, out.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	out.Context, out.Data = context, data
+	return out, nil
+}
+
+/*
+openJob returns a copy of a job, without its transitions nor its history, with
+its payloads decrypted.
+*/
+func (s *Store) openJob(j *store.Job) (*store.Job, error) {
+	out := copyJob(j)
+	context, data, err := s.unseal(out.Context, out.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	out.Context, out.Data = context, data
+	return out, nil
+}
+
+/*
+copyEvent returns a deep copy of an event, without its jobs.
+*/
+func copyEvent(e *store.Event) *store.Event {
+	out := *e
+	out.Context = copyBytes(e.Context)
+	out.Data = copyBytes(e.Data)
+	out.Jobs = nil
+	if e.SentAt != nil {
+		sent := *e.SentAt
+		out.SentAt = &sent
+	}
+
+	if e.IngestedAt != nil {
+		ingested := *e.IngestedAt
+		out.IngestedAt = &ingested
+	}
+
+	if e.ParentEventID != nil {
+		parent := *e.ParentEventID
+		out.ParentEventID = &parent
+	}
+
+	return &out
+}
+
+/*
+copyJob returns a deep copy of a job, without its transitions nor its history.
+*/
+func copyJob(j *store.Job) *store.Job {
+	out := *j
+	out.Context = copyBytes(j.Context)
+	out.Data = copyBytes(j.Data)
+	out.Transitions = [1]*store.Transition{}
+	out.History = nil
+	if j.NotBefore != nil {
+		notBefore := *j.NotBefore
+		out.NotBefore = &notBefore
+	}
+
+	if j.ParentJobID != nil {
+		parent := *j.ParentJobID
+		out.ParentJobID = &parent
+	}
+
+	return &out
+}
+
+/*
+copyTransition returns a deep copy of a transition.
+*/
+func copyTransition(t *store.Transition) *store.Transition {
+	out := *t
+	if t.StateBefore != nil {
+		before := *t.StateBefore
+		out.StateBefore = &before
+	}
+
+	if t.LeaseExpiresAt != nil {
+		expires := *t.LeaseExpiresAt
+		out.LeaseExpiresAt = &expires
+	}
+
+	if t.Error != nil {
+		fail := *t.Error
+		fail.Validations = append([]errors.Validation(nil), t.Error.Validations...)
+		out.Error = &fail
+	}
+
+	return &out
+}
+
+/*
+copyBytes returns a copy of a slice of bytes, or nil if the slice is nil.
+*/
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	out := make([]byte, len(b))
+	copy(out, b)
+	return out
+}
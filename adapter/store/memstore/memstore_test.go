@@ -0,0 +1,40 @@
+package memstore
+
+import (
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/adapter/store/storetest"
+)
+
+/*
+TestSuite runs the conformance test suite against the in-memory store.
+*/
+func TestSuite(t *testing.T) {
+	storetest.RunSuite(t, func(t *testing.T) store.Store {
+		s, err := New(nil)
+		if err != nil {
+			t.Fatalf("New: unexpected error: %v", err)
+		}
+
+		return s
+	})
+}
+
+/*
+TestEncryptionSuite runs the conformance test suite of encryption against the
+in-memory store.
+*/
+func TestEncryptionSuite(t *testing.T) {
+	storetest.RunEncryptionSuite(t, func(t *testing.T, enc store.Encryption) store.Store {
+		s, err := New(&store.Options{
+			Encryption: enc,
+		})
+
+		if err != nil {
+			t.Fatalf("New: unexpected error: %v", err)
+		}
+
+		return s
+	})
+}
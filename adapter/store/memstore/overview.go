@@ -0,0 +1,14 @@
+/*
+Package memstore provides an in-memory implementation of the store adapter. It
+keeps events, jobs, and transitions in the running process and applies the same
+constraints as every other store drivers, so it can be used for local development
+and unit tests without a running database.
+
+Entries are lost when the process stops. It shall not be used in production. Since
+entries are never persisted, the encryption set in the store's options is not
+applied.
+
+The store implements the store.Watcher interface, so tests can rely on
+notifications instead of polling.
+*/
+package memstore
@@ -0,0 +1,165 @@
+package memstore
+
+import (
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+Purge deletes every events matching the constraints, along their jobs and their
+transitions. Offset and limit are not applied. It returns the number of entries
+deleted. On a dry run, nothing is deleted.
+
+Like foreign keys with cascading deletes in SQL drivers, deleting an event also
+deletes its sub-events, and deleting a job also deletes its child jobs.
+*/
+func (s *Store) Purge(tk *store.Toolkit, where *store.WhereEvents, dryRun bool) (*store.Purged, error) {
+	where = tk.Scope(where)
+	if err := s.validate(where); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events, jobs, transitions := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, e := range s.events {
+		if s.matchEventWithJobs(e, where) {
+			s.cascadeEvent(e.ID, events, jobs, transitions)
+		}
+	}
+
+	purged := &store.Purged{
+		Events:      uint64(len(events)),
+		Jobs:        uint64(len(jobs)),
+		Transitions: uint64(len(transitions)),
+	}
+
+	if dryRun {
+		return purged, nil
+	}
+
+	s.remove(events, jobs, transitions)
+	return purged, nil
+}
+
+/*
+PurgeEntries deletes the events of the entries, along their sub-events, jobs, and
+transitions, only if every entries deleted in cascade are part of the entries. The
+store is locked during the whole operation, so entries added concurrently are
+never deleted. It returns the number of entries deleted.
+*/
+func (s *Store) PurgeEntries(tk *store.Toolkit, entries *store.Entries) (*store.Purged, error) {
+	purged := &store.Purged{}
+	if entries == nil {
+		return purged, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := entries.IDs()
+	for _, id := range entries.Events {
+		if e := s.events[id]; e == nil || !tk.Owns(e.Tenant) {
+			continue
+		}
+
+		events, jobs, transitions := map[string]bool{}, map[string]bool{}, map[string]bool{}
+		s.cascadeEvent(id, events, jobs, transitions)
+		if !covered(ids, events) || !covered(ids, jobs) || !covered(ids, transitions) {
+			continue
+		}
+
+		s.remove(events, jobs, transitions)
+		purged.Events += uint64(len(events))
+		purged.Jobs += uint64(len(jobs))
+		purged.Transitions += uint64(len(transitions))
+	}
+
+	return purged, nil
+}
+
+/*
+covered reports if every IDs of a cascade are part of the IDs passed.
+*/
+func covered(ids map[string]bool, cascade map[string]bool) bool {
+	for id := range cascade {
+		if !ids[id] {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+remove deletes the entries of a cascade. It must be called with the lock held.
+*/
+func (s *Store) remove(events map[string]bool, jobs map[string]bool, transitions map[string]bool) {
+	for id := range transitions {
+		delete(s.transitions, id)
+	}
+
+	for id := range jobs {
+		j := s.jobs[id]
+		delete(s.jobs, id)
+		delete(s.transitionsOf, id)
+
+		// Remove the job from its event, which is not deleted when the job is a
+		// child job of another event.
+		remaining := []string{}
+		for _, jobID := range s.jobsOf[j.EventID] {
+			if jobID != id {
+				remaining = append(remaining, jobID)
+			}
+		}
+
+		s.jobsOf[j.EventID] = remaining
+	}
+
+	for id := range events {
+		delete(s.events, id)
+		delete(s.jobsOf, id)
+	}
+}
+
+/*
+cascadeEvent adds an event, its sub-events, and their jobs to the entries to
+delete. It must be called with the lock held.
+*/
+func (s *Store) cascadeEvent(id string, events map[string]bool, jobs map[string]bool, transitions map[string]bool) {
+	if events[id] || s.events[id] == nil {
+		return
+	}
+
+	events[id] = true
+	for _, e := range s.events {
+		if e.ParentEventID != nil && *e.ParentEventID == id {
+			s.cascadeEvent(e.ID, events, jobs, transitions)
+		}
+	}
+
+	for _, jobID := range s.jobsOf[id] {
+		s.cascadeJob(jobID, jobs, transitions)
+	}
+}
+
+/*
+cascadeJob adds a job, its child jobs, and their transitions to the entries to
+delete. It must be called with the lock held.
+*/
+func (s *Store) cascadeJob(id string, jobs map[string]bool, transitions map[string]bool) {
+	if jobs[id] || s.jobs[id] == nil {
+		return
+	}
+
+	jobs[id] = true
+	for _, child := range s.jobs {
+		if child.ParentJobID != nil && *child.ParentJobID == id {
+			s.cascadeJob(child.ID, jobs, transitions)
+		}
+	}
+
+	for _, transitionID := range s.transitionsOf[id] {
+		transitions[transitionID] = true
+	}
+}
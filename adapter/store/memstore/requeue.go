@@ -0,0 +1,84 @@
+package memstore
+
+import (
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"github.com/segmentio/ksuid"
+)
+
+/*
+Requeue inserts a new "awaiting" transition for every jobs matching the constraints
+and having one of the store.RequeueStatuses. Offset, limit, and cursors are not
+applied. Jobs are requeued in chronological order. A transition is never created
+before the job's latest one, so it always becomes the job's latest transition.
+*/
+func (s *Store) Requeue(tk *store.Toolkit, where *store.WhereEvents, requeue *store.Requeue) ([]*store.Transition, error) {
+	if requeue == nil || requeue.TriggeredBy == "" {
+		return nil, &errors.Error{
+			StatusCode: 400,
+			Message:    "store/memory: Failed to requeue jobs",
+			Validations: []errors.Validation{
+				{
+					Message: "TriggeredBy must be set",
+					Path:    []string{"Requeue", "TriggeredBy"},
+				},
+			},
+		}
+	}
+
+	where = tk.Scope(where)
+	if err := s.validate(where); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	matched := []*store.Job{}
+	for _, j := range s.jobs {
+		latest := s.latest(j.ID)
+		if latest == nil || !contains(store.RequeueStatuses, latest.StateAfter) {
+			continue
+		}
+
+		if s.matchJob(j, where) {
+			matched = append(matched, j)
+		}
+	}
+
+	sortJobs(matched)
+	now := time.Now().UTC()
+	transitions := []*store.Transition{}
+	for _, j := range matched {
+		latest := s.latest(j.ID)
+		before := latest.StateAfter
+		created := now
+		if created.Before(latest.CreatedAt) {
+			created = latest.CreatedAt
+		}
+
+		t := &store.Transition{
+			ID:          ksuid.New().String(),
+			Attempt:     latest.Attempt,
+			StateBefore: &before,
+			StateAfter:  store.StatusAwaiting,
+			TriggeredBy: requeue.TriggeredBy,
+			CreatedAt:   created,
+			EventID:     j.EventID,
+			JobID:       j.ID,
+		}
+
+		if requeue.ResetAttempts {
+			t.Attempt = 0
+		}
+
+		s.insertTransition(t, now)
+		transitions = append(transitions, copyTransition(t))
+	}
+
+	s.notifier.NotifyTransitions(transitions, s.tenantsOf(transitions))
+	return transitions, nil
+}
@@ -0,0 +1,52 @@
+package memstore
+
+import (
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+Stats returns aggregates of the jobs matching the constraints, grouped by the
+dimensions and time buckets. Offset, limit, and cursors are not applied.
+*/
+func (s *Store) Stats(tk *store.Toolkit, where *store.WhereEvents, groupBy []store.Dimension, bucket time.Duration) ([]*store.Stat, error) {
+	where = tk.Scope(where)
+	if err := s.validate(where); err != nil {
+		return nil, err
+	}
+
+	aggregator, err := store.NewStatsAggregator(groupBy, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, j := range s.jobs {
+		if !s.matchJob(j, where) {
+			continue
+		}
+
+		e := s.events[j.EventID]
+		sample := &store.StatsSample{
+			Tenant:      j.Tenant,
+			Source:      e.Source,
+			Trigger:     e.Trigger,
+			Destination: j.Destination,
+			Action:      j.Action,
+			ReceivedAt:  e.ReceivedAt,
+			CreatedAt:   j.CreatedAt,
+		}
+
+		if latest := s.latest(j.ID); latest != nil {
+			sample.Status = latest.StateAfter
+			sample.UpdatedAt = latest.CreatedAt
+		}
+
+		aggregator.Add(sample)
+	}
+
+	return aggregator.Stats(), nil
+}
@@ -0,0 +1,180 @@
+package memstore
+
+import (
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+	"github.com/nunchistudio/blacksmith/helper/rest"
+)
+
+/*
+AddTransitions inserts a list of transitions into the store. The event ID of each
+transition is set from its job. Either every entries are inserted, or none are.
+Transitions on a job claimed with ClaimJobs must be made by its owner while the
+lease has not expired.
+*/
+func (s *Store) AddTransitions(tk *store.Toolkit, transitions []*store.Transition) error {
+	return s.addTransitions(tk, transitions, "store/memory: Failed to add transitions", true)
+}
+
+/*
+RestoreTransitions inserts a list of transitions into the store as part of the
+history of their job. The event ID of each transition is set from its job. Either
+every entries are inserted, or none are. Claims and leases are restored as is.
+*/
+func (s *Store) RestoreTransitions(tk *store.Toolkit, transitions []*store.Transition) error {
+	return s.addTransitions(tk, transitions, "store/memory: Failed to restore transitions", false)
+}
+
+/*
+addTransitions inserts a list of transitions into the store. Transitions are
+checked against the owner and lease of their job only if owned is true.
+*/
+func (s *Store) addTransitions(tk *store.Toolkit, transitions []*store.Transition, message string, owned bool) error {
+	fail := &errors.Error{
+		Message:     message,
+		Validations: []errors.Validation{},
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := map[string]bool{}
+	for _, t := range transitions {
+		if t.ID == "" || s.transitions[t.ID] != nil || ids[t.ID] {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: "Transition ID must be unique and not empty",
+				Path:    []string{"Transition", t.ID, "ID"},
+			})
+		}
+
+		if j := s.jobs[t.JobID]; j == nil || !tk.Owns(j.Tenant) {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: "Job does not exist",
+				Path:    []string{"Transition", t.ID, "JobID"},
+			})
+		}
+
+		ids[t.ID] = true
+	}
+
+	if len(fail.Validations) > 0 {
+		return fail
+	}
+
+	now := time.Now().UTC()
+	pending := map[string]*store.Transition{}
+	for _, t := range transitions {
+		if !owned {
+			continue
+		}
+
+		latest := pending[t.JobID]
+		if latest == nil {
+			latest = s.latest(t.JobID)
+		}
+
+		fail.Validations = append(fail.Validations, store.ValidateTransition(latest, t, now)...)
+		pending[t.JobID] = t
+	}
+
+	if len(fail.Validations) > 0 {
+		fail.StatusCode = 409
+		return fail
+	}
+
+	inserted := []*store.Transition{}
+	for _, t := range transitions {
+		transition := copyTransition(t)
+		transition.EventID = s.jobs[t.JobID].EventID
+		s.insertTransition(transition, now)
+		inserted = append(inserted, transition)
+	}
+
+	s.notifier.NotifyTransitions(inserted, s.tenantsOf(inserted))
+	return nil
+}
+
+/*
+tenantsOf returns the tenant of the job of every transitions, given the IDs of the
+jobs. It must be called with the lock held.
+*/
+func (s *Store) tenantsOf(transitions []*store.Transition) map[string]string {
+	tenants := map[string]string{}
+	for _, t := range transitions {
+		tenants[t.JobID] = s.jobs[t.JobID].Tenant
+	}
+
+	return tenants
+}
+
+/*
+FindTransition returns a transition given its ID.
+*/
+func (s *Store) FindTransition(tk *store.Toolkit, id string) (*store.Transition, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	t := s.transitions[id]
+	if t == nil || !tk.Owns(s.jobs[t.JobID].Tenant) {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/memory: Transition not found",
+		}
+	}
+
+	return copyTransition(t), nil
+}
+
+/*
+FindTransitions returns a list of transitions matching the constraints.
+*/
+func (s *Store) FindTransitions(tk *store.Toolkit, where *store.WhereEvents) ([]*store.Transition, *store.Meta, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	where = applied(tk.Scope(where))
+	if err := s.validate(where); err != nil {
+		return nil, nil, err
+	}
+
+	matched := []*store.Transition{}
+	for _, t := range s.transitions {
+		if s.matchTransition(t, where) {
+			matched = append(matched, t)
+		}
+	}
+
+	sortTransitions(matched)
+	keys := []rest.Cursor{}
+	for _, t := range matched {
+		keys = append(keys, rest.Cursor{At: t.CreatedAt, ID: t.ID})
+	}
+
+	start, end, err := paginate(keys, where)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transitions := []*store.Transition{}
+	for _, t := range matched[start:end] {
+		transitions = append(transitions, copyTransition(t))
+	}
+
+	return transitions, metaOf(keys, start, end, where), nil
+}
+
+/*
+insertTransition inserts a transition. Its creation date is set to now if not
+set. It must be called with the write lock held.
+*/
+func (s *Store) insertTransition(t *store.Transition, now time.Time) {
+	entry := copyTransition(t)
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = now
+	}
+
+	s.transitions[t.ID] = entry
+	s.transitionsOf[t.JobID] = append(s.transitionsOf[t.JobID], t.ID)
+}
@@ -0,0 +1,77 @@
+package memstore
+
+import (
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+FindEventTree returns the lineage of an event: the event, its sub-events, and all
+their jobs and child jobs with their latest transition, recursively.
+*/
+func (s *Store) FindEventTree(tk *store.Toolkit, id string) (*store.EventTree, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.events[id] == nil || !tk.Owns(s.events[id].Tenant) {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/memory: Event not found",
+		}
+	}
+
+	subEvents := map[string][]string{}
+	for _, e := range s.events {
+		if e.ParentEventID != nil {
+			subEvents[*e.ParentEventID] = append(subEvents[*e.ParentEventID], e.ID)
+		}
+	}
+
+	childJobs := map[string][]string{}
+	for _, j := range s.jobs {
+		if j.ParentJobID != nil {
+			childJobs[*j.ParentJobID] = append(childJobs[*j.ParentJobID], j.ID)
+		}
+	}
+
+	events := []*store.Event{}
+	visited := map[string]bool{id: true}
+	for queue := []string{id}; len(queue) > 0; queue = queue[1:] {
+		event, err := s.openEvent(s.events[queue[0]])
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+		for _, child := range subEvents[queue[0]] {
+			if !visited[child] {
+				visited[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	queue := []string{}
+	for _, e := range events {
+		queue = append(queue, s.jobsOf[e.ID]...)
+	}
+
+	jobs := []*store.Job{}
+	visited = map[string]bool{}
+	for ; len(queue) > 0; queue = queue[1:] {
+		if visited[queue[0]] {
+			continue
+		}
+
+		visited[queue[0]] = true
+		job, err := s.withLatest(s.jobs[queue[0]])
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+		queue = append(queue, childJobs[queue[0]]...)
+	}
+
+	return store.NewEventTree(id, events, jobs), nil
+}
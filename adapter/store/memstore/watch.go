@@ -0,0 +1,21 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+Watch implements the store.Watcher interface. It returns a channel receiving a
+notification for every entries added into the store until the context is done.
+Notifications are scoped to the tenant of the toolkit, if any.
+*/
+func (s *Store) Watch(ctx context.Context, tk *store.Toolkit) (<-chan *store.Notification, error) {
+	tenant := ""
+	if tk != nil {
+		tenant = tk.Tenant
+	}
+
+	return s.notifier.Watch(ctx, tenant), nil
+}
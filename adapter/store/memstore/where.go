@@ -0,0 +1,520 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+	"github.com/nunchistudio/blacksmith/helper/rest"
+)
+
+/*
+applied returns a copy of the constraints with the defaults applied, as they are
+returned in the query's meta.
+*/
+func applied(where *store.WhereEvents) *store.WhereEvents {
+	out := &store.WhereEvents{}
+	if where != nil {
+		*out = *where
+	}
+
+	if out.Limit == 0 {
+		out.Limit = DefaultLimit
+	}
+
+	return out
+}
+
+/*
+validate makes sure the constraints can be applied. Since payloads are kept
+encrypted, predicates can not be applied when an encryption is set, as with the
+other drivers.
+*/
+func (s *Store) validate(where *store.WhereEvents) error {
+	if err := where.Validate(); err != nil {
+		return err
+	}
+
+	if s.options.Encryption != nil && where.HasPredicates() {
+		return &errors.Error{
+			StatusCode: 400,
+			Message:    "store/memory: Failed to validate constraints",
+			Validations: []errors.Validation{
+				{
+					Message: "Predicates can not be applied on encrypted payloads",
+					Path:    []string{"WhereEvents", "Predicates"},
+				},
+			},
+		}
+	}
+
+	return nil
+}
+
+/*
+paginate returns the entries' indexes to keep given the constraints. keys are the
+cursors of the entries matching the constraints, in ascending order. When a cursor
+is set in the constraints, the offset is not applied.
+*/
+func paginate(keys []rest.Cursor, where *store.WhereEvents) (int, int, error) {
+	count := len(keys)
+	if where.After == "" && where.Before == "" {
+		start := int(where.Offset)
+		if uint64(start) != where.Offset || start > count {
+			start = count
+		}
+
+		end := count
+		if where.Limit < uint64(count-start) {
+			end = start + int(where.Limit)
+		}
+
+		return start, end, nil
+	}
+
+	lo, hi := 0, count
+	if where.After != "" {
+		after, err := rest.ParseCursor(where.After)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		lo = sort.Search(count, func(i int) bool {
+			return after.Before(keys[i])
+		})
+	}
+
+	if where.Before != "" {
+		before, err := rest.ParseCursor(where.Before)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		hi = sort.Search(count, func(i int) bool {
+			return !keys[i].Before(*before)
+		})
+	}
+
+	if hi < lo {
+		hi = lo
+	}
+
+	if where.After == "" {
+		start := lo
+		if where.Limit < uint64(hi-lo) {
+			start = hi - int(where.Limit)
+		}
+
+		return start, hi, nil
+	}
+
+	end := hi
+	if where.Limit < uint64(hi-lo) {
+		end = lo + int(where.Limit)
+	}
+
+	return lo, end, nil
+}
+
+/*
+metaOf returns the meta of a query given the cursors of the entries matching the
+constraints and the indexes of the entries returned.
+*/
+func metaOf(keys []rest.Cursor, start int, end int, where *store.WhereEvents) *store.Meta {
+	count := uint64(len(keys))
+	meta := &store.Meta{
+		Count:   count,
+		Cursors: &rest.Cursors{},
+		Where:   where,
+	}
+
+	if where.After == "" && where.Before == "" {
+		meta.Pagination = rest.Paginate(count, where.Offset, where.Limit)
+	}
+
+	if start < end {
+		if end < len(keys) {
+			next := keys[end-1].String()
+			meta.Cursors.Next = &next
+		}
+
+		if start > 0 {
+			previous := keys[start].String()
+			meta.Cursors.Previous = &previous
+		}
+	}
+
+	return meta
+}
+
+/*
+matchEvent reports if an event matches the constraints set at the event level.
+Constraints on jobs and transitions are not evaluated.
+*/
+func matchEvent(e *store.Event, where *store.WhereEvents) bool {
+	if where == nil {
+		return true
+	}
+
+	if !matchTenant(e.Tenant, where) {
+		return false
+	}
+
+	if len(where.SourcesIn) > 0 && !contains(where.SourcesIn, e.Source) {
+		return false
+	}
+
+	if contains(where.SourcesNotIn, e.Source) {
+		return false
+	}
+
+	if len(where.TriggersIn) > 0 && !contains(where.TriggersIn, e.Trigger) {
+		return false
+	}
+
+	if contains(where.TriggersNotIn, e.Trigger) {
+		return false
+	}
+
+	if len(where.VersionsIn) > 0 && !contains(where.VersionsIn, e.Version) {
+		return false
+	}
+
+	if contains(where.VersionsNotIn, e.Version) {
+		return false
+	}
+
+	if where.ReceivedBefore != nil && !e.ReceivedAt.Before(*where.ReceivedBefore) {
+		return false
+	}
+
+	if where.ReceivedAfter != nil && !e.ReceivedAt.After(*where.ReceivedAfter) {
+		return false
+	}
+
+	now := time.Now()
+	if where.OlderThan > 0 && !e.ReceivedAt.Before(now.Add(-where.OlderThan)) {
+		return false
+	}
+
+	if where.NewerThan > 0 && !e.ReceivedAt.After(now.Add(-where.NewerThan)) {
+		return false
+	}
+
+	if !store.MatchPredicates(where.Predicates, e.Context, e.Data) {
+		return false
+	}
+
+	return true
+}
+
+/*
+matchTenant reports if an entry belonging to a tenant matches the constraints on
+tenants. Unlike other constraints, they are applied even when an event ID or a job
+ID is set.
+*/
+func matchTenant(tenant string, where *store.WhereEvents) bool {
+	if len(where.TenantsIn) > 0 && !contains(where.TenantsIn, tenant) {
+		return false
+	}
+
+	return !contains(where.TenantsNotIn, tenant)
+}
+
+/*
+hasInclusions reports if the constraints on jobs (and their transitions) include
+at least one inclusion condition.
+*/
+func hasInclusions(where *store.WhereJobs) bool {
+	if len(where.DestinationsIn) > 0 || len(where.ActionsIn) > 0 || len(where.VersionsIn) > 0 {
+		return true
+	}
+
+	if where.CreatedBefore != nil || where.CreatedAfter != nil || len(where.Predicates) > 0 {
+		return true
+	}
+
+	if where.MinPriority != nil || where.MaxPriority != nil || where.ReadyAt != nil {
+		return true
+	}
+
+	if wt := where.AndWhereTransitions; wt != nil {
+		return len(wt.StatusIn) > 0 || wt.MinAttempts > 0 || wt.MaxAttempts > 0
+	}
+
+	return false
+}
+
+/*
+isIncluded reports if a job, given its latest transition, matches every inclusion
+conditions of the constraints. The latest transition can be nil.
+*/
+func isIncluded(j *store.Job, latest *store.Transition, where *store.WhereJobs) bool {
+	if len(where.DestinationsIn) > 0 && !contains(where.DestinationsIn, j.Destination) {
+		return false
+	}
+
+	if len(where.ActionsIn) > 0 && !contains(where.ActionsIn, j.Action) {
+		return false
+	}
+
+	if len(where.VersionsIn) > 0 && !contains(where.VersionsIn, j.Version) {
+		return false
+	}
+
+	if where.CreatedBefore != nil && !j.CreatedAt.Before(*where.CreatedBefore) {
+		return false
+	}
+
+	if where.CreatedAfter != nil && !j.CreatedAt.After(*where.CreatedAfter) {
+		return false
+	}
+
+	if where.MinPriority != nil && j.Priority < *where.MinPriority {
+		return false
+	}
+
+	if where.MaxPriority != nil && j.Priority > *where.MaxPriority {
+		return false
+	}
+
+	if where.ReadyAt != nil && j.NotBefore != nil && j.NotBefore.After(*where.ReadyAt) {
+		return false
+	}
+
+	if !store.MatchPredicates(where.Predicates, j.Context, j.Data) {
+		return false
+	}
+
+	wt := where.AndWhereTransitions
+	if wt == nil {
+		return true
+	}
+
+	status, attempt := "", uint16(0)
+	if latest != nil {
+		status, attempt = latest.StateAfter, latest.Attempt
+	}
+
+	if len(wt.StatusIn) > 0 && !contains(wt.StatusIn, status) {
+		return false
+	}
+
+	if wt.MinAttempts > 0 && attempt < wt.MinAttempts {
+		return false
+	}
+
+	if wt.MaxAttempts > 0 && attempt > wt.MaxAttempts {
+		return false
+	}
+
+	return true
+}
+
+/*
+isExcluded reports if a job, given its latest transition, matches any of the
+exclusion conditions of the constraints. The latest transition can be nil.
+*/
+func isExcluded(j *store.Job, latest *store.Transition, where *store.WhereJobs) bool {
+	if contains(where.DestinationsNotIn, j.Destination) {
+		return true
+	}
+
+	if contains(where.ActionsNotIn, j.Action) {
+		return true
+	}
+
+	if contains(where.VersionsNotIn, j.Version) {
+		return true
+	}
+
+	if wt := where.AndWhereTransitions; wt != nil && latest != nil {
+		if contains(wt.StatusNotIn, latest.StateAfter) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+matchEventWithJobs reports if an event matches the constraints at every levels.
+An event matches the constraints on jobs if at least one of its jobs matches all
+the inclusion conditions and none of its jobs matches an exclusion condition. This
+allows to strictly exclude events related to jobs with an undesired status, which
+is critical when purging the store. It must be called with the lock held.
+*/
+func (s *Store) matchEventWithJobs(e *store.Event, where *store.WhereEvents) bool {
+	if where == nil || where.AndWhereJobs == nil {
+		return matchEvent(e, where)
+	}
+
+	wj := where.AndWhereJobs
+	if wj.EventID != "" {
+		return e.ID == wj.EventID && matchTenant(e.Tenant, where)
+	}
+
+	if wt := wj.AndWhereTransitions; wt != nil && wt.JobID != "" {
+		return s.jobs[wt.JobID] != nil && s.jobs[wt.JobID].EventID == e.ID && matchTenant(e.Tenant, where)
+	}
+
+	if !matchEvent(e, where) {
+		return false
+	}
+
+	found := !hasInclusions(wj)
+	for _, j := range s.jobsOfEvent(e.ID) {
+		latest := s.latest(j.ID)
+		if isExcluded(j, latest, wj) {
+			return false
+		}
+
+		if !found && isIncluded(j, latest, wj) {
+			found = true
+		}
+	}
+
+	return found
+}
+
+/*
+matchJob reports if a job matches the constraints at every levels. It must be
+called with the lock held.
+*/
+func (s *Store) matchJob(j *store.Job, where *store.WhereEvents) bool {
+	if where != nil && where.AndWhereJobs != nil {
+		wj := where.AndWhereJobs
+		if wj.EventID != "" {
+			return j.EventID == wj.EventID && matchTenant(j.Tenant, where)
+		}
+
+		if wt := wj.AndWhereTransitions; wt != nil && wt.JobID != "" {
+			return j.ID == wt.JobID && matchTenant(j.Tenant, where)
+		}
+	}
+
+	e := s.events[j.EventID]
+	if e == nil || !matchEvent(e, where) {
+		return false
+	}
+
+	if where == nil || where.AndWhereJobs == nil {
+		return true
+	}
+
+	latest := s.latest(j.ID)
+	return isIncluded(j, latest, where.AndWhereJobs) && !isExcluded(j, latest, where.AndWhereJobs)
+}
+
+/*
+matchTransition reports if a transition matches the constraints at every levels.
+Unlike events and jobs, the constraints on status and attempts are applied on the
+transition itself and not on the job's latest transition. It must be called with
+the lock held.
+*/
+func (s *Store) matchTransition(t *store.Transition, where *store.WhereEvents) bool {
+	if where != nil && where.AndWhereJobs != nil {
+		wj := where.AndWhereJobs
+		if wj.EventID != "" {
+			return t.EventID == wj.EventID && matchTenant(s.jobs[t.JobID].Tenant, where)
+		}
+
+		if wt := wj.AndWhereTransitions; wt != nil && wt.JobID != "" {
+			return t.JobID == wt.JobID && matchTenant(s.jobs[t.JobID].Tenant, where)
+		}
+	}
+
+	j := s.jobs[t.JobID]
+	if j == nil {
+		return false
+	}
+
+	e := s.events[j.EventID]
+	if e == nil || !matchEvent(e, where) {
+		return false
+	}
+
+	if where == nil || where.AndWhereJobs == nil {
+		return true
+	}
+
+	return isIncluded(j, t, where.AndWhereJobs) && !isExcluded(j, t, where.AndWhereJobs)
+}
+
+/*
+jobsOfEvent returns the jobs related to an event, ordered by creation date. It
+must be called with the lock held.
+*/
+func (s *Store) jobsOfEvent(eventID string) []*store.Job {
+	jobs := []*store.Job{}
+	for _, id := range s.jobsOf[eventID] {
+		jobs = append(jobs, s.jobs[id])
+	}
+
+	sortJobs(jobs)
+	return jobs
+}
+
+/*
+sortEvents sorts events by their reception date, and then by their ID.
+*/
+func sortEvents(events []*store.Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].ReceivedAt.Equal(events[j].ReceivedAt) {
+			return events[i].ReceivedAt.Before(events[j].ReceivedAt)
+		}
+
+		return events[i].ID < events[j].ID
+	})
+}
+
+/*
+sortJobs sorts jobs by their creation date, and then by their ID.
+*/
+func sortJobs(jobs []*store.Job) {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+
+		return jobs[i].ID < jobs[j].ID
+	})
+}
+
+/*
+sortByPriority sorts jobs by descending priority, and then by their creation date
+and their ID.
+*/
+func sortByPriority(jobs []*store.Job) {
+	sortJobs(jobs)
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Priority > jobs[j].Priority
+	})
+}
+
+/*
+sortTransitions sorts transitions by their creation date, and then by their ID.
+*/
+func sortTransitions(transitions []*store.Transition) {
+	sort.SliceStable(transitions, func(i, j int) bool {
+		if !transitions[i].CreatedAt.Equal(transitions[j].CreatedAt) {
+			return transitions[i].CreatedAt.Before(transitions[j].CreatedAt)
+		}
+
+		return transitions[i].ID < transitions[j].ID
+	})
+}
+
+/*
+contains reports if a value is present in a slice.
+*/
+func contains(slice []string, value string) bool {
+	for _, v := range slice {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
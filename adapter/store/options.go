@@ -1,5 +1,9 @@
 package store
 
+import (
+	"time"
+)
+
 /*
 Driver is a custom type allowing the user to only pass supported drivers when
 configuring the store adapter.
@@ -11,12 +15,26 @@ DriverPostgreSQL is used to leverage PostgreSQL as the store adapter.
 */
 var DriverPostgreSQL Driver = "postgres"
 
+/*
+DriverSQLite is used to leverage SQLite as the store adapter. Entries are persisted
+in a local file, with no external services needed.
+*/
+var DriverSQLite Driver = "sqlite"
+
+/*
+DriverMemory is used to leverage an in-process, in-memory datastore as the store
+adapter. Entries are lost when the application stops, so it shall only be used for
+development and testing purposes.
+*/
+var DriverMemory Driver = "memory"
+
 /*
 Defaults are the defaults options set for the store. When not set, these values
 will automatically be applied.
 */
 var Defaults = &Options{
-	PurgePolicies: []*PurgePolicy{},
+	PurgePolicies:     []*PurgePolicy{},
+	IdempotencyWindow: 24 * time.Hour,
 }
 
 /*
@@ -33,6 +51,17 @@ type Options struct {
 	// PurgePolicies allows to define several intervals to purge entries in the
 	// store given advanced constraints.
 	PurgePolicies []*PurgePolicy `json:"purge"`
+
+	// IdempotencyWindow is the duration during which an event's idempotency key is
+	// considered for detecting duplicates. Events received before this window are
+	// not considered anymore, even if they have the same key.
+	IdempotencyWindow time.Duration `json:"idempotency_window"`
+
+	// Encryption allows to encrypt the context and data of events and jobs before
+	// persisting them. Payloads are decrypted transparently when read from the
+	// store. It is applied by every driver, and predicates can not be used while
+	// it is set. When nil, payloads are persisted in clear text.
+	Encryption Encryption `json:"-"`
 }
 
 /*
@@ -43,10 +72,20 @@ type PurgePolicy struct {
 
 	// Define the constraints to retrieve the entries to purge from store.
 	//
-	// Note: Offset, limit, and pagination will not be applied.
+	// Note: Offset, limit, cursors, and pagination will not be applied.
 	WhereEvents *WhereEvents `json:"where"`
 
 	// Interval represents an interval or a CRON string at which events, jobs, and
 	// transitions shall be purged from the store.
 	Interval string `json:"interval"`
+
+	// ArchiveTo is the path of a local directory where the entries to purge are
+	// archived before being deleted. When empty, entries are deleted without being
+	// archived. See package storearchive for more details.
+	ArchiveTo string `json:"archive_to,omitempty"`
+
+	// DryRun allows to run the policy without deleting nor archiving any entry.
+	// The report of each run holds the number of entries that would have been
+	// deleted. This is useful to safely try a new policy.
+	DryRun bool `json:"dry_run,omitempty"`
 }
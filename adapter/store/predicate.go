@@ -0,0 +1,517 @@
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+Field is a custom type allowing the user to only pass supported payloads when
+filtering entries given their content.
+*/
+type Field string
+
+/*
+FieldContext is used to apply a predicate on the context of events or jobs.
+*/
+var FieldContext Field = "context"
+
+/*
+FieldData is used to apply a predicate on the data of events or jobs.
+*/
+var FieldData Field = "data"
+
+/*
+Operator is a custom type allowing the user to only pass supported operators when
+filtering entries given their content.
+*/
+type Operator string
+
+/*
+OperatorEquals makes sure the value at the path is equal to the single value of
+the predicate.
+*/
+var OperatorEquals Operator = "eq"
+
+/*
+OperatorIn makes sure the value at the path is equal to any of the values of the
+predicate.
+*/
+var OperatorIn Operator = "in"
+
+/*
+OperatorExists makes sure the path exists, no matter its value. The predicate must
+not have any value.
+*/
+var OperatorExists Operator = "exists"
+
+/*
+OperatorRange makes sure the value at the path is within the two values of the
+predicate, inclusive. A nil bound means the range is unbounded on this side. Both
+bounds must be numbers or strings, and only values of the same type match.
+*/
+var OperatorRange Operator = "range"
+
+/*
+Predicate is a condition on the JSON content of events or jobs, given a path in
+their context or data. Values are JSON scalars: strings, numbers, booleans, or nil.
+
+Example: &Predicate{Field: FieldData, Path: "user.id", Operator: OperatorEquals, Values: []interface{}{42}}
+*/
+type Predicate struct {
+
+	// Field is the payload the predicate is applied on.
+	Field Field `json:"field"`
+
+	// Path is the path of the value in the payload. Keys are separated by dots and
+	// array elements are accessed with their index in brackets.
+	//
+	// Example: "items[0].sku"
+	Path string `json:"path"`
+
+	// Operator is the operator applied on the value at the path.
+	Operator Operator `json:"operator"`
+
+	// Values are the values the operator is applied with.
+	Values []interface{} `json:"values,omitempty"`
+}
+
+/*
+segment is a segment of a predicate's path, being either a key in an object or
+an index in an array.
+*/
+type segment struct {
+	key   string
+	index int
+}
+
+/*
+pathRegexp matches a valid path, and segmentRegexp matches each of its segments.
+*/
+var (
+	pathRegexp    = regexp.MustCompile(`^[A-Za-z0-9_-]+(\[[0-9]+\])*(\.[A-Za-z0-9_-]+(\[[0-9]+\])*)*$`)
+	segmentRegexp = regexp.MustCompile(`[A-Za-z0-9_-]+|\[[0-9]+\]`)
+)
+
+/*
+segments returns the segments of the predicate's path. The path must be valid.
+*/
+func (p *Predicate) segments() []segment {
+	out := []segment{}
+	for _, s := range segmentRegexp.FindAllString(p.Path, -1) {
+		if strings.HasPrefix(s, "[") {
+			index, _ := strconv.Atoi(strings.Trim(s, "[]"))
+			out = append(out, segment{index: index})
+			continue
+		}
+
+		out = append(out, segment{key: s, index: -1})
+	}
+
+	return out
+}
+
+/*
+JSONPath returns the path of the predicate in the syntax used by SQL databases,
+with keys quoted. The path must be valid.
+
+Example: `$."items"[0]."sku"`
+*/
+func (p *Predicate) JSONPath() string {
+	path := "$"
+	for _, s := range p.segments() {
+		if s.index >= 0 {
+			path += "[" + strconv.Itoa(s.index) + "]"
+			continue
+		}
+
+		path += `."` + s.key + `"`
+	}
+
+	return path
+}
+
+/*
+Scalars returns the values of the predicate normalized as JSON scalars, so they
+can be compared with the values of a decoded JSON: numbers are converted to
+float64. It returns false if a value is not a JSON scalar.
+*/
+func (p *Predicate) Scalars() ([]interface{}, bool) {
+	out := []interface{}{}
+	for _, v := range p.Values {
+		scalar, ok := scalar(v)
+		if !ok {
+			return nil, false
+		}
+
+		out = append(out, scalar)
+	}
+
+	return out, true
+}
+
+/*
+scalar returns a value normalized as a JSON scalar.
+*/
+func scalar(v interface{}) (interface{}, bool) {
+	switch value := v.(type) {
+	case nil, string, bool, float64:
+		return value, true
+	case json.Number:
+		f, err := value.Float64()
+		return f, err == nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32:
+		return rv.Float(), true
+	}
+
+	return nil, false
+}
+
+/*
+validate returns the validation errors of the predicate. path is the path of the
+predicate in the constraints.
+*/
+func (p *Predicate) validate(path []string) []errors.Validation {
+	fail := []errors.Validation{}
+	if p == nil {
+		return append(fail, errors.Validation{
+			Message: "Predicate must not be nil",
+			Path:    path,
+		})
+	}
+
+	if p.Field != FieldContext && p.Field != FieldData {
+		fail = append(fail, errors.Validation{
+			Message: "Field not supported",
+			Path:    append(path, "Field"),
+		})
+	}
+
+	if !pathRegexp.MatchString(p.Path) {
+		fail = append(fail, errors.Validation{
+			Message: "Path is not valid",
+			Path:    append(path, "Path"),
+		})
+	}
+
+	values, ok := p.Scalars()
+	if !ok {
+		return append(fail, errors.Validation{
+			Message: "Values must be JSON scalars",
+			Path:    append(path, "Values"),
+		})
+	}
+
+	switch p.Operator {
+	case OperatorEquals:
+		if len(values) != 1 {
+			fail = append(fail, errors.Validation{
+				Message: "Operator must have exactly one value",
+				Path:    append(path, "Values"),
+			})
+		}
+
+	case OperatorIn:
+		if len(values) == 0 {
+			fail = append(fail, errors.Validation{
+				Message: "Operator must have at least one value",
+				Path:    append(path, "Values"),
+			})
+		}
+
+	case OperatorExists:
+		if len(values) != 0 {
+			fail = append(fail, errors.Validation{
+				Message: "Operator must not have any value",
+				Path:    append(path, "Values"),
+			})
+		}
+
+	case OperatorRange:
+		if len(values) != 2 || (values[0] == nil && values[1] == nil) {
+			fail = append(fail, errors.Validation{
+				Message: "Operator must have two values, with at least one not nil",
+				Path:    append(path, "Values"),
+			})
+
+			break
+		}
+
+		kind := ""
+		for _, v := range values {
+			switch v.(type) {
+			case nil:
+			case float64:
+				kind += "n"
+			case string:
+				kind += "s"
+			default:
+				kind += "x"
+			}
+		}
+
+		if kind != "n" && kind != "s" && kind != "nn" && kind != "ss" {
+			fail = append(fail, errors.Validation{
+				Message: "Bounds must be both numbers or both strings",
+				Path:    append(path, "Values"),
+			})
+		}
+
+	default:
+		fail = append(fail, errors.Validation{
+			Message: "Operator not supported",
+			Path:    append(path, "Operator"),
+		})
+	}
+
+	return fail
+}
+
+/*
+Match reports if a payload matches the predicate. A payload which is not a valid
+JSON never matches. The predicate must be valid.
+*/
+func (p *Predicate) Match(payload []byte) bool {
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return false
+	}
+
+	for _, s := range p.segments() {
+		if s.index >= 0 {
+			array, ok := value.([]interface{})
+			if !ok || s.index >= len(array) {
+				return false
+			}
+
+			value = array[s.index]
+			continue
+		}
+
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		if value, ok = object[s.key]; !ok {
+			return false
+		}
+	}
+
+	values, _ := p.Scalars()
+	switch p.Operator {
+	case OperatorExists:
+		return true
+
+	case OperatorEquals, OperatorIn:
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+
+	case OperatorRange:
+		min, max := values[0], values[1]
+		switch value := value.(type) {
+		case float64:
+			return inRange(min, max, func(bound interface{}) int {
+				b, ok := bound.(float64)
+				if !ok {
+					return 2
+				}
+
+				if value < b {
+					return -1
+				} else if value > b {
+					return 1
+				}
+
+				return 0
+			})
+
+		case string:
+			return inRange(min, max, func(bound interface{}) int {
+				b, ok := bound.(string)
+				if !ok {
+					return 2
+				}
+
+				return strings.Compare(value, b)
+			})
+		}
+	}
+
+	return false
+}
+
+/*
+inRange reports if a value is within the bounds, given a function comparing the
+value to a bound. The function returns 2 if the bound has not the same type as the
+value.
+*/
+func inRange(min interface{}, max interface{}, compare func(interface{}) int) bool {
+	if min != nil {
+		if c := compare(min); c == 2 || c < 0 {
+			return false
+		}
+	}
+
+	if max != nil {
+		if c := compare(max); c == 2 || c > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+MatchPredicates reports if a context and data match every predicates. The
+predicates must be valid.
+*/
+func MatchPredicates(predicates []*Predicate, context []byte, data []byte) bool {
+	for _, p := range predicates {
+		payload := data
+		if p.Field == FieldContext {
+			payload = context
+		}
+
+		if !p.Match(payload) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+ParsePredicate parses a predicate from its string representation, as used in the
+query string of the admin API:
+
+  <field>.<path>:<operator>[:<values>]
+
+Values are separated by commas. Each value is parsed as JSON if valid, otherwise
+it is used as a string. An empty value is nil, which is useful for unbounded
+ranges.
+
+Examples: "data.user.id:eq:42", "context.ip:exists", "data.amount:range:10,"
+*/
+func ParsePredicate(s string) (*Predicate, error) {
+	fail := &errors.Error{
+		StatusCode: 400,
+		Message:    "Failed to parse predicate",
+		Validations: []errors.Validation{
+			{
+				Message: "Predicate must be formatted as <field>.<path>:<operator>[:<values>]",
+				Path:    []string{"Predicate", s},
+			},
+		},
+	}
+
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 2 {
+		return nil, fail
+	}
+
+	dot := strings.Index(parts[0], ".")
+	if dot < 0 {
+		return nil, fail
+	}
+
+	p := &Predicate{
+		Field:    Field(parts[0][:dot]),
+		Path:     parts[0][dot+1:],
+		Operator: Operator(parts[1]),
+		Values:   []interface{}{},
+	}
+
+	if len(parts) == 3 {
+		for _, raw := range strings.Split(parts[2], ",") {
+			var value interface{}
+			if raw != "" && json.Unmarshal([]byte(raw), &value) != nil {
+				value = raw
+			}
+
+			p.Values = append(p.Values, value)
+		}
+	}
+
+	if validations := p.validate([]string{"Predicate", s}); len(validations) > 0 {
+		fail.Validations = validations
+		return nil, fail
+	}
+
+	return p, nil
+}
+
+/*
+Validate makes sure the constraints can be applied. It returns a 400 error if any
+predicate is not valid or if a relative duration is negative. Drivers shall call
+it before applying the constraints.
+*/
+func (where *WhereEvents) Validate() error {
+	if where == nil {
+		return nil
+	}
+
+	fail := &errors.Error{
+		StatusCode:  400,
+		Message:     "Failed to validate constraints",
+		Validations: []errors.Validation{},
+	}
+
+	if where.OlderThan < 0 {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Duration must not be negative",
+			Path:    []string{"WhereEvents", "OlderThan"},
+		})
+	}
+
+	if where.NewerThan < 0 {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Duration must not be negative",
+			Path:    []string{"WhereEvents", "NewerThan"},
+		})
+	}
+
+	for i, p := range where.Predicates {
+		fail.Validations = append(fail.Validations, p.validate([]string{"WhereEvents", "Predicates", strconv.Itoa(i)})...)
+	}
+
+	if where.AndWhereJobs != nil {
+		for i, p := range where.AndWhereJobs.Predicates {
+			fail.Validations = append(fail.Validations, p.validate([]string{"WhereJobs", "Predicates", strconv.Itoa(i)})...)
+		}
+	}
+
+	if len(fail.Validations) > 0 {
+		return fail
+	}
+
+	return nil
+}
+
+/*
+HasPredicates reports if the constraints include at least one predicate, at the
+event or job level.
+*/
+func (where *WhereEvents) HasPredicates() bool {
+	if where == nil {
+		return false
+	}
+
+	return len(where.Predicates) > 0 || (where.AndWhereJobs != nil && len(where.AndWhereJobs.Predicates) > 0)
+}
@@ -2,6 +2,8 @@ package store
 
 import (
 	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
 )
 
 /*
@@ -67,6 +69,13 @@ type Event struct {
 	// Example: "1UYc8EebLqCAFMOSkbYZdJwNLAJ"
 	ID string `json:"id"`
 
+	// Tenant is the tenant the event belongs to. Sub-events must belong to the
+	// same tenant as their parent event. It is empty when the application is not
+	// multi-tenant.
+	//
+	// Example: "acme"
+	Tenant string `json:"tenant,omitempty"`
+
 	// Source is the string representation of the event's source.
 	Source string `json:"source"`
 
@@ -103,6 +112,10 @@ type Event struct {
 	//
 	// Example: "1UYc8EebLqCAFMOSkbYZdJwNLAJ"
 	ParentEventID *string `json:"parent_event_id,omitempty"`
+
+	// IdempotencyKey is the optional key set by the source's trigger to detect
+	// duplicate events. See FindEventByIdempotencyKey for more details.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 /*
@@ -116,6 +129,10 @@ type Job struct {
 	// Example: "1UYc8EebLqCAFMOSkbYZdJwNLAJ"
 	ID string `json:"id"`
 
+	// Tenant is the tenant the job belongs to. It is always the tenant of the job's
+	// event and is set by the store when inserting the job.
+	Tenant string `json:"tenant,omitempty"`
+
 	// Destination is the string representation of the destination the job needs to
 	// run to.
 	Destination string `json:"destination"`
@@ -142,6 +159,21 @@ type Job struct {
 	// this is the only one that really matters in this context.
 	Transitions [1]*Transition `json:"transitions"`
 
+	// History is the complete list of the job's transitions, in chronological order.
+	// It allows to follow every attempts of a job with their errors and timestamps.
+	//
+	// Note: It is only set when retrieving a job with FindJobHistory, and ignored
+	// when inserting jobs.
+	History []*Transition `json:"history,omitempty"`
+
+	// Priority is the priority of the job. Jobs with a higher priority are claimed
+	// before the others, no matter when they have been created.
+	Priority int `json:"priority"`
+
+	// NotBefore is the instant before which the job must not run. Jobs are not
+	// claimed before this instant. It can be nil.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+
 	// CreatedAt is a timestamp of the job creation date into the store.
 	CreatedAt time.Time `json:"created_at"`
 
@@ -173,8 +205,28 @@ type Transition struct {
 	// StateAfter is the state of the job after running the new transition.
 	StateAfter string `json:"state_after"`
 
-	// Error keeps track of encountered error if any.
-	Error error `json:"error"`
+	// Error keeps track of encountered error if any. It is structured so it can be
+	// marshaled as JSON without losing any detail. Use errors.From to convert any
+	// error.
+	Error *errors.Error `json:"error"`
+
+	// TriggeredBy is the identity of who manually triggered the transition, such
+	// as when requeuing jobs. It is empty for transitions made by the gateway and
+	// scheduler.
+	TriggeredBy string `json:"triggered_by,omitempty"`
+
+	// Owner is the identity of the scheduler instance having claimed the job with
+	// ClaimJobs. It is set on "executing" transitions created by a claim, and must
+	// be set on the transitions made by the owner afterwards.
+	//
+	// Example: "scheduler-1"
+	Owner string `json:"owner,omitempty"`
+
+	// LeaseExpiresAt is the instant the claim of the job expires. Once expired and
+	// if the job is still executing, the job is considered abandoned and is brought
+	// back to "awaiting" by ExpireLeases. It is only set on "executing" transitions
+	// created by a claim.
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
 
 	// CreatedAt is a timestamp of the transition creation date into the store.
 	CreatedAt time.Time `json:"created_at"`
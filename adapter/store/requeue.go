@@ -0,0 +1,28 @@
+package store
+
+/*
+RequeueStatuses are the statuses a job must have for being requeued. Other jobs
+matching the constraints of a requeue are left untouched.
+*/
+var RequeueStatuses = []string{StatusFailed, StatusDiscarded}
+
+/*
+Requeue holds the details of a requeue, which brings failed and discarded jobs
+back to the scheduler by inserting a new "awaiting" transition for each of them.
+This is useful once a destination has been fixed, after jobs reached the maximum
+number of retries.
+*/
+type Requeue struct {
+
+	// ResetAttempts resets the attempt counter of the jobs requeued, giving them
+	// as many retries as new jobs. When false, the attempt counter continues from
+	// the job's latest transition.
+	ResetAttempts bool `json:"reset_attempts"`
+
+	// TriggeredBy is the identity of who triggered the requeue, such as a user's
+	// email address or a service name. It is recorded on every transitions created
+	// and must not be empty.
+	//
+	// Example: "john@example.com"
+	TriggeredBy string `json:"triggered_by"`
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+Purged is the number of entries deleted by a purge, including the ones deleted in
+cascade such as sub-events and child jobs. On a dry run, it is the number of
+entries that would have been deleted.
+*/
+type Purged struct {
+
+	// Events is the number of events deleted.
+	Events uint64 `json:"events"`
+
+	// Jobs is the number of jobs deleted.
+	Jobs uint64 `json:"jobs"`
+
+	// Transitions is the number of transitions deleted.
+	Transitions uint64 `json:"transitions"`
+}
+
+/*
+Entries holds the IDs of entries of the store, such as the ones archived before
+being purged.
+*/
+type Entries struct {
+
+	// Events are the IDs of the events to delete.
+	Events []string `json:"events"`
+
+	// SubEvents, Jobs, and Transitions are the IDs of the sub-events, jobs, and
+	// transitions which can be deleted in cascade along the events.
+	SubEvents   []string `json:"sub_events"`
+	Jobs        []string `json:"jobs"`
+	Transitions []string `json:"transitions"`
+}
+
+/*
+IDs returns the IDs of every entries, no matter their kind. Drivers shall check
+the cascade of each event against it before deleting the event.
+*/
+func (entries *Entries) IDs() map[string]bool {
+	ids := map[string]bool{}
+	if entries == nil {
+		return ids
+	}
+
+	for _, kind := range [][]string{entries.Events, entries.SubEvents, entries.Jobs, entries.Transitions} {
+		for _, id := range kind {
+			ids[id] = true
+		}
+	}
+
+	return ids
+}
+
+/*
+PurgeReport is the report of a purge policy's run. It can be logged and returned
+by the admin API.
+*/
+type PurgeReport struct {
+
+	// Policy is the purge policy run.
+	Policy *PurgePolicy `json:"policy"`
+
+	// Where is the constraints actually applied, with the relative durations
+	// resolved into absolute instants.
+	Where *WhereEvents `json:"where"`
+
+	// DryRun indicates if entries have actually been deleted.
+	DryRun bool `json:"dry_run"`
+
+	// Purged is the number of entries deleted, or that would have been deleted on
+	// a dry run.
+	Purged *Purged `json:"purged"`
+
+	// Archived is the number of events archived before being deleted.
+	Archived uint64 `json:"archived"`
+
+	// StartedAt is the instant the run started.
+	StartedAt time.Time `json:"started_at"`
+
+	// Duration is the time taken by the run, including the archiving.
+	Duration time.Duration `json:"duration"`
+
+	// Error is the error encountered if any. Entries may have been archived even
+	// if an error occurred.
+	Error *errors.Error `json:"error,omitempty"`
+}
+
+/*
+Resolve returns a copy of the constraints with OlderThan and NewerThan resolved
+into ReceivedBefore and ReceivedAfter given the instant passed. When an absolute
+instant is already set, the most restrictive one is kept. Relative durations are
+kept as is, so resolving the constraints again later does not widen them.
+*/
+func (where *WhereEvents) Resolve(now time.Time) *WhereEvents {
+	out := &WhereEvents{}
+	if where != nil {
+		*out = *where
+	}
+
+	if out.OlderThan > 0 {
+		before := now.Add(-out.OlderThan).UTC()
+		if out.ReceivedBefore == nil || before.Before(*out.ReceivedBefore) {
+			out.ReceivedBefore = &before
+		}
+	}
+
+	if out.NewerThan > 0 {
+		after := now.Add(-out.NewerThan).UTC()
+		if out.ReceivedAfter == nil || after.After(*out.ReceivedAfter) {
+			out.ReceivedAfter = &after
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,263 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"github.com/segmentio/ksuid"
+)
+
+/*
+ClaimJobs moves "awaiting" jobs matching the constraints to "executing" on behalf
+of the owner, with a lease of the given duration. Jobs having a NotBefore in the
+future are not claimed. At most Limit jobs are claimed, by descending priority and
+then in chronological order. The write lock of the database is held while
+claiming, so a job can never be claimed twice, even by stores running in different
+processes.
+*/
+func (s *Store) ClaimJobs(tk *store.Toolkit, where *store.WhereEvents, owner string, lease time.Duration) ([]*store.Job, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to claim jobs",
+		Validations: []errors.Validation{},
+	}
+
+	if validations := store.ValidateClaim(owner, lease); len(validations) > 0 {
+		fail.StatusCode = 400
+		fail.Validations = validations
+		return nil, fail
+	}
+
+	where = tk.Scope(where)
+	if err := s.validate(where); err != nil {
+		return nil, err
+	}
+
+	c := jobsWhere(where)
+	jobs := []*store.Job{}
+	transitions := []*store.Transition{}
+	tenants := map[string]string{}
+	err := s.exclusive(func(tx querier) error {
+		now := time.Now().UTC()
+		ready := &conditions{}
+		ready.add("lt.state_after = ?", store.StatusAwaiting)
+		ready.add("(j.not_before IS NULL OR j.not_before <= ?)", timestamp(now))
+		ready.merge(c)
+
+		args := append(ready.args, applied(where).Limit)
+		rows, err := tx.Query(`SELECT `+jobColumns+`, `+fmt.Sprintf(transitionColumns, "lt")+`
+      `+jobsFrom+` WHERE `+ready.and()+`
+      ORDER BY j.priority DESC, j.created_at ASC, j.id ASC LIMIT ?;`, args...)
+
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			j, err := s.scanJob(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			jobs = append(jobs, j)
+		}
+
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		expires := now.Add(lease)
+		for _, j := range jobs {
+			latest := j.Transitions[0]
+			before := latest.StateAfter
+			t := &store.Transition{
+				ID:             ksuid.New().String(),
+				Attempt:        latest.Attempt + 1,
+				StateBefore:    &before,
+				StateAfter:     store.StatusExecuting,
+				Owner:          owner,
+				LeaseExpiresAt: &expires,
+				CreatedAt:      now,
+				EventID:        j.EventID,
+				JobID:          j.ID,
+			}
+
+			if now.Before(latest.CreatedAt) {
+				t.CreatedAt = latest.CreatedAt
+			}
+
+			if err := insertTransition(tx, t, now); err != nil {
+				return err
+			}
+
+			j.Transitions[0] = t
+			transitions = append(transitions, t)
+			tenants[j.ID] = j.Tenant
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	s.notifier.NotifyTransitions(transitions, tenants)
+	return jobs, nil
+}
+
+/*
+ExtendLease postpones the lease of a job claimed by the owner, so it expires once
+the duration has elapsed. The lease is updated on the latest transition of the
+job, which keeps the history of the job untouched. The write lock of the database
+is held, so a lease can not be extended once it has been expired by a sweeper.
+*/
+func (s *Store) ExtendLease(tk *store.Toolkit, jobID string, owner string, lease time.Duration) (*store.Transition, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to extend lease",
+		Validations: []errors.Validation{},
+	}
+
+	if validations := store.ValidateClaim(owner, lease); len(validations) > 0 {
+		fail.StatusCode = 400
+		fail.Validations = validations
+		return nil, fail
+	}
+
+	var latest *store.Transition
+	err := s.exclusive(func(tx querier) error {
+		var tenant string
+		err := tx.QueryRow(`SELECT tenant FROM jobs WHERE id = ?;`, jobID).Scan(&tenant)
+		if err == sql.ErrNoRows || (err == nil && !tk.Owns(tenant)) {
+			return &errors.Error{
+				StatusCode: 404,
+				Message:    "store/sqlite: Job not found",
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		latest, err = latestTransition(tx, jobID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		if validations := store.ValidateOwnership(latest, owner, now); len(validations) > 0 {
+			return &errors.Error{
+				StatusCode:  409,
+				Message:     fail.Message,
+				Validations: validations,
+			}
+		}
+
+		expires := now.Add(lease)
+		latest.LeaseExpiresAt = &expires
+		_, err = tx.Exec(`UPDATE transitions SET lease_expires_at = ? WHERE id = ?;`, timestamp(expires), latest.ID)
+		return err
+	})
+
+	if known, ok := err.(*errors.Error); ok {
+		return nil, known
+	}
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	return latest, nil
+}
+
+/*
+ExpireLeases inserts a new "awaiting" transition for every "executing" jobs whose
+lease has expired, within the tenant of the toolkit if any. Jobs are brought back
+in chronological order. The write lock of the database is held, so a job is only
+brought back once even when several sweepers are running.
+*/
+func (s *Store) ExpireLeases(tk *store.Toolkit) ([]*store.Transition, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to expire leases",
+		Validations: []errors.Validation{},
+	}
+
+	transitions := []*store.Transition{}
+	tenants := map[string]string{}
+	err := s.exclusive(func(tx querier) error {
+		now := time.Now().UTC()
+		c := tenantConditions(tk.Scope(nil))
+		c.add("lt.state_after = ?", store.StatusExecuting)
+		c.add("lt.lease_expires_at <= ?", timestamp(now))
+		rows, err := tx.Query(`SELECT j.id, j.event_id, j.tenant, lt.attempt, lt.owner, lt.created_at
+      `+jobsFrom+` WHERE `+c.and()+`
+      ORDER BY j.created_at ASC, j.id ASC;`, c.args...)
+
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var owner, tenant string
+			var latest int64
+			before := store.StatusExecuting
+			t := &store.Transition{
+				ID:          ksuid.New().String(),
+				StateBefore: &before,
+				StateAfter:  store.StatusAwaiting,
+				CreatedAt:   now,
+			}
+
+			err := rows.Scan(&t.JobID, &t.EventID, &tenant, &t.Attempt, &owner, &latest)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			tenants[t.JobID] = tenant
+			t.Error = store.LeaseExpired(owner)
+			if created := fromTimestamp(latest); now.Before(created) {
+				t.CreatedAt = created
+			}
+
+			transitions = append(transitions, t)
+		}
+
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, t := range transitions {
+			if err := insertTransition(tx, t, now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	s.notifier.NotifyTransitions(transitions, tenants)
+	return transitions, nil
+}
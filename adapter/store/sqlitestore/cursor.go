@@ -0,0 +1,154 @@
+package sqlitestore
+
+import (
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/rest"
+)
+
+/*
+eventsKeyset, jobsKeyset, and transitionsKeyset are the keysets used to position
+events, jobs, and transitions.
+*/
+var (
+	eventsKeyset      = keyset{at: "e.received_at", id: "e.id"}
+	jobsKeyset        = keyset{at: "j.created_at", id: "j.id"}
+	transitionsKeyset = keyset{at: "t.created_at", id: "t.id"}
+)
+
+/*
+jobsFrom and transitionsFrom are the FROM clauses used to query jobs and
+transitions, joining the tables needed to apply the constraints.
+*/
+const (
+	jobsFrom = `FROM jobs AS j
+    INNER JOIN events AS e ON e.id = j.event_id
+    LEFT JOIN latest_transitions AS lt ON lt.job_id = j.id`
+
+	transitionsFrom = `FROM transitions AS t
+    INNER JOIN jobs AS j ON j.id = t.job_id
+    INNER JOIN events AS e ON e.id = j.event_id`
+)
+
+/*
+keyset holds the columns used to position entries for keyset pagination: the
+timestamp column and then the ID column.
+*/
+type keyset struct {
+	at string
+	id string
+}
+
+/*
+after returns the condition making sure entries are positioned after the cursor.
+*/
+func (k keyset) after(c *rest.Cursor) *conditions {
+	out := &conditions{}
+	out.add("("+k.at+" > ? OR ("+k.at+" = ? AND "+k.id+" > ?))",
+		timestamp(c.At), timestamp(c.At), c.ID)
+
+	return out
+}
+
+/*
+before returns the condition making sure entries are positioned before the cursor.
+*/
+func (k keyset) before(c *rest.Cursor) *conditions {
+	out := &conditions{}
+	out.add("("+k.at+" < ? OR ("+k.at+" = ? AND "+k.id+" < ?))",
+		timestamp(c.At), timestamp(c.At), c.ID)
+
+	return out
+}
+
+/*
+window returns the conditions restricting the entries to the cursors set in the
+constraints, the ORDER BY and LIMIT/OFFSET clauses, and their arguments. When only
+the "before" cursor is set, entries are ordered descending so the closest ones
+are returned. The caller is then responsible for reversing them.
+*/
+func (k keyset) window(where *store.WhereEvents) (*conditions, string, []interface{}, bool, error) {
+	c := &conditions{}
+	if where.After == "" && where.Before == "" {
+		clause := " ORDER BY " + k.at + " ASC, " + k.id + " ASC LIMIT ? OFFSET ?"
+		return c, clause, []interface{}{where.Limit, where.Offset}, false, nil
+	}
+
+	if where.After != "" {
+		after, err := rest.ParseCursor(where.After)
+		if err != nil {
+			return nil, "", nil, false, err
+		}
+
+		c.merge(k.after(after))
+	}
+
+	if where.Before != "" {
+		before, err := rest.ParseCursor(where.Before)
+		if err != nil {
+			return nil, "", nil, false, err
+		}
+
+		c.merge(k.before(before))
+	}
+
+	if where.After == "" {
+		clause := " ORDER BY " + k.at + " DESC, " + k.id + " DESC LIMIT ?"
+		return c, clause, []interface{}{where.Limit}, true, nil
+	}
+
+	clause := " ORDER BY " + k.at + " ASC, " + k.id + " ASC LIMIT ?"
+	return c, clause, []interface{}{where.Limit}, false, nil
+}
+
+/*
+cursors returns the cursors to retrieve the entries next to the first and last
+ones returned. from is the FROM clause of the query and c its conditions, without
+the cursors applied. first and last are nil if no entry has been returned.
+*/
+func (s *Store) cursors(k keyset, from string, c *conditions, first *rest.Cursor, last *rest.Cursor) (*rest.Cursors, error) {
+	out := &rest.Cursors{}
+	if first == nil || last == nil {
+		return out, nil
+	}
+
+	var exists bool
+	next := &conditions{}
+	next.merge(c)
+	next.merge(k.after(last))
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 `+from+` WHERE `+next.and()+`);`, next.args...).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		cursor := last.String()
+		out.Next = &cursor
+	}
+
+	previous := &conditions{}
+	previous.merge(c)
+	previous.merge(k.before(first))
+	err = s.db.QueryRow(`SELECT EXISTS (SELECT 1 `+from+` WHERE `+previous.and()+`);`, previous.args...).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		cursor := first.String()
+		out.Previous = &cursor
+	}
+
+	return out, nil
+}
+
+/*
+pageOf returns the pagination details of a query. They are not computed when a
+cursor is set in the constraints.
+*/
+func pageOf(count uint64, where *store.WhereEvents) *rest.Pagination {
+	if where.After != "" || where.Before != "" {
+		return nil
+	}
+
+	return rest.Paginate(count, where.Offset, where.Limit)
+}
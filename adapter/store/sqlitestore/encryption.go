@@ -0,0 +1,162 @@
+package sqlitestore
+
+import (
+	"database/sql"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+seal returns the context and data to persist, encrypted with the encryption set
+in the options if any.
+*/
+func (s *Store) seal(context []byte, data []byte) ([]byte, []byte, error) {
+	context, err := store.Seal(s.options.Encryption, context)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err = store.Seal(s.options.Encryption, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return context, data, nil
+}
+
+/*
+unseal returns the context and data persisted, decrypted with the encryption set
+in the options if they are encrypted.
+*/
+func (s *Store) unseal(context []byte, data []byte) ([]byte, []byte, error) {
+	context, err := store.Unseal(s.options.Encryption, context)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err = store.Unseal(s.options.Encryption, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return context, data, nil
+}
+
+/*
+Reencrypt encrypts the context and data of every events and jobs with the current
+key of the encryption set in the options. Entries are re-encrypted by batches of
+DefaultLimit, each batch within its own transaction. Since entries already
+encrypted with the current key are left untouched, it can safely be run again if
+an error occurred.
+*/
+func (s *Store) Reencrypt(tk *store.Toolkit) (uint64, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to re-encrypt entries",
+		Validations: []errors.Validation{},
+	}
+
+	if s.options.Encryption == nil {
+		fail.StatusCode = 400
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Encryption must be set",
+			Path:    []string{"Options", "Store", "Encryption"},
+		})
+
+		return 0, fail
+	}
+
+	var count uint64
+	for _, table := range []string{"events", "jobs"} {
+		n, err := s.reencrypt(table)
+		count += n
+		if err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: err.Error(),
+			})
+
+			return count, fail
+		}
+	}
+
+	return count, nil
+}
+
+/*
+reencrypt re-encrypts the context and data of every rows of a table, ordered by
+ID. It returns the number of rows updated.
+*/
+func (s *Store) reencrypt(table string) (uint64, error) {
+	var count uint64
+	var last string
+	for {
+		var scanned, updated int
+		err := s.transaction(func(tx *sql.Tx) error {
+			rows, err := tx.Query(`SELECT id, context, data FROM `+table+`
+        WHERE id > ? ORDER BY id ASC LIMIT ?;`, last, DefaultLimit)
+
+			if err != nil {
+				return err
+			}
+
+			type row struct {
+				id      string
+				context []byte
+				data    []byte
+			}
+
+			updates := []row{}
+			for rows.Next() {
+				var r row
+				if err := rows.Scan(&r.id, &r.context, &r.data); err != nil {
+					rows.Close()
+					return err
+				}
+
+				scanned++
+				last = r.id
+				context, contextChanged, err := store.Reseal(s.options.Encryption, r.context)
+				if err != nil {
+					rows.Close()
+					return err
+				}
+
+				data, dataChanged, err := store.Reseal(s.options.Encryption, r.data)
+				if err != nil {
+					rows.Close()
+					return err
+				}
+
+				if contextChanged || dataChanged {
+					updates = append(updates, row{id: r.id, context: context, data: data})
+				}
+			}
+
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			for _, r := range updates {
+				_, err := tx.Exec(`UPDATE `+table+` SET context = ?, data = ? WHERE id = ?;`,
+					r.context, r.data, r.id)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			updated = len(updates)
+			return nil
+		})
+
+		if err != nil {
+			return count, err
+		}
+
+		count += uint64(updated)
+		if uint64(scanned) < DefaultLimit {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+	"github.com/nunchistudio/blacksmith/helper/rest"
+)
+
+/*
+AddEvents inserts a queue of events into the store, including their jobs and the
+jobs' transitions if any. Jobs belong to the tenant of their event, and sub-events
+must belong to the tenant of their parent event. Everything is inserted within a
+single transaction, holding the write lock so duplicate events are detected even
+when added concurrently.
+*/
+func (s *Store) AddEvents(tk *store.Toolkit, queue []*store.Event) error {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to add events",
+		Validations: []errors.Validation{},
+	}
+
+	var events []*store.Event
+	var duplicates map[*store.Event]string
+	err := s.exclusive(func(tx querier) error {
+		now := time.Now().UTC()
+		since := now.Add(-s.options.IdempotencyWindow)
+
+		var err error
+		events, duplicates, err = store.Deduplicate(queue, since, func(e *store.Event) (string, error) {
+			return originalOf(tx, e, since)
+		})
+
+		if err != nil {
+			return err
+		}
+
+		validations, err := validateEvents(tx, tk, events)
+		if err != nil {
+			return err
+		}
+
+		if len(validations) > 0 {
+			return &errors.Error{
+				StatusCode:  400,
+				Message:     fail.Message,
+				Validations: validations,
+			}
+		}
+
+		jobs := []*store.Job{}
+		for _, e := range events {
+			context, data, err := s.seal(e.Context, e.Data)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`INSERT INTO events (id, tenant, source, "trigger", version, context,
+        data, parent_event_id, sent_at, received_at, ingested_at, idempotency_key)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+				e.ID, e.Tenant, e.Source, e.Trigger, e.Version, context,
+				data, e.ParentEventID, nullTimestamp(e.SentAt), timestamp(e.ReceivedAt), timestamp(now),
+				e.IdempotencyKey,
+			)
+
+			if err != nil {
+				return err
+			}
+
+			for _, j := range e.Jobs {
+				job := *j
+				job.EventID = e.ID
+				job.Tenant = e.Tenant
+				if err := s.insertJob(tx, &job, now); err != nil {
+					return err
+				}
+
+				jobs = append(jobs, &job)
+			}
+		}
+
+		return checkParentJobs(tx, tk, jobs, fail.Message)
+	})
+
+	if invalid, ok := err.(*errors.Error); ok {
+		return invalid
+	}
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return fail
+	}
+
+	for e, id := range duplicates {
+		e.ID = id
+	}
+
+	s.notifier.NotifyEvents(events)
+	return nil
+}
+
+/*
+validateEvents returns the validation errors of events added to the store within
+a transaction. Event IDs must be unique and events must belong to the tenant of
+the toolkit. Sub-events must belong to the tenant of their parent event, which can
+be part of the same queue.
+*/
+func validateEvents(tx querier, tk *store.Toolkit, events []*store.Event) ([]errors.Validation, error) {
+	validations := []errors.Validation{}
+	batch := map[string]*store.Event{}
+	for _, e := range events {
+		_, err := tenantOf(tx, "events", e.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		if e.ID == "" || err == nil || batch[e.ID] != nil {
+			validations = append(validations, errors.Validation{
+				Message: "Event ID must be unique and not empty",
+				Path:    []string{"Event", e.ID, "ID"},
+			})
+		}
+
+		if !tk.Owns(e.Tenant) {
+			validations = append(validations, errors.Validation{
+				Message: "Event must belong to the tenant of the toolkit",
+				Path:    []string{"Event", e.ID, "Tenant"},
+			})
+		}
+
+		batch[e.ID] = e
+	}
+
+	for _, e := range events {
+		if e.ParentEventID == nil {
+			continue
+		}
+
+		tenant, err := tenantOf(tx, "events", *e.ParentEventID)
+		if parent := batch[*e.ParentEventID]; err == sql.ErrNoRows && parent != nil {
+			tenant, err = parent.Tenant, nil
+		}
+
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		if err == sql.ErrNoRows || !tk.Owns(tenant) {
+			validations = append(validations, errors.Validation{
+				Message: "Parent event does not exist",
+				Path:    []string{"Event", e.ID, "ParentEventID"},
+			})
+		} else if tenant != e.Tenant {
+			validations = append(validations, errors.Validation{
+				Message: "Parent event must belong to the same tenant",
+				Path:    []string{"Event", e.ID, "ParentEventID"},
+			})
+		}
+	}
+
+	return validations, nil
+}
+
+/*
+originalOf returns the ID of the latest event of the same tenant and source as the
+event passed, having the same idempotency key and received after the instant
+passed. It returns an empty string if there is none.
+*/
+func originalOf(tx querier, e *store.Event, since time.Time) (string, error) {
+	var id string
+	err := tx.QueryRow(`SELECT id FROM events
+    WHERE tenant = ? AND source = ? AND idempotency_key = ? AND idempotency_key != ''
+      AND received_at > ?
+    ORDER BY received_at DESC, id DESC LIMIT 1;`,
+		e.Tenant, e.Source, e.IdempotencyKey, timestamp(since)).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return id, err
+}
+
+/*
+FindEvent returns an event given its ID, including its jobs with their latest
+transition.
+*/
+func (s *Store) FindEvent(tk *store.Toolkit, id string) (*store.Event, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to find event",
+		Validations: []errors.Validation{},
+	}
+
+	row := s.db.QueryRow(`SELECT `+eventColumns+` FROM events AS e WHERE e.id = ?;`, id)
+	e, err := s.scanEvent(row)
+	if err == sql.ErrNoRows || (err == nil && !tk.Owns(e.Tenant)) {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/sqlite: Event not found",
+		}
+	}
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	err = s.withJobs([]*store.Event{e}, "?", id)
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	return e, nil
+}
+
+/*
+FindEventByIdempotencyKey returns the latest event of a tenant and source having
+the key, received within the idempotency window. It returns a 404 error if there
+is none.
+*/
+func (s *Store) FindEventByIdempotencyKey(tk *store.Toolkit, tenant string, source string, key string) (*store.Event, error) {
+	since := time.Now().UTC().Add(-s.options.IdempotencyWindow)
+	c := tenantConditions(tk.Scope(nil))
+	c.add("e.tenant = ?", tenant)
+	c.add("e.source = ?", source)
+	c.add("e.idempotency_key = ?", key)
+	c.add("e.idempotency_key != ''")
+	c.add("e.received_at > ?", timestamp(since))
+
+	var id string
+	err := s.db.QueryRow(`SELECT e.id FROM events AS e WHERE `+c.and()+`
+    ORDER BY e.received_at DESC, e.id DESC LIMIT 1;`, c.args...).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/sqlite: Event not found",
+		}
+	}
+
+	if err != nil {
+		return nil, &errors.Error{
+			Message: "store/sqlite: Failed to find event",
+			Validations: []errors.Validation{
+				{
+					Message: err.Error(),
+				},
+			},
+		}
+	}
+
+	return s.FindEvent(tk, id)
+}
+
+/*
+FindEvents returns a list of events matching the constraints, including their
+jobs with their latest transition.
+*/
+func (s *Store) FindEvents(tk *store.Toolkit, where *store.WhereEvents) ([]*store.Event, *store.Meta, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to find events",
+		Validations: []errors.Validation{},
+	}
+
+	where = applied(tk.Scope(where))
+	if err := s.validate(where); err != nil {
+		return nil, nil, err
+	}
+
+	c := eventsWhere(where)
+
+	var count uint64
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM events AS e WHERE `+c.and()+`;`, c.args...).Scan(&count)
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, nil, fail
+	}
+
+	events, err := s.pageEvents(c, where)
+	if _, ok := err.(*errors.Error); ok {
+		return nil, nil, err
+	}
+
+	var cursors *rest.Cursors
+	if err == nil {
+		var first, last *rest.Cursor
+		if len(events) > 0 {
+			first = &rest.Cursor{At: events[0].ReceivedAt, ID: events[0].ID}
+			last = &rest.Cursor{At: events[len(events)-1].ReceivedAt, ID: events[len(events)-1].ID}
+		}
+
+		cursors, err = s.cursors(eventsKeyset, `FROM events AS e`, c, first, last)
+	}
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, nil, fail
+	}
+
+	meta := &store.Meta{
+		Count:      count,
+		Pagination: pageOf(count, where),
+		Cursors:    cursors,
+		Where:      where,
+	}
+
+	return events, meta, nil
+}
+
+/*
+pageEvents returns the events matching the conditions within the window defined
+by the offset, limit, and cursors of the constraints. A malformed cursor is
+returned as an *errors.Error.
+*/
+func (s *Store) pageEvents(c *conditions, where *store.WhereEvents) ([]*store.Event, error) {
+	w, clause, extra, _, err := eventsKeyset.window(where)
+	if err != nil {
+		return nil, err
+	}
+
+	paged := &conditions{}
+	paged.merge(c)
+	paged.merge(w)
+	page := `SELECT e.id FROM events AS e WHERE ` + paged.and() + clause
+
+	args := append(append([]interface{}{}, paged.args...), extra...)
+	events, err := s.queryEvents(`SELECT `+eventColumns+` FROM events AS e
+    WHERE e.id IN (`+page+`)
+    ORDER BY e.received_at ASC, e.id ASC;`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return events, s.withJobs(events, page, args...)
+}
+
+/*
+queryEvents runs a query selecting eventColumns and returns the events scanned.
+*/
+func (s *Store) queryEvents(query string, args ...interface{}) ([]*store.Event, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	events := []*store.Event{}
+	for rows.Next() {
+		e, err := s.scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+/*
+withJobs sets the jobs of events, each one having its latest transition. ids is
+a query (or a placeholder) returning the IDs of the events.
+*/
+func (s *Store) withJobs(events []*store.Event, ids string, args ...interface{}) error {
+	jobs, err := s.queryJobs(`SELECT `+jobColumns+`, `+fmt.Sprintf(transitionColumns, "lt")+`
+    FROM jobs AS j
+    LEFT JOIN latest_transitions AS lt ON lt.job_id = j.id
+    WHERE j.event_id IN (`+ids+`)
+    ORDER BY j.created_at ASC, j.id ASC;`, args...)
+
+	if err != nil {
+		return err
+	}
+
+	byID := map[string]*store.Event{}
+	for _, e := range events {
+		byID[e.ID] = e
+	}
+
+	for _, j := range jobs {
+		if e := byID[j.EventID]; e != nil {
+			e.Jobs = append(e.Jobs, j)
+		}
+	}
+
+	return nil
+}
+
+/*
+transaction runs a function within a transaction. The transaction is committed if
+the function returns no error, and rolled back otherwise.
+*/
+func (s *Store) transaction(fn func(*sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+querier is implemented by *sql.Tx and by the connections of exclusive, so entries
+can be read and written the same way within both.
+*/
+type querier interface {
+	Exec(string, ...interface{}) (sql.Result, error)
+	Query(string, ...interface{}) (*sql.Rows, error)
+	QueryRow(string, ...interface{}) *sql.Row
+}
+
+/*
+immediate implements the querier interface on top of a connection dedicated to a
+transaction begun with "BEGIN IMMEDIATE".
+*/
+type immediate struct {
+	conn *sql.Conn
+}
+
+/*
+Exec executes a query without returning any rows.
+*/
+func (i *immediate) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return i.conn.ExecContext(context.Background(), query, args...)
+}
+
+/*
+Query executes a query returning rows.
+*/
+func (i *immediate) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return i.conn.QueryContext(context.Background(), query, args...)
+}
+
+/*
+QueryRow executes a query returning at most one row.
+*/
+func (i *immediate) QueryRow(query string, args ...interface{}) *sql.Row {
+	return i.conn.QueryRowContext(context.Background(), query, args...)
+}
+
+/*
+exclusive runs a function within a transaction holding the write lock of the
+database from its start, so entries read within the transaction can not be
+updated concurrently, even by another process. Since database/sql only begins
+deferred transactions, the transaction is begun with "BEGIN IMMEDIATE" on a
+connection dedicated to it, waiting for the busy timeout if needed. It is
+committed if the function returns no error, and rolled back otherwise.
+*/
+func (s *Store) exclusive(fn func(querier) error) error {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE;`); err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			conn.ExecContext(ctx, `ROLLBACK;`)
+		}
+	}()
+
+	if err := fn(&immediate{conn: conn}); err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, `COMMIT;`); err != nil {
+		return err
+	}
+
+	committed = true
+	return nil
+}
@@ -0,0 +1,149 @@
+package sqlitestore
+
+import (
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+	"github.com/nunchistudio/blacksmith/helper/rest"
+)
+
+/*
+batch returns a copy of the constraints to use for retrieving the first batch of
+an iteration. Offset and cursors are removed, and the limit is set to the default
+one.
+*/
+func batch(where *store.WhereEvents) *store.WhereEvents {
+	out := applied(where)
+	out.Offset = 0
+	out.After = ""
+	out.Before = ""
+	out.Limit = DefaultLimit
+
+	return out
+}
+
+/*
+IterateEvents calls fn for every events matching the constraints. Events are
+retrieved by batches using keyset pagination, so the memory used does not depend
+on the number of events and no connection is held while fn is running.
+*/
+func (s *Store) IterateEvents(tk *store.Toolkit, where *store.WhereEvents, fn func(*store.Event) error) error {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to iterate events",
+		Validations: []errors.Validation{},
+	}
+
+	where = batch(tk.Scope(where))
+	if err := s.validate(where); err != nil {
+		return err
+	}
+
+	c := eventsWhere(where)
+	for {
+		events, err := s.pageEvents(c, where)
+		if err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: err.Error(),
+			})
+
+			return fail
+		}
+
+		for _, e := range events {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+
+		if uint64(len(events)) < where.Limit {
+			return nil
+		}
+
+		last := events[len(events)-1]
+		where.After = rest.Cursor{At: last.ReceivedAt, ID: last.ID}.String()
+	}
+}
+
+/*
+IterateJobs calls fn for every jobs matching the constraints. Jobs are retrieved
+by batches using keyset pagination, so the memory used does not depend on the
+number of jobs and no connection is held while fn is running.
+*/
+func (s *Store) IterateJobs(tk *store.Toolkit, where *store.WhereEvents, fn func(*store.Job) error) error {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to iterate jobs",
+		Validations: []errors.Validation{},
+	}
+
+	where = batch(tk.Scope(where))
+	if err := s.validate(where); err != nil {
+		return err
+	}
+
+	c := jobsWhere(where)
+	for {
+		jobs, err := s.pageJobs(c, where)
+		if err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: err.Error(),
+			})
+
+			return fail
+		}
+
+		for _, j := range jobs {
+			if err := fn(j); err != nil {
+				return err
+			}
+		}
+
+		if uint64(len(jobs)) < where.Limit {
+			return nil
+		}
+
+		last := jobs[len(jobs)-1]
+		where.After = rest.Cursor{At: last.CreatedAt, ID: last.ID}.String()
+	}
+}
+
+/*
+IterateTransitions calls fn for every transitions matching the constraints.
+Transitions are retrieved by batches using keyset pagination, so the memory used
+does not depend on the number of transitions and no connection is held while fn
+is running.
+*/
+func (s *Store) IterateTransitions(tk *store.Toolkit, where *store.WhereEvents, fn func(*store.Transition) error) error {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to iterate transitions",
+		Validations: []errors.Validation{},
+	}
+
+	where = batch(tk.Scope(where))
+	if err := s.validate(where); err != nil {
+		return err
+	}
+
+	c := transitionsWhere(where)
+	for {
+		transitions, err := s.pageTransitions(c, where)
+		if err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: err.Error(),
+			})
+
+			return fail
+		}
+
+		for _, t := range transitions {
+			if err := fn(t); err != nil {
+				return err
+			}
+		}
+
+		if uint64(len(transitions)) < where.Limit {
+			return nil
+		}
+
+		last := transitions[len(transitions)-1]
+		where.After = rest.Cursor{At: last.CreatedAt, ID: last.ID}.String()
+	}
+}
@@ -0,0 +1,339 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+	"github.com/nunchistudio/blacksmith/helper/rest"
+)
+
+/*
+AddJobs inserts a list of jobs into the store, including their transition if
+any. Jobs belong to the tenant of their event, and child jobs must belong to the
+tenant of their parent job. Everything is inserted within a single transaction.
+*/
+func (s *Store) AddJobs(tk *store.Toolkit, jobs []*store.Job) error {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to add jobs",
+		Validations: []errors.Validation{},
+	}
+
+	inserted := []*store.Job{}
+	err := s.transaction(func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+		for _, j := range jobs {
+			job := *j
+			tenant, err := tenantOf(tx, "events", j.EventID)
+			if err == sql.ErrNoRows || (err == nil && !tk.Owns(tenant)) {
+				return &errors.Error{
+					StatusCode: 400,
+					Message:    fail.Message,
+					Validations: []errors.Validation{
+						{
+							Message: "Event does not exist",
+							Path:    []string{"Job", j.ID, "EventID"},
+						},
+					},
+				}
+			}
+
+			if err != nil {
+				return err
+			}
+
+			job.Tenant = tenant
+			if err := s.insertJob(tx, &job, now); err != nil {
+				return err
+			}
+
+			inserted = append(inserted, &job)
+		}
+
+		return checkParentJobs(tx, tk, inserted, fail.Message)
+	})
+
+	if invalid, ok := err.(*errors.Error); ok {
+		return invalid
+	}
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return fail
+	}
+
+	s.notifier.NotifyJobs(inserted)
+	return nil
+}
+
+/*
+FindJob returns a job given its ID, including its latest transition.
+*/
+func (s *Store) FindJob(tk *store.Toolkit, id string) (*store.Job, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to find job",
+		Validations: []errors.Validation{},
+	}
+
+	row := s.db.QueryRow(`SELECT `+jobColumns+`, `+fmt.Sprintf(transitionColumns, "lt")+`
+    FROM jobs AS j
+    LEFT JOIN latest_transitions AS lt ON lt.job_id = j.id
+    WHERE j.id = ?;`, id)
+
+	j, err := s.scanJob(row)
+	if err == sql.ErrNoRows || (err == nil && !tk.Owns(j.Tenant)) {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/sqlite: Job not found",
+		}
+	}
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	return j, nil
+}
+
+/*
+FindJobHistory returns a job given its ID, including its latest transition and
+every transitions in chronological order. Transitions created at the same instant
+are kept in insertion order.
+*/
+func (s *Store) FindJobHistory(tk *store.Toolkit, id string) (*store.Job, error) {
+	j, err := s.FindJob(tk, id)
+	if err != nil {
+		return nil, err
+	}
+
+	j.History, err = s.queryTransitions(`SELECT `+fmt.Sprintf(transitionColumns, "t")+`
+    FROM transitions AS t WHERE t.job_id = ?
+    ORDER BY t.created_at ASC, t.rowid ASC;`, id)
+
+	if err != nil {
+		return nil, &errors.Error{
+			Message: "store/sqlite: Failed to find job history",
+			Validations: []errors.Validation{
+				{
+					Message: err.Error(),
+				},
+			},
+		}
+	}
+
+	return j, nil
+}
+
+/*
+FindJobs returns a list of jobs matching the constraints, including their latest
+transition.
+*/
+func (s *Store) FindJobs(tk *store.Toolkit, where *store.WhereEvents) ([]*store.Job, *store.Meta, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to find jobs",
+		Validations: []errors.Validation{},
+	}
+
+	where = applied(tk.Scope(where))
+	if err := s.validate(where); err != nil {
+		return nil, nil, err
+	}
+
+	c := jobsWhere(where)
+
+	var count uint64
+	err := s.db.QueryRow(`SELECT COUNT(*) `+jobsFrom+` WHERE `+c.and()+`;`, c.args...).Scan(&count)
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, nil, fail
+	}
+
+	jobs, err := s.pageJobs(c, where)
+	if _, ok := err.(*errors.Error); ok {
+		return nil, nil, err
+	}
+
+	var cursors *rest.Cursors
+	if err == nil {
+		var first, last *rest.Cursor
+		if len(jobs) > 0 {
+			first = &rest.Cursor{At: jobs[0].CreatedAt, ID: jobs[0].ID}
+			last = &rest.Cursor{At: jobs[len(jobs)-1].CreatedAt, ID: jobs[len(jobs)-1].ID}
+		}
+
+		cursors, err = s.cursors(jobsKeyset, jobsFrom, c, first, last)
+	}
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, nil, fail
+	}
+
+	meta := &store.Meta{
+		Count:      count,
+		Pagination: pageOf(count, where),
+		Cursors:    cursors,
+		Where:      where,
+	}
+
+	return jobs, meta, nil
+}
+
+/*
+pageJobs returns the jobs matching the conditions within the window defined by
+the offset, limit, and cursors of the constraints. A malformed cursor is returned
+as an *errors.Error.
+*/
+func (s *Store) pageJobs(c *conditions, where *store.WhereEvents) ([]*store.Job, error) {
+	w, clause, extra, reverse, err := jobsKeyset.window(where)
+	if err != nil {
+		return nil, err
+	}
+
+	paged := &conditions{}
+	paged.merge(c)
+	paged.merge(w)
+	args := append(append([]interface{}{}, paged.args...), extra...)
+	jobs, err := s.queryJobs(`SELECT `+jobColumns+`, `+fmt.Sprintf(transitionColumns, "lt")+` `+jobsFrom+`
+    WHERE `+paged.and()+clause+`;`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if reverse {
+		for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
+			jobs[i], jobs[j] = jobs[j], jobs[i]
+		}
+	}
+
+	return jobs, nil
+}
+
+/*
+queryJobs runs a query selecting jobColumns followed by transitionColumns, and
+returns the jobs scanned.
+*/
+func (s *Store) queryJobs(query string, args ...interface{}) ([]*store.Job, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	jobs := []*store.Job{}
+	for rows.Next() {
+		j, err := s.scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, j)
+	}
+
+	return jobs, rows.Err()
+}
+
+/*
+insertJob inserts a job and its transition if any within a transaction. Timestamps
+not set are set to now. Its tenant must be the one of its event.
+*/
+func (s *Store) insertJob(tx querier, j *store.Job, now time.Time) error {
+	created := j.CreatedAt
+	if created.IsZero() {
+		created = now
+	}
+
+	context, data, err := s.seal(j.Context, j.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO jobs (id, tenant, destination, action, version, context,
+    data, parent_job_id, event_id, priority, not_before, created_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		j.ID, j.Tenant, j.Destination, j.Action, j.Version, context,
+		data, j.ParentJobID, j.EventID, j.Priority, nullTimestamp(j.NotBefore), timestamp(created),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if t := j.Transitions[0]; t != nil {
+		transition := *t
+		transition.EventID = j.EventID
+		transition.JobID = j.ID
+		return insertTransition(tx, &transition, now)
+	}
+
+	return nil
+}
+
+/*
+checkParentJobs makes sure the parent of every jobs exists within the scope of
+the toolkit and belongs to the same tenant as the job. It must be called once
+every jobs of a transaction have been inserted, since parents can be part of the
+same batch. It returns a 400 error with the message passed, holding a validation
+error for every invalid job.
+*/
+func checkParentJobs(tx querier, tk *store.Toolkit, jobs []*store.Job, message string) error {
+	validations := []errors.Validation{}
+	for _, j := range jobs {
+		if j.ParentJobID == nil {
+			continue
+		}
+
+		tenant, err := tenantOf(tx, "jobs", *j.ParentJobID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		if err == sql.ErrNoRows || !tk.Owns(tenant) {
+			validations = append(validations, errors.Validation{
+				Message: "Parent job does not exist",
+				Path:    []string{"Job", j.ID, "ParentJobID"},
+			})
+		} else if tenant != j.Tenant {
+			validations = append(validations, errors.Validation{
+				Message: "Parent job must belong to the same tenant",
+				Path:    []string{"Job", j.ID, "ParentJobID"},
+			})
+		}
+	}
+
+	if len(validations) > 0 {
+		return &errors.Error{
+			StatusCode:  400,
+			Message:     message,
+			Validations: validations,
+		}
+	}
+
+	return nil
+}
+
+/*
+tenantOf returns the tenant of an entry of a table (events or jobs) within a
+transaction. It returns sql.ErrNoRows if the entry does not exist.
+*/
+func tenantOf(tx querier, table string, id string) (string, error) {
+	var tenant string
+	err := tx.QueryRow(`SELECT tenant FROM `+table+` WHERE id = ?;`, id).Scan(&tenant)
+	return tenant, err
+}
@@ -0,0 +1,14 @@
+/*
+Package sqlitestore provides a SQLite implementation of the store adapter. It relies
+on a pure-Go SQLite driver and persists events, jobs, and transitions in a local
+file, so a Blacksmith application can run with no external services. This is
+useful for single-node deployments, edge devices, and continuous integration.
+
+The schema mirrors the one of the PostgreSQL driver and is automatically created
+when the store is created.
+
+The store implements the store.Watcher interface. Since SQLite has no mechanism to
+notify other connections, only the entries added through the same store are
+notified.
+*/
+package sqlitestore
@@ -0,0 +1,186 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+cascadeWith holds the events and jobs deleted when deleting the events matching
+the conditions, given the foreign keys' cascading deletes. It must be formatted
+with the conditions.
+*/
+const cascadeWith = `WITH RECURSIVE
+  purged_events (id) AS (
+    SELECT e.id FROM events AS e WHERE %s
+    UNION
+    SELECT e.id FROM events AS e
+    INNER JOIN purged_events AS p ON e.parent_event_id = p.id
+  ),
+  purged_jobs (id) AS (
+    SELECT j.id FROM jobs AS j
+    WHERE j.event_id IN (SELECT id FROM purged_events)
+    UNION
+    SELECT j.id FROM jobs AS j
+    INNER JOIN purged_jobs AS p ON j.parent_job_id = p.id
+  )
+`
+
+/*
+purgedWith is the query counting the entries deleted when deleting the events
+matching the conditions. It must be formatted with the conditions.
+*/
+const purgedWith = cascadeWith + `  SELECT
+    (SELECT COUNT(*) FROM purged_events),
+    (SELECT COUNT(*) FROM purged_jobs),
+    (SELECT COUNT(*) FROM transitions AS t WHERE t.job_id IN (SELECT id FROM purged_jobs));`
+
+/*
+cascadeOf is the query returning the kind and the ID of every entries deleted when
+deleting the events matching the conditions. It must be formatted with the
+conditions.
+*/
+const cascadeOf = cascadeWith + `  SELECT 'event', id FROM purged_events
+  UNION ALL
+  SELECT 'job', id FROM purged_jobs
+  UNION ALL
+  SELECT 'transition', t.id FROM transitions AS t WHERE t.job_id IN (SELECT id FROM purged_jobs);`
+
+/*
+Purge deletes every events matching the constraints. Offset and limit are not
+applied. Jobs and transitions, as well as sub-events and child jobs, are deleted
+by the foreign keys' cascading deletes. Entries are counted and deleted within a
+single transaction, so the number of entries returned is exact. On a dry run,
+nothing is deleted.
+*/
+func (s *Store) Purge(tk *store.Toolkit, where *store.WhereEvents, dryRun bool) (*store.Purged, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to purge store",
+		Validations: []errors.Validation{},
+	}
+
+	where = tk.Scope(where)
+	if err := s.validate(where); err != nil {
+		return nil, err
+	}
+
+	c := eventsWhere(where)
+	purged := &store.Purged{}
+	err := s.transaction(func(tx *sql.Tx) error {
+		err := tx.QueryRow(fmt.Sprintf(purgedWith, c.and()), c.args...).Scan(&purged.Events, &purged.Jobs, &purged.Transitions)
+		if err != nil || dryRun {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM events WHERE id IN (
+      SELECT e.id FROM events AS e WHERE `+c.and()+`
+    );`, c.args...)
+
+		return err
+	})
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	return purged, nil
+}
+
+/*
+PurgeEntries deletes the events of the entries, along their sub-events, jobs, and
+transitions, only if every entries deleted in cascade are part of the entries.
+Entries are checked and deleted within a single transaction holding the write
+lock, so entries added concurrently are never deleted. It returns the number of
+entries deleted.
+*/
+func (s *Store) PurgeEntries(tk *store.Toolkit, entries *store.Entries) (*store.Purged, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to purge entries",
+		Validations: []errors.Validation{},
+	}
+
+	purged := &store.Purged{}
+	if entries == nil {
+		return purged, nil
+	}
+
+	ids := entries.IDs()
+	err := s.exclusive(func(tx querier) error {
+		for _, id := range entries.Events {
+			c := tenantConditions(tk.Scope(nil))
+			c.add("e.id = ?", id)
+			cascade, covered, err := cascadeCovered(tx, c, ids)
+			if err != nil {
+				return err
+			}
+
+			if cascade.Events == 0 || !covered {
+				continue
+			}
+
+			if _, err := tx.Exec(`DELETE FROM events WHERE id = ?;`, id); err != nil {
+				return err
+			}
+
+			purged.Events += cascade.Events
+			purged.Jobs += cascade.Jobs
+			purged.Transitions += cascade.Transitions
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	return purged, nil
+}
+
+/*
+cascadeCovered returns the number of entries deleted when deleting the events
+matching the conditions, and reports if every one of them is part of the IDs
+passed.
+*/
+func cascadeCovered(tx querier, c *conditions, ids map[string]bool) (*store.Purged, bool, error) {
+	rows, err := tx.Query(fmt.Sprintf(cascadeOf, c.and()), c.args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer rows.Close()
+	cascade := &store.Purged{}
+	covered := true
+	for rows.Next() {
+		var kind, id string
+		if err := rows.Scan(&kind, &id); err != nil {
+			return nil, false, err
+		}
+
+		switch kind {
+		case "event":
+			cascade.Events++
+		case "job":
+			cascade.Jobs++
+		case "transition":
+			cascade.Transitions++
+		}
+
+		if !ids[id] {
+			covered = false
+		}
+	}
+
+	return cascade, covered, rows.Err()
+}
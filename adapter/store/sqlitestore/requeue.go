@@ -0,0 +1,111 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"github.com/segmentio/ksuid"
+)
+
+/*
+Requeue inserts a new "awaiting" transition for every jobs matching the constraints
+and having one of the store.RequeueStatuses. Offset, limit, and cursors are not
+applied. Everything is inserted within a single transaction. A transition is never
+created before the job's latest one, so it always becomes the job's latest
+transition.
+*/
+func (s *Store) Requeue(tk *store.Toolkit, where *store.WhereEvents, requeue *store.Requeue) ([]*store.Transition, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to requeue jobs",
+		Validations: []errors.Validation{},
+	}
+
+	if requeue == nil || requeue.TriggeredBy == "" {
+		fail.StatusCode = 400
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "TriggeredBy must be set",
+			Path:    []string{"Requeue", "TriggeredBy"},
+		})
+
+		return nil, fail
+	}
+
+	where = tk.Scope(where)
+	if err := s.validate(where); err != nil {
+		return nil, err
+	}
+
+	c := jobsWhere(where)
+	statuses := &conditions{}
+	statuses.in("lt.state_after", store.RequeueStatuses)
+	c.merge(statuses)
+
+	transitions := []*store.Transition{}
+	tenants := map[string]string{}
+	err := s.transaction(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT j.id, j.event_id, j.tenant, lt.attempt, lt.state_after, lt.created_at
+      `+jobsFrom+` WHERE `+c.and()+`
+      ORDER BY j.created_at ASC, j.id ASC;`, c.args...)
+
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for rows.Next() {
+			var before, tenant string
+			var latest int64
+			t := &store.Transition{
+				ID:          ksuid.New().String(),
+				StateAfter:  store.StatusAwaiting,
+				TriggeredBy: requeue.TriggeredBy,
+				CreatedAt:   now,
+			}
+
+			err := rows.Scan(&t.JobID, &t.EventID, &tenant, &t.Attempt, &before, &latest)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			tenants[t.JobID] = tenant
+			t.StateBefore = &before
+			if requeue.ResetAttempts {
+				t.Attempt = 0
+			}
+
+			if created := fromTimestamp(latest); now.Before(created) {
+				t.CreatedAt = created
+			}
+
+			transitions = append(transitions, t)
+		}
+
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, t := range transitions {
+			if err := insertTransition(tx, t, now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	s.notifier.NotifyTransitions(transitions, tenants)
+	return transitions, nil
+}
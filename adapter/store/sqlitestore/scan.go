@@ -0,0 +1,227 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+scanner is implemented by *sql.Row and *sql.Rows.
+*/
+type scanner interface {
+	Scan(...interface{}) error
+}
+
+/*
+eventColumns, jobColumns, and transitionColumns are the columns selected when
+looking for events, jobs, and transitions. They must be kept in sync with the
+scan functions.
+*/
+var eventColumns = `e.id, e.tenant, e.source, e."trigger", e.version, e.context, e.data,
+  e.parent_event_id, e.sent_at, e.received_at, e.ingested_at, e.idempotency_key`
+
+var jobColumns = `j.id, j.tenant, j.destination, j.action, j.version, j.context, j.data,
+  j.parent_job_id, j.event_id, j.priority, j.not_before, j.created_at`
+
+var transitionColumns = `%[1]s.id, %[1]s.attempt, %[1]s.state_before, %[1]s.state_after,
+  %[1]s.error, %[1]s.triggered_by, %[1]s.owner, %[1]s.lease_expires_at, %[1]s.event_id,
+  %[1]s.job_id, %[1]s.created_at`
+
+/*
+timestamp returns the representation of an instant in the database.
+*/
+func timestamp(t time.Time) int64 {
+	return t.UnixNano()
+}
+
+/*
+nullTimestamp returns the representation of an optional instant in the database.
+*/
+func nullTimestamp(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+
+	return timestamp(*t)
+}
+
+/*
+fromTimestamp returns the instant represented in the database, in UTC.
+*/
+func fromTimestamp(ns int64) time.Time {
+	return time.Unix(0, ns).UTC()
+}
+
+/*
+fromNullTimestamp returns the optional instant represented in the database.
+*/
+func fromNullTimestamp(ns sql.NullInt64) *time.Time {
+	if !ns.Valid {
+		return nil
+	}
+
+	t := fromTimestamp(ns.Int64)
+	return &t
+}
+
+/*
+fromNullString returns the optional string stored in the database.
+*/
+func fromNullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+
+	return &s.String
+}
+
+/*
+encodeError returns the representation of a transition's error in the database.
+Errors are marshaled as JSON by their Error function, so they can be decoded
+without losing any detail.
+*/
+func encodeError(err *errors.Error) interface{} {
+	if err == nil {
+		return nil
+	}
+
+	return err.Error()
+}
+
+/*
+decodeError returns the error of a transition stored in the database. Errors not
+stored as JSON are returned with their message only.
+*/
+func decodeError(s sql.NullString) *errors.Error {
+	if !s.Valid {
+		return nil
+	}
+
+	fail := &errors.Error{}
+	if err := json.Unmarshal([]byte(s.String), fail); err != nil {
+		fail.Message = s.String
+	}
+
+	return fail
+}
+
+/*
+scanEvent scans an event selected with eventColumns. Its context and data are
+decrypted if needed.
+*/
+func (s *Store) scanEvent(row scanner) (*store.Event, error) {
+	var e store.Event
+	var parent sql.NullString
+	var sent sql.NullInt64
+	var received, ingested int64
+
+	err := row.Scan(&e.ID, &e.Tenant, &e.Source, &e.Trigger, &e.Version, &e.Context, &e.Data,
+		&parent, &sent, &received, &ingested, &e.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Context, e.Data, err = s.unseal(e.Context, e.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	e.ParentEventID = fromNullString(parent)
+	e.SentAt = fromNullTimestamp(sent)
+	e.ReceivedAt = fromTimestamp(received)
+	ingestedAt := fromTimestamp(ingested)
+	e.IngestedAt = &ingestedAt
+	e.Jobs = []*store.Job{}
+	return &e, nil
+}
+
+/*
+scanJob scans a job selected with jobColumns, followed by the columns of its
+latest transition selected with transitionColumns. The transition columns can all
+be NULL if the job has no transition. Its context and data are decrypted if needed.
+*/
+func (s *Store) scanJob(row scanner) (*store.Job, error) {
+	var j store.Job
+	var parent sql.NullString
+	var notBefore sql.NullInt64
+	var created int64
+	var t nullTransition
+
+	err := row.Scan(&j.ID, &j.Tenant, &j.Destination, &j.Action, &j.Version, &j.Context, &j.Data,
+		&parent, &j.EventID, &j.Priority, &notBefore, &created,
+		&t.id, &t.attempt, &t.stateBefore, &t.stateAfter, &t.err, &t.triggeredBy, &t.owner, &t.leaseExpiresAt,
+		&t.eventID, &t.jobID, &t.createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	j.Context, j.Data, err = s.unseal(j.Context, j.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	j.ParentJobID = fromNullString(parent)
+	j.NotBefore = fromNullTimestamp(notBefore)
+	j.CreatedAt = fromTimestamp(created)
+	j.Transitions[0] = t.transition()
+	return &j, nil
+}
+
+/*
+scanTransition scans a transition selected with transitionColumns.
+*/
+func scanTransition(row scanner) (*store.Transition, error) {
+	var t nullTransition
+	err := row.Scan(&t.id, &t.attempt, &t.stateBefore, &t.stateAfter, &t.err, &t.triggeredBy, &t.owner, &t.leaseExpiresAt,
+		&t.eventID, &t.jobID, &t.createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.transition(), nil
+}
+
+/*
+nullTransition holds the columns of a transition that can be NULL when the
+transition is selected with a LEFT JOIN.
+*/
+type nullTransition struct {
+	id             sql.NullString
+	attempt        sql.NullInt64
+	stateBefore    sql.NullString
+	stateAfter     sql.NullString
+	err            sql.NullString
+	triggeredBy    sql.NullString
+	owner          sql.NullString
+	leaseExpiresAt sql.NullInt64
+	eventID        sql.NullString
+	jobID          sql.NullString
+	createdAt      sql.NullInt64
+}
+
+/*
+transition returns the transition scanned, or nil if there is none.
+*/
+func (t nullTransition) transition() *store.Transition {
+	if !t.id.Valid {
+		return nil
+	}
+
+	return &store.Transition{
+		ID:             t.id.String,
+		Attempt:        uint16(t.attempt.Int64),
+		StateBefore:    fromNullString(t.stateBefore),
+		StateAfter:     t.stateAfter.String,
+		Error:          decodeError(t.err),
+		TriggeredBy:    t.triggeredBy.String,
+		Owner:          t.owner.String,
+		LeaseExpiresAt: fromNullTimestamp(t.leaseExpiresAt),
+		CreatedAt:      fromTimestamp(t.createdAt.Int64),
+		EventID:        t.eventID.String,
+		JobID:          t.jobID.String,
+	}
+}
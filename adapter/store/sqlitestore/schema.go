@@ -0,0 +1,89 @@
+package sqlitestore
+
+/*
+schema is the SQL migration creating the tables of the store. It mirrors the one
+of the PostgreSQL driver. Timestamps are stored as UNIX nanoseconds in UTC so they
+can be sorted and compared without loss of precision.
+
+The view latest_transitions holds the latest transition of each job. When several
+transitions are created at the same instant, the last one inserted wins.
+*/
+var schema = `
+CREATE TABLE IF NOT EXISTS events (
+  id TEXT PRIMARY KEY,
+  tenant TEXT NOT NULL DEFAULT '',
+  source TEXT NOT NULL,
+  "trigger" TEXT NOT NULL,
+  version TEXT NOT NULL DEFAULT '',
+  context BLOB,
+  data BLOB,
+  parent_event_id TEXT REFERENCES events (id)
+    ON UPDATE CASCADE ON DELETE CASCADE
+    DEFERRABLE INITIALLY DEFERRED,
+  sent_at INTEGER,
+  received_at INTEGER NOT NULL,
+  ingested_at INTEGER NOT NULL,
+  idempotency_key TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS events_received_at ON events (received_at, id);
+CREATE INDEX IF NOT EXISTS events_tenant ON events (tenant, received_at, id);
+CREATE INDEX IF NOT EXISTS events_parent_event_id ON events (parent_event_id);
+CREATE INDEX IF NOT EXISTS events_idempotency_key ON events (source, idempotency_key, received_at)
+  WHERE idempotency_key != '';
+
+CREATE TABLE IF NOT EXISTS jobs (
+  id TEXT PRIMARY KEY,
+  tenant TEXT NOT NULL DEFAULT '',
+  destination TEXT NOT NULL,
+  action TEXT NOT NULL,
+  version TEXT NOT NULL DEFAULT '',
+  context BLOB,
+  data BLOB,
+  parent_job_id TEXT REFERENCES jobs (id)
+    ON UPDATE CASCADE ON DELETE CASCADE
+    DEFERRABLE INITIALLY DEFERRED,
+  event_id TEXT NOT NULL REFERENCES events (id)
+    ON UPDATE CASCADE ON DELETE CASCADE
+    DEFERRABLE INITIALLY DEFERRED,
+  priority INTEGER NOT NULL DEFAULT 0,
+  not_before INTEGER,
+  created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_event_id ON jobs (event_id);
+CREATE INDEX IF NOT EXISTS jobs_parent_job_id ON jobs (parent_job_id);
+CREATE INDEX IF NOT EXISTS jobs_created_at ON jobs (created_at, id);
+CREATE INDEX IF NOT EXISTS jobs_tenant ON jobs (tenant, created_at, id);
+CREATE INDEX IF NOT EXISTS jobs_priority ON jobs (priority DESC, created_at, id);
+
+CREATE TABLE IF NOT EXISTS transitions (
+  id TEXT PRIMARY KEY,
+  attempt INTEGER NOT NULL,
+  state_before TEXT,
+  state_after TEXT NOT NULL,
+  error TEXT,
+  triggered_by TEXT NOT NULL DEFAULT '',
+  owner TEXT NOT NULL DEFAULT '',
+  lease_expires_at INTEGER,
+  event_id TEXT NOT NULL REFERENCES events (id)
+    ON UPDATE CASCADE ON DELETE CASCADE
+    DEFERRABLE INITIALLY DEFERRED,
+  job_id TEXT NOT NULL REFERENCES jobs (id)
+    ON UPDATE CASCADE ON DELETE CASCADE
+    DEFERRABLE INITIALLY DEFERRED,
+  created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS transitions_job_id ON transitions (job_id, created_at);
+CREATE INDEX IF NOT EXISTS transitions_created_at ON transitions (created_at, id);
+
+CREATE VIEW IF NOT EXISTS latest_transitions AS
+  SELECT t.* FROM transitions AS t
+  WHERE t.rowid = (
+    SELECT l.rowid FROM transitions AS l
+    WHERE l.job_id = t.job_id
+    ORDER BY l.created_at DESC, l.rowid DESC
+    LIMIT 1
+  );
+`
@@ -0,0 +1,151 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	_ "modernc.org/sqlite"
+)
+
+/*
+DefaultLimit is the limit applied to queries when none is set in the constraints.
+*/
+var DefaultLimit uint64 = 100
+
+/*
+pragmas are the SQLite pragmas applied on every connections. Foreign keys must be
+enabled for cascading deletes, and the WAL journal allows concurrent reads while
+writing.
+*/
+var pragmas = []string{
+	"foreign_keys(1)",
+	"busy_timeout(5000)",
+	"journal_mode(WAL)",
+}
+
+/*
+Store implements the store.Store interface on top of a SQLite database.
+*/
+type Store struct {
+
+	// options are the options originally passed when creating the store.
+	options *store.Options
+
+	// db is the connection pool to the SQLite database.
+	db *sql.DB
+
+	// notifier dispatches notifications to the watchers of the store.
+	notifier store.Notifier
+}
+
+/*
+New returns a new SQLite store. The connection is the path to the database file,
+optionally prefixed by "file:". When empty, the environment variable
+`SQLITE_STORE_URL` is used. The database file and its schema are created if they
+do not exist.
+*/
+func New(opts *store.Options) (*Store, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to initialize store",
+		Validations: []errors.Validation{},
+	}
+
+	if opts == nil {
+		opts = &store.Options{}
+	}
+
+	if opts.PurgePolicies == nil {
+		opts.PurgePolicies = store.Defaults.PurgePolicies
+	}
+
+	if opts.IdempotencyWindow == 0 {
+		opts.IdempotencyWindow = store.Defaults.IdempotencyWindow
+	}
+
+	if opts.Connection == "" {
+		opts.Connection = os.Getenv("SQLITE_STORE_URL")
+	}
+
+	if opts.Connection == "" {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Connection must be set or SQLITE_STORE_URL must be present",
+			Path:    []string{"Options", "Store", "Connection"},
+		})
+
+		return nil, fail
+	}
+
+	opts.From = store.DriverSQLite
+	db, err := sql.Open("sqlite", dsn(opts.Connection))
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	_, err = db.Exec(schema)
+	if err != nil {
+		db.Close()
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	s := &Store{
+		options: opts,
+		db:      db,
+	}
+
+	return s, nil
+}
+
+/*
+String returns the string representation of the adapter.
+*/
+func (s *Store) String() string {
+	return string(store.DriverSQLite)
+}
+
+/*
+Options returns the options originally passed when creating the store.
+*/
+func (s *Store) Options() *store.Options {
+	return s.options
+}
+
+/*
+Close closes the connections to the database.
+*/
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+/*
+dsn returns the data source name given a connection string, with the pragmas
+required by the store.
+*/
+func dsn(connection string) string {
+	if !strings.HasPrefix(connection, "file:") {
+		connection = "file:" + connection
+	}
+
+	separator := "?"
+	if strings.Contains(connection, "?") {
+		separator = "&"
+	}
+
+	for _, pragma := range pragmas {
+		connection += separator + "_pragma=" + pragma
+		separator = "&"
+	}
+
+	return connection
+}
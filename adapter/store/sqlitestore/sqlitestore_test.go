@@ -0,0 +1,48 @@
+package sqlitestore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/adapter/store/storetest"
+)
+
+/*
+open returns a new store persisted in a temporary directory, closed once the test
+is done.
+*/
+func open(t *testing.T, opts *store.Options) *Store {
+	opts.Connection = filepath.Join(t.TempDir(), "store.db")
+	s, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	return s
+}
+
+/*
+TestSuite runs the conformance test suite against the SQLite store.
+*/
+func TestSuite(t *testing.T) {
+	storetest.RunSuite(t, func(t *testing.T) store.Store {
+		return open(t, &store.Options{})
+	})
+}
+
+/*
+TestEncryptionSuite runs the conformance test suite of encryption against the
+SQLite store.
+*/
+func TestEncryptionSuite(t *testing.T) {
+	storetest.RunEncryptionSuite(t, func(t *testing.T, enc store.Encryption) store.Store {
+		return open(t, &store.Options{
+			Encryption: enc,
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+Stats returns aggregates of the jobs matching the constraints, grouped by the
+dimensions and time buckets. Offset, limit, and cursors are not applied. Rows are
+streamed from the database and aggregated on the fly, so percentiles can be
+computed.
+*/
+func (s *Store) Stats(tk *store.Toolkit, where *store.WhereEvents, groupBy []store.Dimension, bucket time.Duration) ([]*store.Stat, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to compute statistics",
+		Validations: []errors.Validation{},
+	}
+
+	aggregator, err := store.NewStatsAggregator(groupBy, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	where = tk.Scope(where)
+	if err := s.validate(where); err != nil {
+		return nil, err
+	}
+
+	c := jobsWhere(where)
+	rows, err := s.db.Query(`SELECT e.tenant, e.source, e."trigger", j.destination, j.action,
+    lt.state_after, e.received_at, j.created_at, lt.created_at
+    `+jobsFrom+` WHERE `+c.and()+`;`, c.args...)
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var sample store.StatsSample
+		var status sql.NullString
+		var received, created int64
+		var updated sql.NullInt64
+		err := rows.Scan(&sample.Tenant, &sample.Source, &sample.Trigger, &sample.Destination, &sample.Action,
+			&status, &received, &created, &updated)
+
+		if err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: err.Error(),
+			})
+
+			return nil, fail
+		}
+
+		sample.Status = status.String
+		sample.ReceivedAt = fromTimestamp(received)
+		sample.CreatedAt = fromTimestamp(created)
+		if updated.Valid {
+			sample.UpdatedAt = fromTimestamp(updated.Int64)
+		}
+
+		aggregator.Add(&sample)
+	}
+
+	if err := rows.Err(); err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	return aggregator.Stats(), nil
+}
@@ -0,0 +1,283 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+	"github.com/nunchistudio/blacksmith/helper/rest"
+)
+
+/*
+AddTransitions inserts a list of transitions into the store. The event ID of each
+transition is set from its job. Everything is inserted within a single transaction
+holding the write lock, so transitions on a job claimed with ClaimJobs are checked
+against its owner and lease without being raced by a claim or an expiry.
+*/
+func (s *Store) AddTransitions(tk *store.Toolkit, transitions []*store.Transition) error {
+	return s.addTransitions(tk, transitions, "store/sqlite: Failed to add transitions", true)
+}
+
+/*
+RestoreTransitions inserts a list of transitions into the store as part of the
+history of their job. The event ID of each transition is set from its job. Claims
+and leases are restored as is.
+*/
+func (s *Store) RestoreTransitions(tk *store.Toolkit, transitions []*store.Transition) error {
+	return s.addTransitions(tk, transitions, "store/sqlite: Failed to restore transitions", false)
+}
+
+/*
+addTransitions inserts a list of transitions into the store within a single
+transaction. Transitions are checked against the owner and lease of their job
+only if owned is true.
+*/
+func (s *Store) addTransitions(tk *store.Toolkit, transitions []*store.Transition, message string, owned bool) error {
+	fail := &errors.Error{
+		Message:     message,
+		Validations: []errors.Validation{},
+	}
+
+	inserted := []*store.Transition{}
+	tenants := map[string]string{}
+	err := s.exclusive(func(tx querier) error {
+		now := time.Now().UTC()
+		for _, t := range transitions {
+			transition := *t
+			var tenant string
+			err := tx.QueryRow(`SELECT event_id, tenant FROM jobs WHERE id = ?;`, t.JobID).Scan(&transition.EventID, &tenant)
+			if err == sql.ErrNoRows || (err == nil && !tk.Owns(tenant)) {
+				return fmt.Errorf("job %q does not exist", t.JobID)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if owned {
+				latest, err := latestTransition(tx, t.JobID)
+				if err != nil {
+					return err
+				}
+
+				if validations := store.ValidateTransition(latest, t, now); len(validations) > 0 {
+					return &errors.Error{
+						StatusCode:  409,
+						Message:     fail.Message,
+						Validations: validations,
+					}
+				}
+			}
+
+			tenants[t.JobID] = tenant
+			if err := insertTransition(tx, &transition, now); err != nil {
+				return err
+			}
+
+			inserted = append(inserted, &transition)
+		}
+
+		return nil
+	})
+
+	if conflict, ok := err.(*errors.Error); ok {
+		return conflict
+	}
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return fail
+	}
+
+	s.notifier.NotifyTransitions(inserted, tenants)
+	return nil
+}
+
+/*
+latestTransition returns the latest transition of a job within a transaction, or
+nil if the job has none.
+*/
+func latestTransition(tx querier, jobID string) (*store.Transition, error) {
+	row := tx.QueryRow(`SELECT `+fmt.Sprintf(transitionColumns, "lt")+`
+    FROM latest_transitions AS lt WHERE lt.job_id = ?;`, jobID)
+
+	t, err := scanTransition(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return t, err
+}
+
+/*
+FindTransition returns a transition given its ID.
+*/
+func (s *Store) FindTransition(tk *store.Toolkit, id string) (*store.Transition, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to find transition",
+		Validations: []errors.Validation{},
+	}
+
+	c := tenantConditions(tk.Scope(nil))
+	c.add("t.id = ?", id)
+	row := s.db.QueryRow(`SELECT `+fmt.Sprintf(transitionColumns, "t")+` `+transitionsFrom+`
+    WHERE `+c.and()+`;`, c.args...)
+
+	t, err := scanTransition(row)
+	if err == sql.ErrNoRows {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/sqlite: Transition not found",
+		}
+	}
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	return t, nil
+}
+
+/*
+FindTransitions returns a list of transitions matching the constraints.
+*/
+func (s *Store) FindTransitions(tk *store.Toolkit, where *store.WhereEvents) ([]*store.Transition, *store.Meta, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to find transitions",
+		Validations: []errors.Validation{},
+	}
+
+	where = applied(tk.Scope(where))
+	if err := s.validate(where); err != nil {
+		return nil, nil, err
+	}
+
+	c := transitionsWhere(where)
+
+	var count uint64
+	err := s.db.QueryRow(`SELECT COUNT(*) `+transitionsFrom+` WHERE `+c.and()+`;`, c.args...).Scan(&count)
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, nil, fail
+	}
+
+	transitions, err := s.pageTransitions(c, where)
+	if _, ok := err.(*errors.Error); ok {
+		return nil, nil, err
+	}
+
+	var cursors *rest.Cursors
+	if err == nil {
+		var first, last *rest.Cursor
+		if len(transitions) > 0 {
+			first = &rest.Cursor{At: transitions[0].CreatedAt, ID: transitions[0].ID}
+			last = &rest.Cursor{At: transitions[len(transitions)-1].CreatedAt, ID: transitions[len(transitions)-1].ID}
+		}
+
+		cursors, err = s.cursors(transitionsKeyset, transitionsFrom, c, first, last)
+	}
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, nil, fail
+	}
+
+	meta := &store.Meta{
+		Count:      count,
+		Pagination: pageOf(count, where),
+		Cursors:    cursors,
+		Where:      where,
+	}
+
+	return transitions, meta, nil
+}
+
+/*
+pageTransitions returns the transitions matching the conditions within the window
+defined by the offset, limit, and cursors of the constraints. A malformed cursor
+is returned as an *errors.Error.
+*/
+func (s *Store) pageTransitions(c *conditions, where *store.WhereEvents) ([]*store.Transition, error) {
+	w, clause, extra, reverse, err := transitionsKeyset.window(where)
+	if err != nil {
+		return nil, err
+	}
+
+	paged := &conditions{}
+	paged.merge(c)
+	paged.merge(w)
+	args := append(append([]interface{}{}, paged.args...), extra...)
+	transitions, err := s.queryTransitions(`SELECT `+fmt.Sprintf(transitionColumns, "t")+` `+transitionsFrom+`
+    WHERE `+paged.and()+clause+`;`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if reverse {
+		for i, j := 0, len(transitions)-1; i < j; i, j = i+1, j-1 {
+			transitions[i], transitions[j] = transitions[j], transitions[i]
+		}
+	}
+
+	return transitions, nil
+}
+
+/*
+queryTransitions runs a query selecting transitionColumns and returns the
+transitions scanned.
+*/
+func (s *Store) queryTransitions(query string, args ...interface{}) ([]*store.Transition, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	transitions := []*store.Transition{}
+	for rows.Next() {
+		t, err := scanTransition(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		transitions = append(transitions, t)
+	}
+
+	return transitions, rows.Err()
+}
+
+/*
+insertTransition inserts a transition within a transaction. Its creation date is
+set to now if not set.
+*/
+func insertTransition(tx querier, t *store.Transition, now time.Time) error {
+	created := t.CreatedAt
+	if created.IsZero() {
+		created = now
+	}
+
+	_, err := tx.Exec(`INSERT INTO transitions (id, attempt, state_before, state_after,
+    error, triggered_by, owner, lease_expires_at, event_id, job_id, created_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		t.ID, t.Attempt, t.StateBefore, t.StateAfter,
+		encodeError(t.Error), t.TriggeredBy, t.Owner, nullTimestamp(t.LeaseExpiresAt), t.EventID, t.JobID, timestamp(created),
+	)
+
+	return err
+}
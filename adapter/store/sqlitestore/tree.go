@@ -0,0 +1,76 @@
+package sqlitestore
+
+import (
+	"fmt"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+eventsTree is the recursive CTE holding the IDs of an event and its descendants.
+*/
+const eventsTree = `events_tree (id) AS (
+    SELECT id FROM events WHERE id = ?
+    UNION
+    SELECT e.id FROM events AS e
+    INNER JOIN events_tree AS et ON e.parent_event_id = et.id
+  )`
+
+/*
+jobsTree is the recursive CTE holding the IDs of the jobs of the events in the
+eventsTree and their descendants.
+*/
+const jobsTree = `jobs_tree (id) AS (
+    SELECT id FROM jobs WHERE event_id IN (SELECT id FROM events_tree)
+    UNION
+    SELECT j.id FROM jobs AS j
+    INNER JOIN jobs_tree AS jt ON j.parent_job_id = jt.id
+  )`
+
+/*
+FindEventTree returns the lineage of an event: the event, its sub-events, and all
+their jobs and child jobs with their latest transition, recursively.
+*/
+func (s *Store) FindEventTree(tk *store.Toolkit, id string) (*store.EventTree, error) {
+	fail := &errors.Error{
+		Message:     "store/sqlite: Failed to find event tree",
+		Validations: []errors.Validation{},
+	}
+
+	events, err := s.queryEvents(`WITH RECURSIVE `+eventsTree+`
+    SELECT `+eventColumns+` FROM events AS e
+    WHERE e.id IN (SELECT id FROM events_tree);`, id)
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	// Sub-events always belong to the tenant of their parent event, so any event of
+	// the tree can be used to check the tenant.
+	if len(events) == 0 || !tk.Owns(events[0].Tenant) {
+		return nil, &errors.Error{
+			StatusCode: 404,
+			Message:    "store/sqlite: Event not found",
+		}
+	}
+
+	jobs, err := s.queryJobs(`WITH RECURSIVE `+eventsTree+`, `+jobsTree+`
+    SELECT `+jobColumns+`, `+fmt.Sprintf(transitionColumns, "lt")+` FROM jobs AS j
+    LEFT JOIN latest_transitions AS lt ON lt.job_id = j.id
+    WHERE j.id IN (SELECT id FROM jobs_tree);`, id)
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	return store.NewEventTree(id, events, jobs), nil
+}
@@ -0,0 +1,22 @@
+package sqlitestore
+
+import (
+	"context"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+Watch implements the store.Watcher interface. It returns a channel receiving a
+notification for every entries added into the store until the context is done.
+Notifications are scoped to the tenant of the toolkit, if any. Only the entries
+added through this store, in this process, are notified.
+*/
+func (s *Store) Watch(ctx context.Context, tk *store.Toolkit) (<-chan *store.Notification, error) {
+	tenant := ""
+	if tk != nil {
+		tenant = tk.Tenant
+	}
+
+	return s.notifier.Watch(ctx, tenant), nil
+}
@@ -0,0 +1,443 @@
+package sqlitestore
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+conditions holds SQL conditions and their arguments.
+*/
+type conditions struct {
+	clauses []string
+	args    []interface{}
+}
+
+/*
+add adds a condition along its arguments.
+*/
+func (c *conditions) add(clause string, args ...interface{}) {
+	c.clauses = append(c.clauses, clause)
+	c.args = append(c.args, args...)
+}
+
+/*
+in adds a condition making sure the column has any of the values. It is ignored
+when no values are passed.
+*/
+func (c *conditions) in(column string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+
+	args := []interface{}{}
+	for _, v := range values {
+		args = append(args, v)
+	}
+
+	c.add(column+" IN ("+placeholders(len(values))+")", args...)
+}
+
+/*
+notIn adds a condition making sure the column has none of the values. It is
+ignored when no values are passed.
+*/
+func (c *conditions) notIn(column string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+
+	args := []interface{}{}
+	for _, v := range values {
+		args = append(args, v)
+	}
+
+	c.add(column+" NOT IN ("+placeholders(len(values))+")", args...)
+}
+
+/*
+predicate adds a condition making sure the JSON payload of a table matches the
+predicate. Payloads which are not a valid JSON never match. The predicate must be
+valid.
+*/
+func (c *conditions) predicate(table string, p *store.Predicate) {
+	column := "CAST(" + table + ".data AS TEXT)"
+	if p.Field == store.FieldContext {
+		column = "CAST(" + table + ".context AS TEXT)"
+	}
+
+	path := p.JSONPath()
+	typeOf := "(CASE WHEN json_valid(" + column + ") THEN json_type(" + column + ", ?) END)"
+	valueOf := "(CASE WHEN json_valid(" + column + ") THEN json_extract(" + column + ", ?) END)"
+	values, _ := p.Scalars()
+	switch p.Operator {
+	case store.OperatorExists:
+		c.add(typeOf+" IS NOT NULL", path)
+
+	case store.OperatorEquals, store.OperatorIn:
+		alternatives := &conditions{}
+		for _, v := range values {
+			switch value := v.(type) {
+			case nil:
+				alternatives.add(typeOf+" = 'null'", path)
+			case bool:
+				if value {
+					alternatives.add(typeOf+" = 'true'", path)
+				} else {
+					alternatives.add(typeOf+" = 'false'", path)
+				}
+			case float64:
+				alternatives.add("("+typeOf+" IN ('integer', 'real') AND "+valueOf+" = ?)", path, path, value)
+			case string:
+				alternatives.add("("+typeOf+" = 'text' AND "+valueOf+" = ?)", path, path, value)
+			}
+		}
+
+		c.add(alternatives.or(), alternatives.args...)
+
+	case store.OperatorRange:
+		bounds := &conditions{}
+		bound := values[0]
+		if bound == nil {
+			bound = values[1]
+		}
+
+		if _, ok := bound.(float64); ok {
+			bounds.add(typeOf+" IN ('integer', 'real')", path)
+		} else {
+			bounds.add(typeOf+" = 'text'", path)
+		}
+
+		if values[0] != nil {
+			bounds.add(valueOf+" >= ?", path, values[0])
+		}
+
+		if values[1] != nil {
+			bounds.add(valueOf+" <= ?", path, values[1])
+		}
+
+		c.add(bounds.and(), bounds.args...)
+	}
+}
+
+/*
+merge adds the conditions of another set of conditions.
+*/
+func (c *conditions) merge(other *conditions) {
+	c.clauses = append(c.clauses, other.clauses...)
+	c.args = append(c.args, other.args...)
+}
+
+/*
+and returns the conditions joined by AND. It returns a condition always true when
+there is no condition.
+*/
+func (c *conditions) and() string {
+	if len(c.clauses) == 0 {
+		return "1 = 1"
+	}
+
+	return "(" + strings.Join(c.clauses, " AND ") + ")"
+}
+
+/*
+or returns the conditions joined by OR. It returns a condition always false when
+there is no condition.
+*/
+func (c *conditions) or() string {
+	if len(c.clauses) == 0 {
+		return "1 = 0"
+	}
+
+	return "(" + strings.Join(c.clauses, " OR ") + ")"
+}
+
+/*
+placeholders returns n comma separated placeholders.
+*/
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+/*
+applied returns a copy of the constraints with the defaults applied, as they are
+returned in the query's meta.
+*/
+func applied(where *store.WhereEvents) *store.WhereEvents {
+	out := &store.WhereEvents{}
+	if where != nil {
+		*out = *where
+	}
+
+	if out.Limit == 0 {
+		out.Limit = DefaultLimit
+	}
+
+	return out
+}
+
+/*
+validate makes sure the constraints can be applied. Since predicates are evaluated
+by the database, they can not be applied when payloads are encrypted.
+*/
+func (s *Store) validate(where *store.WhereEvents) error {
+	if err := where.Validate(); err != nil {
+		return err
+	}
+
+	if s.options.Encryption != nil && where.HasPredicates() {
+		return &errors.Error{
+			StatusCode: 400,
+			Message:    "store/sqlite: Failed to validate constraints",
+			Validations: []errors.Validation{
+				{
+					Message: "Predicates can not be applied on encrypted payloads",
+					Path:    []string{"WhereEvents", "Predicates"},
+				},
+			},
+		}
+	}
+
+	return nil
+}
+
+/*
+tenantConditions returns the conditions on the tenant of events, applied on the
+table aliased "e". Unlike other constraints, they are also applied when looking
+for entries of a specific event or job.
+*/
+func tenantConditions(where *store.WhereEvents) *conditions {
+	c := &conditions{}
+	if where == nil {
+		return c
+	}
+
+	c.in("e.tenant", where.TenantsIn)
+	c.notIn("e.tenant", where.TenantsNotIn)
+	return c
+}
+
+/*
+eventConditions returns the conditions at the event level, applied on the table
+aliased "e".
+*/
+func eventConditions(where *store.WhereEvents) *conditions {
+	c := tenantConditions(where)
+	if where == nil {
+		return c
+	}
+
+	c.in("e.source", where.SourcesIn)
+	c.notIn("e.source", where.SourcesNotIn)
+	c.in(`e."trigger"`, where.TriggersIn)
+	c.notIn(`e."trigger"`, where.TriggersNotIn)
+	c.in("e.version", where.VersionsIn)
+	c.notIn("e.version", where.VersionsNotIn)
+
+	if where.ReceivedBefore != nil {
+		c.add("e.received_at < ?", timestamp(*where.ReceivedBefore))
+	}
+
+	if where.ReceivedAfter != nil {
+		c.add("e.received_at > ?", timestamp(*where.ReceivedAfter))
+	}
+
+	now := time.Now()
+	if where.OlderThan > 0 {
+		c.add("e.received_at < ?", timestamp(now.Add(-where.OlderThan)))
+	}
+
+	if where.NewerThan > 0 {
+		c.add("e.received_at > ?", timestamp(now.Add(-where.NewerThan)))
+	}
+
+	for _, p := range where.Predicates {
+		c.predicate("e", p)
+	}
+
+	return c
+}
+
+/*
+inclusions returns the inclusion conditions at the job level, applied on the table
+aliased "j" and on the transition table aliased t. A job without transition has
+no status and zero attempt.
+*/
+func inclusions(where *store.WhereJobs, t string) *conditions {
+	c := &conditions{}
+	c.in("j.destination", where.DestinationsIn)
+	c.in("j.action", where.ActionsIn)
+	c.in("j.version", where.VersionsIn)
+
+	if where.CreatedBefore != nil {
+		c.add("j.created_at < ?", timestamp(*where.CreatedBefore))
+	}
+
+	if where.CreatedAfter != nil {
+		c.add("j.created_at > ?", timestamp(*where.CreatedAfter))
+	}
+
+	if where.MinPriority != nil {
+		c.add("j.priority >= ?", *where.MinPriority)
+	}
+
+	if where.MaxPriority != nil {
+		c.add("j.priority <= ?", *where.MaxPriority)
+	}
+
+	if where.ReadyAt != nil {
+		c.add("(j.not_before IS NULL OR j.not_before <= ?)", timestamp(*where.ReadyAt))
+	}
+
+	for _, p := range where.Predicates {
+		c.predicate("j", p)
+	}
+
+	if wt := where.AndWhereTransitions; wt != nil {
+		c.in(t+".state_after", wt.StatusIn)
+
+		if wt.MinAttempts > 0 {
+			c.add("COALESCE("+t+".attempt, 0) >= ?", wt.MinAttempts)
+		}
+
+		if wt.MaxAttempts > 0 {
+			c.add("COALESCE("+t+".attempt, 0) <= ?", wt.MaxAttempts)
+		}
+	}
+
+	return c
+}
+
+/*
+exclusions returns the exclusion conditions at the job level, applied on the table
+aliased "j" and on the transition table aliased t. They shall be joined with OR.
+A job without transition is never excluded given its status.
+*/
+func exclusions(where *store.WhereJobs, t string) *conditions {
+	c := &conditions{}
+	c.in("j.destination", where.DestinationsNotIn)
+	c.in("j.action", where.ActionsNotIn)
+	c.in("j.version", where.VersionsNotIn)
+
+	if wt := where.AndWhereTransitions; wt != nil {
+		c.in("COALESCE("+t+".state_after, '')", wt.StatusNotIn)
+	}
+
+	return c
+}
+
+/*
+eventsWhere returns the conditions to find events, applied on the table aliased
+"e". An event matches the constraints on jobs if at least one of its jobs matches
+all the inclusion conditions and none of its jobs matches an exclusion condition.
+*/
+func eventsWhere(where *store.WhereEvents) *conditions {
+	if where != nil && where.AndWhereJobs != nil {
+		wj := where.AndWhereJobs
+		if wj.EventID != "" {
+			c := tenantConditions(where)
+			c.add("e.id = ?", wj.EventID)
+			return c
+		}
+
+		if wt := wj.AndWhereTransitions; wt != nil && wt.JobID != "" {
+			c := tenantConditions(where)
+			c.add("EXISTS (SELECT 1 FROM jobs AS j WHERE j.id = ? AND j.event_id = e.id)", wt.JobID)
+			return c
+		}
+	}
+
+	c := eventConditions(where)
+	if where == nil || where.AndWhereJobs == nil {
+		return c
+	}
+
+	from := `SELECT 1 FROM jobs AS j
+    LEFT JOIN latest_transitions AS lt ON lt.job_id = j.id
+    WHERE j.event_id = e.id`
+
+	in := inclusions(where.AndWhereJobs, "lt")
+	if len(in.clauses) > 0 {
+		c.add("EXISTS ("+from+" AND "+in.and()+")", in.args...)
+	}
+
+	out := exclusions(where.AndWhereJobs, "lt")
+	if len(out.clauses) > 0 {
+		c.add("NOT EXISTS ("+from+" AND "+out.or()+")", out.args...)
+	}
+
+	return c
+}
+
+/*
+jobsWhere returns the conditions to find jobs, applied on the tables aliased "j"
+for jobs, "e" for their event, and "lt" for their latest transition.
+*/
+func jobsWhere(where *store.WhereEvents) *conditions {
+	if where != nil && where.AndWhereJobs != nil {
+		wj := where.AndWhereJobs
+		if wj.EventID != "" {
+			c := tenantConditions(where)
+			c.add("j.event_id = ?", wj.EventID)
+			return c
+		}
+
+		if wt := wj.AndWhereTransitions; wt != nil && wt.JobID != "" {
+			c := tenantConditions(where)
+			c.add("j.id = ?", wt.JobID)
+			return c
+		}
+	}
+
+	c := eventConditions(where)
+	if where == nil || where.AndWhereJobs == nil {
+		return c
+	}
+
+	c.merge(inclusions(where.AndWhereJobs, "lt"))
+	out := exclusions(where.AndWhereJobs, "lt")
+	if len(out.clauses) > 0 {
+		c.add("NOT "+out.or(), out.args...)
+	}
+
+	return c
+}
+
+/*
+transitionsWhere returns the conditions to find transitions, applied on the tables
+aliased "t" for transitions, "j" for their job, and "e" for their event. Unlike
+events and jobs, the constraints on status and attempts are applied on the
+transition itself and not on the job's latest transition.
+*/
+func transitionsWhere(where *store.WhereEvents) *conditions {
+	if where != nil && where.AndWhereJobs != nil {
+		wj := where.AndWhereJobs
+		if wj.EventID != "" {
+			c := tenantConditions(where)
+			c.add("t.event_id = ?", wj.EventID)
+			return c
+		}
+
+		if wt := wj.AndWhereTransitions; wt != nil && wt.JobID != "" {
+			c := tenantConditions(where)
+			c.add("t.job_id = ?", wt.JobID)
+			return c
+		}
+	}
+
+	c := eventConditions(where)
+	if where == nil || where.AndWhereJobs == nil {
+		return c
+	}
+
+	c.merge(inclusions(where.AndWhereJobs, "t"))
+	out := exclusions(where.AndWhereJobs, "t")
+	if len(out.clauses) > 0 {
+		c.add("NOT "+out.or(), out.args...)
+	}
+
+	return c
+}
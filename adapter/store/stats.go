@@ -0,0 +1,279 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+Dimension is a custom type allowing the user to only pass supported dimensions
+when grouping statistics.
+*/
+type Dimension string
+
+/*
+DimensionSource groups statistics by the source of the events.
+*/
+var DimensionSource Dimension = "source"
+
+/*
+DimensionTrigger groups statistics by the trigger of the events.
+*/
+var DimensionTrigger Dimension = "trigger"
+
+/*
+DimensionDestination groups statistics by the destination of the jobs.
+*/
+var DimensionDestination Dimension = "destination"
+
+/*
+DimensionAction groups statistics by the action of the jobs.
+*/
+var DimensionAction Dimension = "action"
+
+/*
+DimensionStatus groups statistics by the status of the jobs, which is the status
+of their latest transition.
+*/
+var DimensionStatus Dimension = "status"
+
+/*
+DimensionTenant groups statistics by the tenant of the jobs.
+*/
+var DimensionTenant Dimension = "tenant"
+
+/*
+Stat is an aggregate of the jobs created within a time bucket, for a given group
+of dimensions.
+*/
+type Stat struct {
+
+	// Bucket is the beginning of the time bucket, given the creation date of the
+	// jobs. It is zero when no bucket is applied.
+	Bucket time.Time `json:"bucket"`
+
+	// Group holds the value of each dimension the statistics are grouped by.
+	//
+	// Example: {"destination": "my-destination", "status": "succeeded"}
+	Group map[Dimension]string `json:"group"`
+
+	// Count is the number of jobs in the bucket and group.
+	Count uint64 `json:"count"`
+
+	// Latency is the distribution of the time taken from the reception of the
+	// events to the success of their jobs. It is nil when no job has succeeded
+	// in the bucket and group.
+	Latency *Latency `json:"latency,omitempty"`
+}
+
+/*
+Latency is the distribution of durations within a bucket and group.
+*/
+type Latency struct {
+
+	// Min and Max are the shortest and longest durations.
+	Min time.Duration `json:"min"`
+	Max time.Duration `json:"max"`
+
+	// Avg is the average duration.
+	Avg time.Duration `json:"avg"`
+
+	// P50, P95, and P99 are the 50th, 95th, and 99th percentiles of the durations.
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+}
+
+/*
+StatsSample is the details of a single job used to compute statistics.
+*/
+type StatsSample struct {
+
+	// Tenant is the one of the job.
+	Tenant string
+
+	// Source and Trigger are the ones of the job's event.
+	Source  string
+	Trigger string
+
+	// Destination and Action are the ones of the job.
+	Destination string
+	Action      string
+
+	// Status is the status of the job's latest transition. It is empty when the
+	// job has no transition.
+	Status string
+
+	// ReceivedAt is the reception date of the job's event.
+	ReceivedAt time.Time
+
+	// CreatedAt is the creation date of the job.
+	CreatedAt time.Time
+
+	// UpdatedAt is the creation date of the job's latest transition. It is zero
+	// when the job has no transition.
+	UpdatedAt time.Time
+}
+
+/*
+StatsAggregator computes statistics from jobs' samples. It can be leveraged by
+drivers to implement the Stats method of the Store interface when aggregates can
+not be computed by the datastore itself.
+*/
+type StatsAggregator struct {
+	groupBy []Dimension
+	bucket  time.Duration
+	stats   map[string]*Stat
+	latency map[string][]time.Duration
+}
+
+/*
+NewStatsAggregator returns a new aggregator given the dimensions to group by and
+the duration of the time buckets. It returns an error if a dimension is not
+supported or if the bucket is negative. A bucket of zero means no bucket is
+applied.
+*/
+func NewStatsAggregator(groupBy []Dimension, bucket time.Duration) (*StatsAggregator, error) {
+	fail := &errors.Error{
+		StatusCode:  400,
+		Message:     "Failed to compute statistics",
+		Validations: []errors.Validation{},
+	}
+
+	for _, d := range groupBy {
+		switch d {
+		case DimensionSource, DimensionTrigger, DimensionDestination, DimensionAction, DimensionStatus, DimensionTenant:
+		default:
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: "Dimension not supported",
+				Path:    []string{"GroupBy", string(d)},
+			})
+		}
+	}
+
+	if bucket < 0 {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Bucket must not be negative",
+			Path:    []string{"Bucket"},
+		})
+	}
+
+	if len(fail.Validations) > 0 {
+		return nil, fail
+	}
+
+	a := &StatsAggregator{
+		groupBy: groupBy,
+		bucket:  bucket,
+		stats:   map[string]*Stat{},
+		latency: map[string][]time.Duration{},
+	}
+
+	return a, nil
+}
+
+/*
+Add adds a job's sample to the statistics.
+*/
+func (a *StatsAggregator) Add(sample *StatsSample) {
+	var bucket time.Time
+	if a.bucket > 0 {
+		bucket = sample.CreatedAt.UTC().Truncate(a.bucket)
+	}
+
+	group := map[Dimension]string{}
+	key := []string{bucket.Format("2006-01-02T15:04:05.000000000")}
+	for _, d := range a.groupBy {
+		switch d {
+		case DimensionSource:
+			group[d] = sample.Source
+		case DimensionTrigger:
+			group[d] = sample.Trigger
+		case DimensionDestination:
+			group[d] = sample.Destination
+		case DimensionAction:
+			group[d] = sample.Action
+		case DimensionStatus:
+			group[d] = sample.Status
+		case DimensionTenant:
+			group[d] = sample.Tenant
+		}
+
+		key = append(key, group[d])
+	}
+
+	id := strings.Join(key, "\x00")
+	stat := a.stats[id]
+	if stat == nil {
+		stat = &Stat{
+			Bucket: bucket,
+			Group:  group,
+		}
+
+		a.stats[id] = stat
+	}
+
+	stat.Count++
+	if sample.Status == StatusSucceeded && !sample.UpdatedAt.IsZero() {
+		a.latency[id] = append(a.latency[id], sample.UpdatedAt.Sub(sample.ReceivedAt))
+	}
+}
+
+/*
+Stats returns the statistics computed, ordered by bucket and then by group.
+*/
+func (a *StatsAggregator) Stats() []*Stat {
+	ids := []string{}
+	for id := range a.stats {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	stats := []*Stat{}
+	for _, id := range ids {
+		stat := a.stats[id]
+		if durations := a.latency[id]; len(durations) > 0 {
+			stat.Latency = distribution(durations)
+		}
+
+		stats = append(stats, stat)
+	}
+
+	return stats
+}
+
+/*
+distribution returns the distribution of durations. Percentiles are computed
+with the nearest-rank method.
+*/
+func distribution(durations []time.Duration) *Latency {
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+
+	rank := func(p int) time.Duration {
+		n := (p*len(durations) + 99) / 100
+		if n < 1 {
+			n = 1
+		}
+
+		return durations[n-1]
+	}
+
+	return &Latency{
+		Min: durations[0],
+		Max: durations[len(durations)-1],
+		Avg: total / time.Duration(len(durations)),
+		P50: rank(50),
+		P95: rank(95),
+		P99: rank(99),
+	}
+}
@@ -1,5 +1,9 @@
 package store
 
+import (
+	"time"
+)
+
 /*
 InterfaceStore is the string representation for the store interface.
 */
@@ -8,6 +12,9 @@ var InterfaceStore = "store"
 /*
 Store is the interface used to persist the jobs queue in a datastore to keep track
 of jobs states.
+
+Drivers can make sure they respect the contract of this interface by running the
+conformance test suite available in the package storetest.
 */
 type Store interface {
 
@@ -21,12 +28,28 @@ type Store interface {
 	Options() *Options
 
 	// AddEvents inserts a queue of events into the datastore given the data passed
-	// in params. It returns an error if any occurred.
+	// in params. It returns an error if any occurred. Events having an idempotency
+	// key already used within the idempotency window are detected atomically with
+	// Deduplicate: they are not inserted, and their ID is replaced by the one of
+	// their original event once the queue has been inserted.
 	AddEvents(*Toolkit, []*Event) error
 
 	// FindEvent returns a event given the event ID passed in params.
 	FindEvent(*Toolkit, string) (*Event, error)
 
+	// FindEventTree returns the lineage of an event given the event ID passed in
+	// params: the event, its sub-events, and all their jobs and child jobs with
+	// their latest transition, recursively.
+	FindEventTree(*Toolkit, string) (*EventTree, error)
+
+	// FindEventByIdempotencyKey returns the latest event of a tenant and source
+	// having the idempotency key passed in params, and received within the
+	// idempotency window set in the store's options. Keys are scoped by tenant, as
+	// done by AddEvents. It returns a 404 error if there is none, meaning the event
+	// is not a duplicate. Since an event can be added concurrently, this shall only
+	// be used for reading: AddEvents detects duplicates by itself.
+	FindEventByIdempotencyKey(*Toolkit, string, string, string) (*Event, error)
+
 	// FindEvents returns a list of events matching the constraints passed in params.
 	// It also returns meta information about the query, such as pagination and the
 	// constraints actually applied to it.
@@ -38,6 +61,10 @@ type Store interface {
 	// FindJob returns a job given the job ID passed in params.
 	FindJob(*Toolkit, string) (*Job, error)
 
+	// FindJobHistory returns a job given the job ID passed in params, including its
+	// latest transition and the complete history of its transitions.
+	FindJobHistory(*Toolkit, string) (*Job, error)
+
 	// FindJobs returns a list of jobs matching the constraints passed in params.
 	// It also returns meta information about the query, such as pagination and the
 	// constraints actually applied to it.
@@ -46,8 +73,18 @@ type Store interface {
 	// AddTransitions inserts a list of transitions into the datastore to update
 	// their related job status. We insert new transitions instead of updating the
 	// job itself to keep track of the job's history.
+	//
+	// A job claimed with ClaimJobs only accepts transitions made on behalf of its
+	// owner, with the Owner set, while its lease has not expired. It returns a 409
+	// error otherwise, and no transition is inserted.
 	AddTransitions(*Toolkit, []*Transition) error
 
+	// RestoreTransitions inserts a list of transitions into the datastore as part
+	// of the history of their job, such as when restoring an archive. Unlike with
+	// AddTransitions, transitions are not made on behalf of an owner: the claims and
+	// leases they hold are restored as is.
+	RestoreTransitions(*Toolkit, []*Transition) error
+
 	// FindTransition returns a transition given the transition ID passed in params.
 	FindTransition(*Toolkit, string) (*Transition, error)
 
@@ -56,8 +93,77 @@ type Store interface {
 	// and the constraints really applied to it.
 	FindTransitions(*Toolkit, *WhereEvents) ([]*Transition, *Meta, error)
 
+	// IterateEvents calls the function passed in params for every events matching
+	// the constraints, in chronological order. Unlike FindEvents, events are not
+	// loaded all at once so it can be used for exports and backfills on large
+	// datasets. Offset, limit, and cursors are not applied. Iterating stops as soon
+	// as the function returns an error, which is then returned as is.
+	IterateEvents(*Toolkit, *WhereEvents, func(*Event) error) error
+
+	// IterateJobs calls the function passed in params for every jobs matching the
+	// constraints, in chronological order. It follows the same rules as IterateEvents.
+	IterateJobs(*Toolkit, *WhereEvents, func(*Job) error) error
+
+	// IterateTransitions calls the function passed in params for every transitions
+	// matching the constraints, in chronological order. It follows the same rules
+	// as IterateEvents.
+	IterateTransitions(*Toolkit, *WhereEvents, func(*Transition) error) error
+
+	// Stats returns aggregates of the jobs matching the constraints, grouped by
+	// the dimensions and time buckets passed in params. Offset, limit, and cursors
+	// are not applied. A bucket of zero means no time bucket is applied.
+	Stats(*Toolkit, *WhereEvents, []Dimension, time.Duration) ([]*Stat, error)
+
+	// Requeue inserts a new "awaiting" transition for every jobs matching the
+	// constraints and having one of the RequeueStatuses, so the scheduler can run
+	// them again. Offset, limit, and cursors are not applied. It returns the
+	// transitions created.
+	Requeue(*Toolkit, *WhereEvents, *Requeue) ([]*Transition, error)
+
+	// ClaimJobs atomically moves "awaiting" jobs matching the constraints to
+	// "executing" on behalf of the owner passed in params, with a lease of the
+	// duration passed in params. Jobs having a NotBefore in the future are not
+	// claimed. At most Limit jobs are claimed, by descending priority and then in
+	// chronological order. Offset and cursors are not applied. A job can never be
+	// claimed by more than one owner, which allows to run several instances of the
+	// scheduler with only the store. It returns the jobs claimed with their new
+	// latest transition.
+	ClaimJobs(*Toolkit, *WhereEvents, string, time.Duration) ([]*Job, error)
+
+	// ExtendLease postpones the lease of a job claimed by the owner passed in
+	// params, so it expires once the duration passed in params has elapsed. This
+	// allows to run jobs longer than the lease given when claiming. It returns a
+	// 409 error if the job is not claimed by the owner or if its lease has already
+	// expired. It returns the latest transition of the job with its new lease.
+	ExtendLease(*Toolkit, string, string, time.Duration) (*Transition, error)
+
+	// ExpireLeases inserts a new "awaiting" transition for every "executing" jobs
+	// whose lease has expired, so they can be claimed again. The attempt counter
+	// is continued and the error recorded is LeaseExpired. It returns the
+	// transitions created.
+	ExpireLeases(*Toolkit) ([]*Transition, error)
+
+	// Reencrypt encrypts the context and data of every events and jobs with the
+	// current key of the encryption set in the store's options. Payloads already
+	// encrypted with the current key are left untouched, while payloads in clear
+	// text are encrypted. This shall be run after a key rotation, before removing
+	// the previous keys. It returns the number of events and jobs re-encrypted.
+	// Every driver must apply the encryption, and must return a 400 error when
+	// none is set in the options.
+	Reencrypt(*Toolkit) (uint64, error)
+
 	// Purge purges every events, jobs, and transitions from the store. It is run
 	// for each purge policies defined in the store's options, at the defined
-	// intervals.
-	Purge(*Toolkit, *WhereEvents) error
+	// intervals. It returns the number of entries deleted. When the boolean passed
+	// is true, nothing is deleted and the number of entries that would have been
+	// deleted is returned (dry run).
+	Purge(*Toolkit, *WhereEvents, bool) (*Purged, error)
+
+	// PurgeEntries deletes the events of the entries passed in params, along their
+	// sub-events, jobs, and transitions, only if every entries deleted in cascade
+	// are part of the entries. Other events are left untouched. Entries are checked
+	// and deleted atomically, so entries added concurrently are never deleted. This
+	// allows to purge exactly the entries archived. It returns the number of entries
+	// deleted.
+	PurgeEntries(*Toolkit, *Entries) (*Purged, error)
 }
@@ -0,0 +1,286 @@
+package storearchive
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+DirPermissions and FilePermissions are the permissions applied when creating the
+directories and files of archives.
+*/
+var (
+	DirPermissions  os.FileMode = 0750
+	FilePermissions os.FileMode = 0640
+)
+
+/*
+partition is an archive file being written.
+*/
+type partition struct {
+	file *os.File
+	gzip *gzip.Writer
+	json *json.Encoder
+}
+
+/*
+Archive writes every events matching the constraints to the directory, including
+their jobs with the complete history of their transitions. Offset, limit, and
+cursors are not applied. It returns the number of events archived.
+
+Payloads are encrypted with the encryption of the store, if any, so an archive
+never holds payloads in clear text when the store does not.
+
+Since the store deletes sub-events and child jobs along their parent, they are
+archived as well so purging the events archived never deletes entries without
+archiving them first. A child job related to an event not archived is written
+in a record of its own event, holding only the child jobs archived.
+*/
+func Archive(tk *store.Toolkit, s store.Store, where *store.WhereEvents, dir string) (uint64, error) {
+	fail := &errors.Error{
+		Message:     "store/archive: Failed to archive events",
+		Validations: []errors.Validation{},
+	}
+
+	var count uint64
+	snap, err := resolve(tk, s, where)
+	if err == nil {
+		count, err = snap.archive(tk, s, dir)
+	}
+
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+			Path:    []string{"Archive", dir},
+		})
+
+		return count, fail
+	}
+
+	return count, nil
+}
+
+/*
+snapshot holds the entries of a run, resolved once from the events matching the
+constraints: the events themselves, their sub-events, and the jobs of these events
+with their child jobs, recursively. These are the entries deleted by the store when
+purging the events.
+*/
+type snapshot struct {
+
+	// roots are the IDs of the events matching the constraints, not already part
+	// of the lineage of another one.
+	roots []string
+
+	// events holds the events of the snapshot in the order they have been found,
+	// so parent events come before their sub-events.
+	events []*store.Event
+
+	// foreign holds the IDs of the events not part of the snapshot, but having
+	// child jobs of jobs of the snapshot.
+	foreign []string
+
+	// jobs holds the IDs of the jobs of the snapshot grouped by the ID of their
+	// event.
+	jobs map[string][]string
+
+	// entries holds the IDs of every events and jobs of the snapshot.
+	entries map[string]bool
+
+	// transitions holds the IDs of the transitions of the jobs of the snapshot, as
+	// archived.
+	transitions []string
+}
+
+/*
+resolve returns the snapshot of the entries related to the events matching the
+constraints, given the lineage of each one.
+*/
+func resolve(tk *store.Toolkit, s store.Store, where *store.WhereEvents) (*snapshot, error) {
+	snap := &snapshot{
+		roots:   []string{},
+		events:  []*store.Event{},
+		foreign:     []string{},
+		jobs:        map[string][]string{},
+		entries:     map[string]bool{},
+		transitions: []string{},
+	}
+
+	err := s.IterateEvents(tk, where, func(e *store.Event) error {
+		if snap.entries[e.ID] {
+			return nil
+		}
+
+		tree, err := s.FindEventTree(tk, e.ID)
+		if err != nil {
+			return err
+		}
+
+		snap.roots = append(snap.roots, e.ID)
+		snap.addEvent(tree)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range snap.jobs {
+		if !snap.entries[id] {
+			snap.foreign = append(snap.foreign, id)
+		}
+	}
+
+	sort.Strings(snap.foreign)
+	return snap, nil
+}
+
+/*
+addEvent adds the entries of an event's tree to the snapshot, if not already part
+of it.
+*/
+func (snap *snapshot) addEvent(tree *store.EventTree) {
+	if !snap.entries[tree.Event.ID] {
+		snap.entries[tree.Event.ID] = true
+		snap.events = append(snap.events, tree.Event)
+	}
+
+	for _, jt := range tree.Jobs {
+		snap.addJob(jt)
+	}
+
+	for _, child := range tree.Children {
+		snap.addEvent(child)
+	}
+}
+
+/*
+addJob adds the entries of a job's tree to the snapshot, if not already part of
+it.
+*/
+func (snap *snapshot) addJob(tree *store.JobTree) {
+	if !snap.entries[tree.Job.ID] {
+		snap.entries[tree.Job.ID] = true
+		snap.jobs[tree.Job.EventID] = append(snap.jobs[tree.Job.EventID], tree.Job.ID)
+	}
+
+	for _, child := range tree.Children {
+		snap.addJob(child)
+	}
+}
+
+/*
+archive writes the entries of the snapshot to the directory. Each event is written
+with the jobs of the snapshot, including the complete history of their
+transitions, which are added to the snapshot. It returns the number of events of
+the snapshot archived.
+*/
+func (snap *snapshot) archive(tk *store.Toolkit, s store.Store, dir string) (uint64, error) {
+	partitions := map[string]*partition{}
+	write := func(e *store.Event) error {
+		e.Jobs = []*store.Job{}
+		for _, id := range snap.jobs[e.ID] {
+			history, err := s.FindJobHistory(tk, id)
+			if err != nil {
+				return err
+			}
+
+			e.Jobs = append(e.Jobs, history)
+			for _, t := range history.History {
+				snap.transitions = append(snap.transitions, t.ID)
+			}
+		}
+
+		if err := seal(s.Options().Encryption, e); err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, e.ReceivedAt.UTC().Format("2006-01-02"), url.PathEscape(e.Source)+".ndjson.gz")
+		p, err := open(partitions, path)
+		if err != nil {
+			return err
+		}
+
+		return p.json.Encode(e)
+	}
+
+	var count uint64
+	var err error
+	for _, e := range snap.events {
+		if err = write(e); err != nil {
+			break
+		}
+
+		count++
+	}
+
+	for i := 0; err == nil && i < len(snap.foreign); i++ {
+		var e *store.Event
+		e, err = s.FindEvent(tk, snap.foreign[i])
+		if err == nil {
+			err = write(e)
+		}
+	}
+
+	for _, p := range partitions {
+		if cerr := p.close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return count, err
+}
+
+/*
+open returns the partition to write for the path, opening it if not already done.
+Files are opened in append mode so every runs add a new gzip member.
+*/
+func open(partitions map[string]*partition, path string) (*partition, error) {
+	if p, exists := partitions[path]; exists {
+		return p, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), DirPermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, FilePermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := gzip.NewWriter(file)
+	p := &partition{
+		file: file,
+		gzip: writer,
+		json: json.NewEncoder(writer),
+	}
+
+	partitions[path] = p
+	return p, nil
+}
+
+/*
+close flushes the gzip member written and closes the file.
+*/
+func (p *partition) close() error {
+	if err := p.gzip.Close(); err != nil {
+		p.file.Close()
+		return err
+	}
+
+	if err := p.file.Sync(); err != nil {
+		p.file.Close()
+		return err
+	}
+
+	return p.file.Close()
+}
@@ -0,0 +1,19 @@
+/*
+Package storearchive provides archiving of store entries to compressed NDJSON
+files, so purge policies can keep a cold copy of events before deleting them.
+
+Archives are written in a local directory, partitioned by day of reception and
+source:
+
+  <directory>/<YYYY-MM-DD>/<source>.ndjson.gz
+
+Each line is an event, including its jobs with the complete history of their
+transitions. Every archiving run appends a new gzip member to the files, which
+remain valid gzip files. Archives can be re-imported into any store.Store, no
+matter the driver used when archiving.
+
+Payloads are archived encrypted with the encryption of the store, if any, just
+like they are persisted. Restoring such an archive requires a store whose
+encryption knows the keys used when archiving.
+*/
+package storearchive
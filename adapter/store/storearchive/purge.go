@@ -0,0 +1,136 @@
+package storearchive
+
+import (
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+/*
+Purge runs a purge policy against the store and returns the report of the run,
+which is also logged with the toolkit's logger. Relative durations of the policy
+are resolved once when the run starts, so archiving and purging apply to the same
+entries.
+
+When the policy has a directory to archive to, matching entries are archived
+before being purged. In this case, only events received before the run started
+are considered, and exactly the entries archived are purged: an event whose
+lineage or history has changed in the meantime, such as a job having a new
+transition, is left for a later run, so entries are never deleted without being
+archived.
+
+On a dry run, nothing is archived nor deleted. The report holds the number of
+entries that would have been.
+*/
+func Purge(tk *store.Toolkit, s store.Store, policy *store.PurgePolicy) (*store.PurgeReport, error) {
+	now := time.Now().UTC()
+	report := &store.PurgeReport{
+		Policy:    policy,
+		Where:     policy.WhereEvents.Resolve(now),
+		DryRun:    policy.DryRun,
+		StartedAt: now,
+	}
+
+	err := run(tk, s, policy, report)
+	report.Duration = time.Since(now)
+	report.Error = errors.From(err)
+	if tk != nil && tk.Logger != nil {
+		entry := tk.Logger.WithFields(logrus.Fields{
+			"interval": policy.Interval,
+			"dry_run":  report.DryRun,
+			"archived": report.Archived,
+			"duration": report.Duration.String(),
+		})
+
+		if report.Purged != nil {
+			entry = entry.WithFields(logrus.Fields{
+				"events":      report.Purged.Events,
+				"jobs":        report.Purged.Jobs,
+				"transitions": report.Purged.Transitions,
+			})
+		}
+
+		if err != nil {
+			entry.WithError(err).Error("store/archive: Failed to run purge policy")
+		} else {
+			entry.Info("store/archive: Purge policy has run")
+		}
+	}
+
+	return report, err
+}
+
+/*
+run archives and purges the entries of a policy, and fills the report.
+*/
+func run(tk *store.Toolkit, s store.Store, policy *store.PurgePolicy, report *store.PurgeReport) error {
+	where := report.Where
+	if policy.ArchiveTo == "" {
+		purged, err := s.Purge(tk, where, policy.DryRun)
+		report.Purged = purged
+		return err
+	}
+
+	if where.ReceivedBefore == nil || where.ReceivedBefore.After(report.StartedAt) {
+		where.ReceivedBefore = &report.StartedAt
+	}
+
+	snap, err := resolve(tk, s, where)
+	if err != nil {
+		return err
+	}
+
+	if policy.DryRun {
+		report.Archived = uint64(len(snap.events))
+		purged, err := s.Purge(tk, where, true)
+		report.Purged = purged
+		return err
+	}
+
+	archived, err := snap.archive(tk, s, policy.ArchiveTo)
+	report.Archived = archived
+	if err != nil {
+		return err
+	}
+
+	purged, err := snap.purge(tk, s)
+	report.Purged = purged
+	return err
+}
+
+/*
+purge deletes the events of the snapshot matching the constraints, along their
+sub-events and jobs. The store deletes an event only if every entries deleted in
+cascade, including transitions, have been archived: when a sub-event, a child job,
+or a transition has been added since, it would be deleted without being archived,
+so the event is left for a later run instead. It returns the number of entries
+deleted.
+*/
+func (snap *snapshot) purge(tk *store.Toolkit, s store.Store) (*store.Purged, error) {
+	entries := &store.Entries{
+		Events:      snap.roots,
+		SubEvents:   []string{},
+		Jobs:        []string{},
+		Transitions: snap.transitions,
+	}
+
+	roots := map[string]bool{}
+	for _, id := range snap.roots {
+		roots[id] = true
+	}
+
+	for _, e := range snap.events {
+		if !roots[e.ID] {
+			entries.SubEvents = append(entries.SubEvents, e.ID)
+		}
+	}
+
+	for _, jobs := range snap.jobs {
+		entries.Jobs = append(entries.Jobs, jobs...)
+	}
+
+	return s.PurgeEntries(tk, entries)
+}
@@ -0,0 +1,136 @@
+package storearchive
+
+import (
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+unpack returns the event of an archive's record, with its jobs but without their
+transitions, and the transitions of every jobs in chronological order.
+*/
+func unpack(e *store.Event) (*store.Event, []*store.Transition) {
+	jobs := e.Jobs
+	e.Jobs = []*store.Job{}
+	transitions := []*store.Transition{}
+	for _, j := range jobs {
+		if j == nil {
+			continue
+		}
+
+		job, history := unpackJob(e.ID, j)
+		e.Jobs = append(e.Jobs, job)
+		transitions = append(transitions, history...)
+	}
+
+	return e, transitions
+}
+
+/*
+unpackJob returns a job of an archive's record without its transitions, and its
+transitions in chronological order. Both are related to the event passed.
+*/
+func unpackJob(eventID string, j *store.Job) (*store.Job, []*store.Transition) {
+	history := j.History
+	if len(history) == 0 && j.Transitions[0] != nil {
+		history = []*store.Transition{j.Transitions[0]}
+	}
+
+	j.EventID = eventID
+	j.Transitions = [1]*store.Transition{}
+	j.History = nil
+
+	transitions := []*store.Transition{}
+	for _, t := range history {
+		if t == nil {
+			continue
+		}
+
+		t.EventID = eventID
+		t.JobID = j.ID
+		transitions = append(transitions, t)
+	}
+
+	return j, transitions
+}
+
+/*
+merge adds the jobs of a record to another record of the same event, when not
+already part of it. The same event can be archived several times, such as when
+its child jobs are archived along the tree of another event.
+*/
+func merge(into *store.Event, from *store.Event) {
+	jobs := map[string]bool{}
+	for _, j := range into.Jobs {
+		if j != nil {
+			jobs[j.ID] = true
+		}
+	}
+
+	for _, j := range from.Jobs {
+		if j != nil && !jobs[j.ID] {
+			jobs[j.ID] = true
+			into.Jobs = append(into.Jobs, j)
+		}
+	}
+}
+
+/*
+seal encrypts the context and data of an archive's record and of its jobs with the
+encryption of the store, if any. Archives then never hold payloads in clear text
+when the store does not.
+*/
+func seal(enc store.Encryption, e *store.Event) error {
+	var err error
+	if e.Context, err = store.Seal(enc, e.Context); err != nil {
+		return err
+	}
+
+	if e.Data, err = store.Seal(enc, e.Data); err != nil {
+		return err
+	}
+
+	for _, j := range e.Jobs {
+		if j.Context, err = store.Seal(enc, j.Context); err != nil {
+			return err
+		}
+
+		if j.Data, err = store.Seal(enc, j.Data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+unseal decrypts the context and data of an archive's record and of its jobs with
+the encryption of the store, so the store encrypts them again with its current key
+when inserting them. Payloads in clear text, such as the ones archived by a store
+without encryption, are left as is.
+*/
+func unseal(enc store.Encryption, e *store.Event) error {
+	var err error
+	if e.Context, err = store.Unseal(enc, e.Context); err != nil {
+		return err
+	}
+
+	if e.Data, err = store.Unseal(enc, e.Data); err != nil {
+		return err
+	}
+
+	for _, j := range e.Jobs {
+		if j == nil {
+			continue
+		}
+
+		if j.Context, err = store.Unseal(enc, j.Context); err != nil {
+			return err
+		}
+
+		if j.Data, err = store.Unseal(enc, j.Data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,393 @@
+package storearchive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+BatchSize is the number of events inserted at once when restoring an archive.
+*/
+var BatchSize = 100
+
+/*
+Restore re-imports an archive into the store. The path can either be a single
+archive file or a directory, in which case every files ending with ".ndjson.gz"
+are restored. It returns the number of events restored.
+
+A parent event or a parent job can be archived in another file than its children,
+such as when a sub-event has been received the day after its parent. Files are
+therefore read a first time to resolve the lineage of every events, and events
+are then restored level by level so parents are always restored before their
+children, no matter the files they are in.
+
+Entries keep their ID. Entries already in the store, such as the ones archived by
+several runs, are skipped so an archive can safely be restored again if an error
+occurred. The ingestion date of events is set by the store and therefore reflects
+the date of restore.
+
+Encrypted payloads are decrypted with the encryption of the store, which must
+therefore know the keys used when archiving, and are encrypted again with its
+current key.
+*/
+func Restore(tk *store.Toolkit, s store.Store, path string) (uint64, error) {
+	fail := &errors.Error{
+		Message:     "store/archive: Failed to restore archive",
+		Validations: []errors.Validation{},
+	}
+
+	files, err := list(path)
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+			Path:    []string{"Restore", path},
+		})
+
+		return 0, fail
+	}
+
+	l := &lineage{
+		events:     map[string]bool{},
+		parents:    map[string]string{},
+		parentJobs: map[string][]string{},
+		eventOf:    map[string]string{},
+		levels:     map[string]int{},
+	}
+
+	for _, file := range files {
+		if err := read(file, l.add); err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: err.Error(),
+				Path:    []string{"Restore", file},
+			})
+
+			return 0, fail
+		}
+	}
+
+	var count uint64
+	for level := 0; level <= l.resolve(); level++ {
+		for _, file := range files {
+			restored, err := restore(tk, s, file, func(e *store.Event) bool {
+				return l.levels[e.ID] == level
+			})
+
+			count += restored
+			if err != nil {
+				fail.Validations = append(fail.Validations, errors.Validation{
+					Message: err.Error(),
+					Path:    []string{"Restore", file},
+				})
+
+				return count, fail
+			}
+		}
+	}
+
+	return count, nil
+}
+
+/*
+list returns the archive files to restore given a path.
+*/
+func list(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	files := []string{}
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && strings.HasSuffix(file, ".ndjson.gz") {
+			files = append(files, file)
+		}
+
+		return nil
+	})
+
+	sort.Strings(files)
+	return files, err
+}
+
+/*
+read decodes every records of an archive file, and calls fn for each one.
+*/
+func read(path string, fn func(*store.Event) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+	reader, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+	decoder := json.NewDecoder(reader)
+	for {
+		r := &store.Event{}
+		err := decoder.Decode(r)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if r.ID == "" {
+			continue
+		}
+
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+}
+
+/*
+restore re-imports the records of an archive file kept by the function passed,
+by batches of events. Records of the same event within a batch are merged.
+*/
+func restore(tk *store.Toolkit, s store.Store, path string, keep func(*store.Event) bool) (uint64, error) {
+	var count uint64
+	batch := []*store.Event{}
+	index := map[string]*store.Event{}
+	flush := func() error {
+		restored, err := insert(tk, s, batch)
+		count += restored
+		batch = []*store.Event{}
+		index = map[string]*store.Event{}
+		return err
+	}
+
+	err := read(path, func(r *store.Event) error {
+		if !keep(r) {
+			return nil
+		}
+
+		if err := unseal(s.Options().Encryption, r); err != nil {
+			return err
+		}
+
+		if e := index[r.ID]; e != nil {
+			merge(e, r)
+			return nil
+		}
+
+		index[r.ID] = r
+		batch = append(batch, r)
+		if len(batch) >= BatchSize {
+			return flush()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return count, err
+	}
+
+	return count, flush()
+}
+
+/*
+insert adds the records of a batch to the store, skipping the entries already in
+the store. Transitions are restored once their events and jobs are inserted. It
+returns the number of events inserted.
+*/
+func insert(tk *store.Toolkit, s store.Store, records []*store.Event) (uint64, error) {
+	events := []*store.Event{}
+	jobs := []*store.Job{}
+	transitions := []*store.Transition{}
+	for _, r := range records {
+		_, err := s.FindEvent(tk, r.ID)
+		if notFound(err) {
+			e, t := unpack(r)
+			events = append(events, e)
+			transitions = append(transitions, t...)
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		for _, j := range r.Jobs {
+			if j == nil {
+				continue
+			}
+
+			_, err := s.FindJob(tk, j.ID)
+			if notFound(err) {
+				job, t := unpackJob(r.ID, j)
+				jobs = append(jobs, job)
+				transitions = append(transitions, t...)
+				continue
+			}
+
+			if err != nil {
+				return 0, err
+			}
+
+			_, t := unpackJob(r.ID, j)
+			for _, tr := range t {
+				_, err := s.FindTransition(tk, tr.ID)
+				if notFound(err) {
+					transitions = append(transitions, tr)
+					continue
+				}
+
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+
+	if len(events) > 0 {
+		if err := s.AddEvents(tk, events); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(jobs) > 0 {
+		if err := s.AddJobs(tk, jobs); err != nil {
+			return uint64(len(events)), err
+		}
+	}
+
+	if len(transitions) > 0 {
+		if err := s.RestoreTransitions(tk, transitions); err != nil {
+			return uint64(len(events)), err
+		}
+	}
+
+	return uint64(len(events)), nil
+}
+
+/*
+notFound reports if an error is a 404 error of the store.
+*/
+func notFound(err error) bool {
+	fail, ok := err.(*errors.Error)
+	return ok && fail.StatusCode == 404
+}
+
+/*
+lineage holds the relations between the events of an archive, so parents can be
+restored before their children.
+*/
+type lineage struct {
+
+	// events holds the IDs of the events of the archive.
+	events map[string]bool
+
+	// parents holds the ID of the parent event of each event, and parentJobs holds
+	// the IDs of the parent jobs of the jobs of each event.
+	parents    map[string]string
+	parentJobs map[string][]string
+
+	// eventOf holds the ID of the event of each job.
+	eventOf map[string]string
+
+	// levels holds the level of each event once resolved: events without parent in
+	// the archive are at level 0, and other events are one level after their
+	// deepest parent.
+	levels map[string]int
+}
+
+/*
+add adds the relations of an archive's record to the lineage. Parent jobs are kept
+by their ID until the lineage is resolved, since they can be in a record read
+later.
+*/
+func (l *lineage) add(r *store.Event) error {
+	l.events[r.ID] = true
+	if r.ParentEventID != nil {
+		l.parents[r.ID] = *r.ParentEventID
+	}
+
+	for _, j := range r.Jobs {
+		if j == nil {
+			continue
+		}
+
+		l.eventOf[j.ID] = r.ID
+		if j.ParentJobID != nil {
+			l.parentJobs[r.ID] = append(l.parentJobs[r.ID], *j.ParentJobID)
+		}
+	}
+
+	return nil
+}
+
+/*
+resolve computes the level of every events and returns the deepest one.
+*/
+func (l *lineage) resolve() int {
+	deepest := 0
+	visiting := map[string]bool{}
+	for id := range l.events {
+		if level := l.level(id, visiting); level > deepest {
+			deepest = level
+		}
+	}
+
+	return deepest
+}
+
+/*
+level returns the level of an event, resolving the one of its parents first.
+Parents not part of the archive are ignored, since they must already be in the
+store. Cycles are ignored as well.
+*/
+func (l *lineage) level(id string, visiting map[string]bool) int {
+	if level, ok := l.levels[id]; ok {
+		return level
+	}
+
+	if visiting[id] {
+		return 0
+	}
+
+	visiting[id] = true
+	parents := []string{l.parents[id]}
+	for _, job := range l.parentJobs[id] {
+		parents = append(parents, l.eventOf[job])
+	}
+
+	level := 0
+	for _, parent := range parents {
+		if parent == id || !l.events[parent] {
+			continue
+		}
+
+		if above := l.level(parent, visiting) + 1; above > level {
+			level = above
+		}
+	}
+
+	delete(visiting, id)
+	l.levels[id] = level
+	return level
+}
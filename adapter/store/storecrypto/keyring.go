@@ -0,0 +1,384 @@
+package storecrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+
+	"github.com/segmentio/ksuid"
+)
+
+/*
+KeySize is the size in bytes of the keys generated, which uses AES-256.
+*/
+var KeySize = 32
+
+/*
+FilePermissions is the permissions applied when writing a keyring file.
+*/
+var FilePermissions os.FileMode = 0600
+
+/*
+Keyring implements the store.Encryption interface using AES-GCM. Keys are
+persisted in a local file, which is updated on every rotation and removal.
+*/
+type Keyring struct {
+	mutex   sync.RWMutex
+	path    string
+	current string
+	keys    map[string][]byte
+	ciphers map[string]cipher.AEAD
+}
+
+/*
+file is the representation of a keyring file. Keys are base64 encoded by the
+encoding/json package.
+*/
+type file struct {
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+/*
+Create creates a new keyring file at the path, with a single key generated which
+becomes the current one. It returns an error if the file already exists, so
+existing keys are never lost.
+*/
+func Create(path string) (*Keyring, error) {
+	fail := &errors.Error{
+		Message:     "store/crypto: Failed to create keyring",
+		Validations: []errors.Validation{},
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		fail.StatusCode = 400
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Keyring file already exists",
+			Path:    []string{"Keyring", path},
+		})
+
+		return nil, fail
+	}
+
+	k := &Keyring{
+		path:    path,
+		keys:    map[string][]byte{},
+		ciphers: map[string]cipher.AEAD{},
+	}
+
+	if _, err := k.Rotate(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+/*
+Open opens an existing keyring file.
+*/
+func Open(path string) (*Keyring, error) {
+	fail := &errors.Error{
+		Message:     "store/crypto: Failed to open keyring",
+		Validations: []errors.Validation{},
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	f := &file{}
+	if err := json.Unmarshal(b, f); err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	k := &Keyring{
+		path:    path,
+		current: f.Current,
+		keys:    map[string][]byte{},
+		ciphers: map[string]cipher.AEAD{},
+	}
+
+	for id, key := range f.Keys {
+		aead, err := newCipher(key)
+		if err != nil {
+			fail.Validations = append(fail.Validations, errors.Validation{
+				Message: err.Error(),
+				Path:    []string{"Keyring", "Keys", id},
+			})
+
+			continue
+		}
+
+		k.keys[id] = key
+		k.ciphers[id] = aead
+	}
+
+	if k.ciphers[k.current] == nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Current key must be part of the keyring",
+			Path:    []string{"Keyring", "Current"},
+		})
+	}
+
+	if len(fail.Validations) > 0 {
+		return nil, fail
+	}
+
+	return k, nil
+}
+
+/*
+KeyID returns the ID of the current key.
+*/
+func (k *Keyring) KeyID() string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	return k.current
+}
+
+/*
+Keys returns the IDs of every keys in the keyring, including the current one, from
+the oldest to the newest.
+*/
+func (k *Keyring) Keys() []string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	ids := []string{}
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+/*
+Encrypt encrypts a payload with the current key. The random nonce used is
+prepended to the ciphertext.
+*/
+func (k *Keyring) Encrypt(payload []byte) (string, []byte, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	aead := k.ciphers[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+
+	return k.current, aead.Seal(nonce, nonce, payload, nil), nil
+}
+
+/*
+Decrypt decrypts a ciphertext given the ID of the key it was encrypted with. It
+returns an error if the key is not part of the keyring.
+*/
+func (k *Keyring) Decrypt(id string, ciphertext []byte) ([]byte, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	fail := &errors.Error{
+		Message:     "store/crypto: Failed to decrypt payload",
+		Validations: []errors.Validation{},
+	}
+
+	aead := k.ciphers[id]
+	if aead == nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Key is not part of the keyring",
+			Path:    []string{"Keyring", "Keys", id},
+		})
+
+		return nil, fail
+	}
+
+	size := aead.NonceSize()
+	if len(ciphertext) < size {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Ciphertext is too short",
+		})
+
+		return nil, fail
+	}
+
+	payload, err := aead.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return nil, fail
+	}
+
+	return payload, nil
+}
+
+/*
+Rotate generates a new key which becomes the current one, and persists the
+keyring. Previous keys are kept so existing entries can still be decrypted. It
+returns the ID of the new key.
+*/
+func (k *Keyring) Rotate() (string, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	fail := &errors.Error{
+		Message:     "store/crypto: Failed to rotate keys",
+		Validations: []errors.Validation{},
+	}
+
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return "", fail
+	}
+
+	aead, err := newCipher(key)
+	if err != nil {
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return "", fail
+	}
+
+	id := ksuid.New().String()
+	previous := k.current
+	k.keys[id] = key
+	k.ciphers[id] = aead
+	k.current = id
+	if err := k.save(); err != nil {
+		delete(k.keys, id)
+		delete(k.ciphers, id)
+		k.current = previous
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return "", fail
+	}
+
+	return id, nil
+}
+
+/*
+Remove removes a key from the keyring and persists it. Entries encrypted with
+this key can not be decrypted anymore, so they must be re-encrypted beforehand.
+The current key can not be removed.
+*/
+func (k *Keyring) Remove(id string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	fail := &errors.Error{
+		Message:     "store/crypto: Failed to remove key",
+		Validations: []errors.Validation{},
+	}
+
+	if id == k.current {
+		fail.StatusCode = 400
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Current key can not be removed",
+			Path:    []string{"Keyring", "Keys", id},
+		})
+
+		return fail
+	}
+
+	key, exists := k.keys[id]
+	if !exists {
+		fail.StatusCode = 404
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: "Key is not part of the keyring",
+			Path:    []string{"Keyring", "Keys", id},
+		})
+
+		return fail
+	}
+
+	aead := k.ciphers[id]
+	delete(k.keys, id)
+	delete(k.ciphers, id)
+	if err := k.save(); err != nil {
+		k.keys[id] = key
+		k.ciphers[id] = aead
+		fail.Validations = append(fail.Validations, errors.Validation{
+			Message: err.Error(),
+		})
+
+		return fail
+	}
+
+	return nil
+}
+
+/*
+save persists the keyring. The file is written to a temporary file first, and
+then renamed so the keyring is never left partially written.
+*/
+func (k *Keyring) save() error {
+	b, err := json.MarshalIndent(&file{
+		Current: k.current,
+		Keys:    k.keys,
+	}, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(k.path), filepath.Base(k.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(FilePermissions); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), k.path)
+}
+
+/*
+newCipher returns the AES-GCM cipher of a key.
+*/
+func newCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,15 @@
+/*
+Package storecrypto provides an AES-GCM implementation of the store.Encryption
+interface, using keys persisted in a local keyring file.
+
+A keyring holds every keys still needed to decrypt existing entries, and the ID
+of the current key used to encrypt new ones. Keys are rotated without downtime:
+
+  1. Rotate the keyring, so new entries are encrypted with a new key;
+  2. Re-encrypt existing entries with the Reencrypt method of the store;
+  3. Remove the previous keys from the keyring.
+
+The keyring file contains secrets in clear text. It shall be readable only by the
+user running the application.
+*/
+package storecrypto
@@ -0,0 +1,101 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/adapter/store/storearchive"
+)
+
+/*
+testArchiveRestore makes sure purging with an archive archives the entries deleted
+along the events matching the policy, and that an archive can be restored when
+parents are in another partition than their children.
+*/
+func testArchiveRestore(t *testing.T, factory Factory) {
+	s := factory(t)
+	dir := t.TempDir()
+
+	// The sub-event is archived in "billing", which is restored before "shop" in
+	// lexical order. Its job is a child job of the parent event's job.
+	parentJob := job("warehouse", "load", store.StatusAwaiting)
+	parent := event("shop", "order", at(0), parentJob)
+	childJob := job("mailer", "notify", store.StatusAcknowledged)
+	childJob.ParentJobID = &parentJob.ID
+	child := event("billing", "invoice", at(60), childJob)
+	child.ParentEventID = &parent.ID
+	mustAddEvents(t, s, parent, child)
+
+	// The history of the parent job includes a lease which has expired, so it can
+	// only be restored as history.
+	claim := &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			DestinationsIn: []string{"warehouse"},
+		},
+	}
+
+	if _, err := s.ClaimJobs(toolkit(), claim, "scheduler-1", time.Millisecond); err != nil {
+		t.Fatalf("claim: unexpected error: %v", err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, err := s.ExpireLeases(toolkit()); err != nil {
+		t.Fatalf("expire: unexpected error: %v", err)
+	}
+
+	report, err := storearchive.Purge(toolkit(), s, &store.PurgePolicy{
+		WhereEvents: &store.WhereEvents{
+			SourcesIn: []string{"shop"},
+		},
+		ArchiveTo: dir,
+	})
+
+	if err != nil {
+		t.Fatalf("purge: unexpected error: %v", err)
+	}
+
+	if report.Archived != 2 {
+		t.Fatalf("purge: expected the sub-event to be archived along its parent, found %d events archived", report.Archived)
+	}
+
+	assertPurged(t, "purge", report.Purged, 2, 2, 4)
+	if _, meta := mustFindEvents(t, s, nil); meta.Count != 0 {
+		t.Fatalf("purge: expected no event left, found %d", meta.Count)
+	}
+
+	restored, err := storearchive.Restore(toolkit(), s, dir)
+	if err != nil {
+		t.Fatalf("restore: unexpected error: %v", err)
+	}
+
+	if restored != 2 {
+		t.Fatalf("restore: expected 2 events restored, found %d", restored)
+	}
+
+	restored, err = storearchive.Restore(toolkit(), s, dir)
+	if err != nil || restored != 0 {
+		t.Fatalf("restore again: expected existing entries to be skipped, found %d and %v", restored, err)
+	}
+
+	tree, err := s.FindEventTree(toolkit(), parent.ID)
+	if err != nil {
+		t.Fatalf("tree: unexpected error: %v", err)
+	}
+
+	if len(tree.Children) != 1 || tree.Children[0].Event.ID != child.ID {
+		t.Fatalf("tree: expected the sub-event %s, found %+v", child.ID, tree.Children)
+	}
+
+	assertIDs(t, "tree", jobIDsOfTrees(tree.Jobs), parentJob.ID)
+	assertIDs(t, "tree", jobIDsOfTrees(tree.Jobs[0].Children), childJob.ID)
+
+	history, err := s.FindJobHistory(toolkit(), parentJob.ID)
+	if err != nil {
+		t.Fatalf("history: unexpected error: %v", err)
+	}
+
+	if len(history.History) != 3 || history.Transitions[0].StateAfter != store.StatusAwaiting {
+		t.Fatalf("history: expected the complete history to be restored, found %d transitions", len(history.History))
+	}
+}
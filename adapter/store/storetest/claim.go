@@ -0,0 +1,347 @@
+package storetest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+testClaimJobs makes sure only awaiting jobs matching the constraints are claimed,
+in chronological order and up to the limit, and that the owner and the lease are
+recorded on the new "executing" transition.
+*/
+func testClaimJobs(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	first := job("warehouse", "load", store.StatusAwaiting)
+	second := job("warehouse", "load", store.StatusAwaiting)
+	third := job("warehouse", "load", store.StatusAwaiting)
+	succeeded := job("warehouse", "load", store.StatusSucceeded)
+	other := job("crm", "sync", store.StatusAwaiting)
+	for i, j := range []*store.Job{first, second, third, succeeded, other} {
+		j.CreatedAt = at(i)
+		j.Transitions[0].CreatedAt = at(i)
+	}
+
+	mustAddEvents(t, s, event("crm", "register", at(0), third, first, succeeded, other, second))
+
+	if _, err := s.ClaimJobs(toolkit(), nil, "", time.Minute); err == nil {
+		t.Fatalf("anonymous: expected an error when owner is not set")
+	}
+
+	if _, err := s.ClaimJobs(toolkit(), nil, "scheduler-1", 0); err == nil {
+		t.Fatalf("no lease: expected an error when lease is not set")
+	}
+
+	where := &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			DestinationsIn: []string{"warehouse"},
+		},
+		Limit: 2,
+	}
+
+	before := time.Now()
+	claimed, err := s.ClaimJobs(toolkit(), where, "scheduler-1", time.Minute)
+	if err != nil {
+		t.Fatalf("claim: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "claim", jobIDs(claimed), first.ID, second.ID)
+	for _, j := range claimed {
+		latest := j.Transitions[0]
+		if latest == nil || latest.StateAfter != store.StatusExecuting || latest.Attempt != 1 || latest.Owner != "scheduler-1" {
+			t.Fatalf("claim: unexpected transition: %+v", latest)
+		}
+
+		if latest.StateBefore == nil || *latest.StateBefore != store.StatusAwaiting {
+			t.Fatalf("claim: expected the state before to be awaiting, found %+v", latest)
+		}
+
+		if latest.LeaseExpiresAt == nil || latest.LeaseExpiresAt.Before(before.Add(time.Minute)) {
+			t.Fatalf("claim: expected the lease to expire in a minute, found %v", latest.LeaseExpiresAt)
+		}
+	}
+
+	found, err := s.FindJob(toolkit(), first.ID)
+	if err != nil {
+		t.Fatalf("find: unexpected error: %v", err)
+	}
+
+	latest := found.Transitions[0]
+	if latest.Owner != "scheduler-1" || latest.LeaseExpiresAt == nil || !latest.LeaseExpiresAt.Equal(*claimed[0].Transitions[0].LeaseExpiresAt) {
+		t.Fatalf("find: expected the claim to be persisted, found %+v", latest)
+	}
+
+	claimed, err = s.ClaimJobs(toolkit(), where, "scheduler-2", time.Minute)
+	if err != nil {
+		t.Fatalf("again: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "again", jobIDs(claimed), third.ID)
+
+	claimed, err = s.ClaimJobs(toolkit(), where, "scheduler-2", time.Minute)
+	if err != nil || len(claimed) != 0 {
+		t.Fatalf("empty: expected no job to claim, found %d and %v", len(claimed), err)
+	}
+}
+
+/*
+testClaimJobsConcurrent makes sure a job is never claimed by more than one owner
+when several owners claim jobs at the same time.
+*/
+func testClaimJobsConcurrent(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	jobs := []*store.Job{}
+	for i := 0; i < 24; i++ {
+		jobs = append(jobs, job("warehouse", "load", store.StatusAwaiting))
+	}
+
+	mustAddEvents(t, s, event("crm", "register", at(0), jobs...))
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	owners := map[string]string{}
+	errs := []error{}
+	for i := 0; i < 6; i++ {
+		owner := "scheduler-" + string(rune('a'+i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				claimed, err := s.ClaimJobs(toolkit(), &store.WhereEvents{Limit: 3}, owner, time.Minute)
+				mutex.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				}
+
+				for _, j := range claimed {
+					if previous, exists := owners[j.ID]; exists {
+						errs = append(errs, fmt.Errorf("job %s claimed by %s and %s", j.ID, previous, owner))
+					}
+
+					owners[j.ID] = owner
+				}
+
+				mutex.Unlock()
+				if err != nil || len(claimed) == 0 {
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	if len(errs) > 0 {
+		t.Fatalf("claim: unexpected errors: %v", errs)
+	}
+
+	if len(owners) != len(jobs) {
+		t.Fatalf("claim: expected %d jobs claimed, found %d", len(jobs), len(owners))
+	}
+}
+
+/*
+testExpireLeases makes sure only executing jobs whose lease has expired are brought
+back to "awaiting", with their attempt counter continued and a retryable error,
+and that they can then be claimed again.
+*/
+func testExpireLeases(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	abandoned := job("warehouse", "load", store.StatusAwaiting)
+	running := job("crm", "sync", store.StatusAwaiting)
+	mustAddEvents(t, s, event("crm", "register", at(0), abandoned, running))
+
+	where := func(destination string) *store.WhereEvents {
+		return &store.WhereEvents{
+			AndWhereJobs: &store.WhereJobs{
+				DestinationsIn: []string{destination},
+			},
+		}
+	}
+
+	if _, err := s.ClaimJobs(toolkit(), where("warehouse"), "scheduler-1", time.Millisecond); err != nil {
+		t.Fatalf("claim: unexpected error: %v", err)
+	}
+
+	if _, err := s.ClaimJobs(toolkit(), where("crm"), "scheduler-1", time.Hour); err != nil {
+		t.Fatalf("claim: unexpected error: %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	transitions, err := s.ExpireLeases(toolkit())
+	if err != nil {
+		t.Fatalf("expire: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "expire", jobIDsOf(transitions), abandoned.ID)
+	tr := transitions[0]
+	if tr.StateAfter != store.StatusAwaiting || tr.StateBefore == nil || *tr.StateBefore != store.StatusExecuting || tr.Attempt != 1 {
+		t.Fatalf("expire: unexpected transition: %+v", tr)
+	}
+
+	if tr.Error == nil || !tr.Error.Retryable {
+		t.Fatalf("expire: expected a retryable error, found %+v", tr.Error)
+	}
+
+	found, err := s.FindJob(toolkit(), abandoned.ID)
+	if err != nil {
+		t.Fatalf("find: unexpected error: %v", err)
+	}
+
+	if latest := found.Transitions[0]; latest.ID != tr.ID || latest.Owner != "" || latest.LeaseExpiresAt != nil {
+		t.Fatalf("find: expected the job to be awaiting with no lease, found %+v", latest)
+	}
+
+	transitions, err = s.ExpireLeases(toolkit())
+	if err != nil || len(transitions) != 0 {
+		t.Fatalf("again: expected no lease to expire, found %d and %v", len(transitions), err)
+	}
+
+	claimed, err := s.ClaimJobs(toolkit(), nil, "scheduler-2", time.Minute)
+	if err != nil {
+		t.Fatalf("reclaim: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "reclaim", jobIDs(claimed), abandoned.ID)
+	if latest := claimed[0].Transitions[0]; latest.Attempt != 2 || latest.Owner != "scheduler-2" {
+		t.Fatalf("reclaim: unexpected transition: %+v", latest)
+	}
+}
+
+/*
+testLeaseOwnership makes sure a claimed job only accepts transitions made by its
+owner while the lease has not expired, so an owner whose lease has expired can not
+override the work of the next one, and that only the owner can extend its lease.
+*/
+func testLeaseOwnership(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	running := job("warehouse", "load", store.StatusAwaiting)
+	abandoned := job("crm", "sync", store.StatusAwaiting)
+	free := job("mailer", "notify", store.StatusAwaiting)
+	mustAddEvents(t, s, event("crm", "register", at(0), running, abandoned, free))
+
+	where := func(destination string) *store.WhereEvents {
+		return &store.WhereEvents{
+			AndWhereJobs: &store.WhereJobs{
+				DestinationsIn: []string{destination},
+			},
+		}
+	}
+
+	if _, err := s.ClaimJobs(toolkit(), where("warehouse"), "scheduler-1", 50*time.Millisecond); err != nil {
+		t.Fatalf("claim: unexpected error: %v", err)
+	}
+
+	if _, err := s.ClaimJobs(toolkit(), where("crm"), "scheduler-1", time.Millisecond); err != nil {
+		t.Fatalf("claim: unexpected error: %v", err)
+	}
+
+	if _, err := s.ExtendLease(toolkit(), running.ID, "scheduler-2", time.Hour); err == nil {
+		t.Fatalf("extend: expected an error for another owner")
+	}
+
+	before := time.Now()
+	extended, err := s.ExtendLease(toolkit(), running.ID, "scheduler-1", time.Hour)
+	if err != nil {
+		t.Fatalf("extend: unexpected error: %v", err)
+	}
+
+	if extended.Owner != "scheduler-1" || extended.LeaseExpiresAt == nil || extended.LeaseExpiresAt.Before(before.Add(time.Hour)) {
+		t.Fatalf("extend: expected the lease to expire in an hour, found %+v", extended)
+	}
+
+	found, err := s.FindJob(toolkit(), running.ID)
+	if err != nil {
+		t.Fatalf("find: unexpected error: %v", err)
+	}
+
+	if latest := found.Transitions[0]; latest.ID != extended.ID || !latest.LeaseExpiresAt.Equal(*extended.LeaseExpiresAt) {
+		t.Fatalf("find: expected the lease to be extended in place, found %+v", latest)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	transitions, err := s.ExpireLeases(toolkit())
+	if err != nil {
+		t.Fatalf("expire: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "expire", jobIDsOf(transitions), abandoned.ID)
+
+	anonymous := transition(running, 1, store.StatusExecuting, store.StatusSucceeded, time.Time{})
+	if err := s.AddTransitions(toolkit(), []*store.Transition{anonymous}); err == nil {
+		t.Fatalf("anonymous: expected an error for a claimed job")
+	}
+
+	stolen := transition(running, 1, store.StatusExecuting, store.StatusSucceeded, time.Time{})
+	stolen.Owner = "scheduler-2"
+	if err := s.AddTransitions(toolkit(), []*store.Transition{stolen}); err == nil {
+		t.Fatalf("stolen: expected an error for another owner")
+	}
+
+	if _, err := s.ClaimJobs(toolkit(), where("crm"), "scheduler-2", time.Minute); err != nil {
+		t.Fatalf("reclaim: unexpected error: %v", err)
+	}
+
+	stale := transition(abandoned, 1, store.StatusExecuting, store.StatusSucceeded, time.Time{})
+	stale.Owner = "scheduler-1"
+	if err := s.AddTransitions(toolkit(), []*store.Transition{stale}); err == nil {
+		t.Fatalf("stale: expected an error for the previous owner")
+	}
+
+	if _, err := s.ExtendLease(toolkit(), abandoned.ID, "scheduler-1", time.Hour); err == nil {
+		t.Fatalf("stale: expected an error when extending the lease of the previous owner")
+	}
+
+	done := transition(abandoned, 2, store.StatusExecuting, store.StatusSucceeded, time.Time{})
+	done.Owner = "scheduler-2"
+	mustAddTransitions(t, s, done)
+
+	succeeded := transition(running, 1, store.StatusExecuting, store.StatusSucceeded, time.Time{})
+	succeeded.Owner = "scheduler-1"
+	mustAddTransitions(t, s, succeeded)
+
+	if _, err := s.ExtendLease(toolkit(), running.ID, "scheduler-1", time.Hour); err == nil {
+		t.Fatalf("settled: expected an error when extending the lease of a job not executing")
+	}
+
+	foreign := transition(free, 1, store.StatusAwaiting, store.StatusExecuting, time.Time{})
+	foreign.Owner = "scheduler-1"
+	if err := s.AddTransitions(toolkit(), []*store.Transition{foreign}); err == nil {
+		t.Fatalf("foreign: expected an error for a job not claimed")
+	}
+
+	backdated := transition(free, 1, store.StatusAwaiting, store.StatusExecuting, at(0))
+	backdated.Owner = "scheduler-1"
+	if err := s.AddTransitions(toolkit(), []*store.Transition{backdated}); err == nil {
+		t.Fatalf("backdated: expected an error for a job not claimed, no matter the instant of the transition")
+	}
+
+	if _, err := s.ExtendLease(toolkit(), "missing", "scheduler-1", time.Hour); err == nil {
+		t.Fatalf("missing: expected an error for a job not found")
+	}
+
+	latest := func(j *store.Job) *store.Transition {
+		found, err := s.FindJob(toolkit(), j.ID)
+		if err != nil {
+			t.Fatalf("find: unexpected error: %v", err)
+		}
+
+		return found.Transitions[0]
+	}
+
+	if tr := latest(running); tr.ID != succeeded.ID {
+		t.Fatalf("after: expected the owner's transition to be the latest, found %+v", tr)
+	}
+
+	if tr := latest(abandoned); tr.ID != done.ID {
+		t.Fatalf("after: expected the new owner's transition to be the latest, found %+v", tr)
+	}
+}
@@ -0,0 +1,320 @@
+package storetest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/adapter/store/storearchive"
+	"github.com/nunchistudio/blacksmith/adapter/store/storecrypto"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+EncryptionFactory returns a new and empty store for a test, encrypting payloads
+with the encryption passed. The store shall be cleaned up by the factory itself if
+needed, using t.Cleanup.
+*/
+type EncryptionFactory func(t *testing.T, enc store.Encryption) store.Store
+
+/*
+RunEncryptionSuite runs the conformance test suite of encryption against the store
+returned by the factory. Every driver shall pass it.
+*/
+func RunEncryptionSuite(t *testing.T, factory EncryptionFactory) {
+	tests := []struct {
+		name string
+		run  func(*testing.T, EncryptionFactory)
+	}{
+		{"EncryptionRoundTrip", testEncryptionRoundTrip},
+		{"EncryptionRotation", testEncryptionRotation},
+		{"EncryptionPredicates", testEncryptionPredicates},
+		{"EncryptionRequired", testEncryptionRequired},
+		{"EncryptionArchive", testEncryptionArchive},
+	}
+
+	for _, test := range tests {
+		run := test.run
+		t.Run(test.name, func(t *testing.T) {
+			run(t, factory)
+		})
+	}
+}
+
+/*
+keyring returns a new keyring persisted in a temporary directory.
+*/
+func keyring(t *testing.T) *storecrypto.Keyring {
+	t.Helper()
+
+	k, err := storecrypto.Create(filepath.Join(t.TempDir(), "keyring.json"))
+	if err != nil {
+		t.Fatalf("keyring: unexpected error: %v", err)
+	}
+
+	return k
+}
+
+/*
+assertPayloads fails the test if the context and data of an event and its jobs
+are not the ones originally added.
+*/
+func assertPayloads(t *testing.T, what string, e *store.Event) {
+	t.Helper()
+
+	expected := event("", "", base)
+	if string(e.Context) != string(expected.Context) || string(e.Data) != string(expected.Data) {
+		t.Fatalf("%s: expected payloads in clear text, found %q and %q", what, e.Context, e.Data)
+	}
+
+	for _, j := range e.Jobs {
+		if string(j.Context) != string(expected.Context) || string(j.Data) != string(expected.Data) {
+			t.Fatalf("%s: expected job's payloads in clear text, found %q and %q", what, j.Context, j.Data)
+		}
+	}
+}
+
+/*
+testEncryptionRoundTrip makes sure payloads are decrypted transparently when
+reading events and jobs.
+*/
+func testEncryptionRoundTrip(t *testing.T, factory EncryptionFactory) {
+	s := factory(t, keyring(t))
+
+	j := job("warehouse", "load", store.StatusAcknowledged)
+	e := event("crm", "register", at(0), j)
+	mustAddEvents(t, s, e)
+
+	found, err := s.FindEvent(toolkit(), e.ID)
+	if err != nil {
+		t.Fatalf("find event: unexpected error: %v", err)
+	}
+
+	assertPayloads(t, "find event", found)
+	events, _ := mustFindEvents(t, s, nil)
+	assertIDs(t, "find events", eventIDs(events), e.ID)
+	assertPayloads(t, "find events", events[0])
+
+	jobs, _ := mustFindJobs(t, s, nil)
+	assertIDs(t, "find jobs", jobIDs(jobs), j.ID)
+	assertPayloads(t, "find jobs", &store.Event{
+		Context: jobs[0].Context,
+		Data:    jobs[0].Data,
+	})
+
+	history, err := s.FindJobHistory(toolkit(), j.ID)
+	if err != nil {
+		t.Fatalf("history: unexpected error: %v", err)
+	}
+
+	assertPayloads(t, "history", &store.Event{
+		Context: history.Context,
+		Data:    history.Data,
+	})
+}
+
+/*
+testEncryptionRotation makes sure entries encrypted with a previous key can still
+be read after a rotation, and are re-encrypted with the current key so previous
+keys can be removed.
+*/
+func testEncryptionRotation(t *testing.T, factory EncryptionFactory) {
+	k := keyring(t)
+	s := factory(t, k)
+
+	before := event("crm", "register", at(0), job("warehouse", "load", store.StatusAcknowledged))
+	mustAddEvents(t, s, before)
+
+	previous := k.KeyID()
+	if _, err := k.Rotate(); err != nil {
+		t.Fatalf("rotate: unexpected error: %v", err)
+	}
+
+	after := event("crm", "register", at(1), job("warehouse", "load", store.StatusAcknowledged))
+	mustAddEvents(t, s, after)
+
+	events, _ := mustFindEvents(t, s, nil)
+	assertIDs(t, "rotated", eventIDs(events), before.ID, after.ID)
+	for _, e := range events {
+		assertPayloads(t, "rotated", e)
+	}
+
+	count, err := s.Reencrypt(toolkit())
+	if err != nil {
+		t.Fatalf("reencrypt: unexpected error: %v", err)
+	}
+
+	if count != 2 {
+		t.Fatalf("reencrypt: expected 2 entries re-encrypted, found %d", count)
+	}
+
+	count, err = s.Reencrypt(toolkit())
+	if err != nil {
+		t.Fatalf("reencrypt again: unexpected error: %v", err)
+	}
+
+	if count != 0 {
+		t.Fatalf("reencrypt again: expected no entry re-encrypted, found %d", count)
+	}
+
+	if err := k.Remove(previous); err != nil {
+		t.Fatalf("remove: unexpected error: %v", err)
+	}
+
+	events, _ = mustFindEvents(t, s, nil)
+	assertIDs(t, "removed", eventIDs(events), before.ID, after.ID)
+	for _, e := range events {
+		assertPayloads(t, "removed", e)
+	}
+}
+
+/*
+testEncryptionPredicates makes sure predicates are rejected with a 400 error when
+payloads are encrypted, including when iterating over entries.
+*/
+func testEncryptionPredicates(t *testing.T, factory EncryptionFactory) {
+	s := factory(t, keyring(t))
+	mustAddEvents(t, s, event("crm", "register", at(0), job("warehouse", "load", store.StatusAcknowledged)))
+
+	where := &store.WhereEvents{
+		Predicates: []*store.Predicate{
+			predicate(t, "data.user.id:eq:42"),
+		},
+	}
+
+	assert := func(what string, err error) {
+		t.Helper()
+
+		if fail, ok := err.(*errors.Error); !ok || fail.StatusCode != 400 {
+			t.Fatalf("%s: expected a 400 error, found %v", what, err)
+		}
+	}
+
+	_, _, err := s.FindEvents(toolkit(), where)
+	assert("find events", err)
+
+	_, _, err = s.FindJobs(toolkit(), &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			Predicates: where.Predicates,
+		},
+	})
+
+	assert("find jobs", err)
+	assert("iterate events", s.IterateEvents(toolkit(), where, func(*store.Event) error {
+		return nil
+	}))
+
+	assert("iterate jobs", s.IterateJobs(toolkit(), where, func(*store.Job) error {
+		return nil
+	}))
+
+	assert("iterate transitions", s.IterateTransitions(toolkit(), where, func(*store.Transition) error {
+		return nil
+	}))
+}
+
+/*
+testEncryptionRequired makes sure re-encrypting a store without encryption returns
+a 400 error.
+*/
+func testEncryptionRequired(t *testing.T, factory EncryptionFactory) {
+	s := factory(t, nil)
+	mustAddEvents(t, s, event("crm", "register", at(0)))
+
+	count, err := s.Reencrypt(toolkit())
+	if fail, ok := err.(*errors.Error); !ok || fail.StatusCode != 400 {
+		t.Fatalf("reencrypt: expected a 400 error, found %v", err)
+	}
+
+	if count != 0 {
+		t.Fatalf("reencrypt: expected no entry re-encrypted, found %d", count)
+	}
+}
+
+/*
+testEncryptionArchive makes sure archives hold encrypted payloads only, and that
+they are decrypted when restored.
+*/
+func testEncryptionArchive(t *testing.T, factory EncryptionFactory) {
+	s := factory(t, keyring(t))
+	dir := t.TempDir()
+
+	e := event("crm", "register", at(0), job("warehouse", "load", store.StatusAcknowledged))
+	mustAddEvents(t, s, e)
+
+	report, err := storearchive.Purge(toolkit(), s, &store.PurgePolicy{
+		WhereEvents: &store.WhereEvents{},
+		ArchiveTo:   dir,
+	})
+
+	if err != nil || report.Archived != 1 {
+		t.Fatalf("purge: expected the event to be archived, found %+v and %v", report, err)
+	}
+
+	plaintexts := [][]byte{}
+	for _, payload := range [][]byte{e.Context, e.Data} {
+		plaintexts = append(plaintexts, payload, []byte(base64.StdEncoding.EncodeToString(payload)))
+	}
+
+	files := 0
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+
+		archive, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+
+		files++
+		for _, plaintext := range plaintexts {
+			if bytes.Contains(archive, plaintext) {
+				t.Fatalf("archive: expected no payload in clear text, found %q in %s", plaintext, path)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil || files != 1 {
+		t.Fatalf("archive: expected a single archive file, found %d and %v", files, err)
+	}
+
+	restored, err := storearchive.Restore(toolkit(), s, dir)
+	if err != nil || restored != 1 {
+		t.Fatalf("restore: expected the event to be restored, found %d and %v", restored, err)
+	}
+
+	found, err := s.FindEvent(toolkit(), e.ID)
+	if err != nil {
+		t.Fatalf("find event: unexpected error: %v", err)
+	}
+
+	assertPayloads(t, "restore", found)
+	history, err := s.FindJobHistory(toolkit(), e.Jobs[0].ID)
+	if err != nil {
+		t.Fatalf("history: unexpected error: %v", err)
+	}
+
+	assertPayloads(t, "restore", &store.Event{
+		Context: history.Context,
+		Data:    history.Data,
+	})
+}
@@ -0,0 +1,456 @@
+package storetest
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/rest"
+)
+
+/*
+testAddEvents makes sure events are inserted along their jobs and transitions,
+and can be found with their content.
+*/
+func testAddEvents(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	parent := event("crm", "register", at(0), job("zendesk", "identify", store.StatusAcknowledged))
+	sub := event("crm", "register", at(1))
+	sub.ParentEventID = &parent.ID
+	mustAddEvents(t, s, parent, sub)
+
+	found, err := s.FindEvent(toolkit(), parent.ID)
+	if err != nil {
+		t.Fatalf("FindEvent: unexpected error: %v", err)
+	}
+
+	if found.ID != parent.ID || found.Source != "crm" || found.Trigger != "register" || found.Version != "v1" {
+		t.Fatalf("FindEvent: unexpected event: %+v", found)
+	}
+
+	if !bytes.Equal(found.Context, parent.Context) || !bytes.Equal(found.Data, parent.Data) {
+		t.Fatalf("FindEvent: context and data must be returned as inserted")
+	}
+
+	if !found.ReceivedAt.Equal(at(0)) {
+		t.Fatalf("FindEvent: expected received at %v, found %v", at(0), found.ReceivedAt)
+	}
+
+	if found.IngestedAt == nil {
+		t.Fatalf("FindEvent: ingested at must be set by the store")
+	}
+
+	if len(found.Jobs) != 1 || found.Jobs[0].ID != parent.Jobs[0].ID {
+		t.Fatalf("FindEvent: expected the event's job, found %v", jobIDs(found.Jobs))
+	}
+
+	if found.Jobs[0].EventID != parent.ID {
+		t.Fatalf("FindEvent: expected job related to event %s, found %s", parent.ID, found.Jobs[0].EventID)
+	}
+
+	latest := found.Jobs[0].Transitions[0]
+	if latest == nil || latest.StateAfter != store.StatusAcknowledged {
+		t.Fatalf("FindEvent: expected the job's transition to be returned")
+	}
+
+	if latest.JobID != parent.Jobs[0].ID || latest.EventID != parent.ID {
+		t.Fatalf("FindEvent: transition must be related to its job and event")
+	}
+
+	found, err = s.FindEvent(toolkit(), sub.ID)
+	if err != nil {
+		t.Fatalf("FindEvent: unexpected error: %v", err)
+	}
+
+	if found.ParentEventID == nil || *found.ParentEventID != parent.ID {
+		t.Fatalf("FindEvent: expected parent event ID %s", parent.ID)
+	}
+
+	if len(found.Jobs) != 0 {
+		t.Fatalf("FindEvent: expected no jobs, found %v", jobIDs(found.Jobs))
+	}
+}
+
+/*
+testAddEventsAtomic makes sure no entries are inserted when a queue of events can
+not be entirely inserted.
+*/
+func testAddEventsAtomic(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	existing := event("crm", "register", at(0))
+	mustAddEvents(t, s, existing)
+
+	fresh := event("crm", "register", at(1), job("zendesk", "identify", store.StatusAcknowledged))
+	err := s.AddEvents(toolkit(), []*store.Event{fresh, existing})
+	assertValidation(t, "AddEvents with an existing event", err, "Event", existing.ID, "ID")
+
+	if _, err := s.FindEvent(toolkit(), fresh.ID); err == nil {
+		t.Fatalf("AddEvents: no events must be inserted when the queue fails")
+	}
+
+	if _, err := s.FindJob(toolkit(), fresh.Jobs[0].ID); err == nil {
+		t.Fatalf("AddEvents: no jobs must be inserted when the queue fails")
+	}
+}
+
+/*
+testFindEventNotFound makes sure an error is returned for unknown events.
+*/
+func testFindEventNotFound(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	found, err := s.FindEvent(toolkit(), "1UYc8EebLqCAFMOSkbYZdJwNLAJ")
+	if err == nil {
+		t.Fatalf("FindEvent: expected an error, found %+v", found)
+	}
+}
+
+/*
+testFindEventsFilters makes sure every constraints at the event level are applied.
+*/
+func testFindEventsFilters(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	a := event("crm", "register", at(0))
+	b := event("crm", "unregister", at(10))
+	c := event("shop", "order", at(20))
+	c.Version = "v2"
+	mustAddEvents(t, s, a, b, c)
+
+	before := at(10)
+	after := at(0)
+	tests := []struct {
+		name     string
+		where    *store.WhereEvents
+		expected []string
+	}{
+		{"nil", nil, []string{a.ID, b.ID, c.ID}},
+		{"empty", &store.WhereEvents{}, []string{a.ID, b.ID, c.ID}},
+		{"SourcesIn", &store.WhereEvents{SourcesIn: []string{"crm"}}, []string{a.ID, b.ID}},
+		{"SourcesNotIn", &store.WhereEvents{SourcesNotIn: []string{"crm"}}, []string{c.ID}},
+		{"TriggersIn", &store.WhereEvents{TriggersIn: []string{"register", "order"}}, []string{a.ID, c.ID}},
+		{"TriggersNotIn", &store.WhereEvents{TriggersNotIn: []string{"register"}}, []string{b.ID, c.ID}},
+		{"VersionsIn", &store.WhereEvents{VersionsIn: []string{"v2"}}, []string{c.ID}},
+		{"VersionsNotIn", &store.WhereEvents{VersionsNotIn: []string{"v2"}}, []string{a.ID, b.ID}},
+		{"ReceivedBefore", &store.WhereEvents{ReceivedBefore: &before}, []string{a.ID}},
+		{"ReceivedAfter", &store.WhereEvents{ReceivedAfter: &after}, []string{b.ID, c.ID}},
+		{"ReceivedBetween", &store.WhereEvents{ReceivedAfter: &after, ReceivedBefore: &before}, []string{}},
+		{"Combined", &store.WhereEvents{SourcesIn: []string{"crm"}, TriggersNotIn: []string{"unregister"}}, []string{a.ID}},
+	}
+
+	for _, test := range tests {
+		events, meta := mustFindEvents(t, s, test.where)
+		assertIDs(t, test.name, eventIDs(events), test.expected...)
+
+		if int(meta.Count) != len(test.expected) {
+			t.Fatalf("%s: expected count %d, found %d", test.name, len(test.expected), meta.Count)
+		}
+	}
+}
+
+/*
+testFindEventsPagination makes sure offset, limit, count, and pagination are
+consistent. Events are returned in chronological order.
+*/
+func testFindEventsPagination(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	ids := []string{}
+	for i := 0; i < 5; i++ {
+		e := event("crm", "register", at(i))
+		mustAddEvents(t, s, e)
+		ids = append(ids, e.ID)
+	}
+
+	events, meta := mustFindEvents(t, s, &store.WhereEvents{})
+	assertIDs(t, "default", eventIDs(events), ids...)
+	if meta.Where == nil || meta.Where.Limit == 0 {
+		t.Fatalf("default: meta must include the limit actually applied")
+	}
+
+	events, meta = mustFindEvents(t, s, &store.WhereEvents{Offset: 2, Limit: 2})
+	assertIDs(t, "page 2", eventIDs(events), ids[2:4]...)
+	if meta.Count != 5 {
+		t.Fatalf("page 2: expected count without the limit, found %d", meta.Count)
+	}
+
+	p := meta.Pagination
+	if p == nil || p.Current != 2 || p.First != 1 || p.Last != 3 {
+		t.Fatalf("page 2: unexpected pagination: %+v", p)
+	}
+
+	if p.Previous == nil || *p.Previous != 1 || p.Next == nil || *p.Next != 3 {
+		t.Fatalf("page 2: unexpected previous and next pages: %+v", p)
+	}
+
+	events, meta = mustFindEvents(t, s, &store.WhereEvents{Offset: 4, Limit: 2})
+	assertIDs(t, "last page", eventIDs(events), ids[4])
+	if meta.Pagination.Next != nil {
+		t.Fatalf("last page: expected no next page")
+	}
+
+	events, meta = mustFindEvents(t, s, &store.WhereEvents{Offset: 10, Limit: 2})
+	assertIDs(t, "beyond", eventIDs(events))
+	if meta.Count != 5 {
+		t.Fatalf("beyond: expected count 5, found %d", meta.Count)
+	}
+
+	events, _ = mustFindEvents(t, s, &store.WhereEvents{
+		SourcesIn: []string{"crm"},
+		Limit:     1,
+	})
+
+	assertIDs(t, "filtered", eventIDs(events), ids[0])
+}
+
+/*
+testFindEventsCursors makes sure cursors returned in the meta allow to walk through
+the events forward and backward, including events received at the same instant.
+*/
+func testFindEventsCursors(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	ids := []string{}
+	for i := 0; i < 5; i++ {
+		e := event("crm", "register", at(i))
+		mustAddEvents(t, s, e)
+		ids = append(ids, e.ID)
+	}
+
+	events, meta := mustFindEvents(t, s, &store.WhereEvents{Limit: 2})
+	assertIDs(t, "first", eventIDs(events), ids[0:2]...)
+	if meta.Cursors == nil || meta.Cursors.Next == nil || meta.Cursors.Previous != nil {
+		t.Fatalf("first: unexpected cursors: %+v", meta.Cursors)
+	}
+
+	events, meta = mustFindEvents(t, s, &store.WhereEvents{After: *meta.Cursors.Next, Limit: 2})
+	assertIDs(t, "second", eventIDs(events), ids[2:4]...)
+	if meta.Count != 5 || meta.Pagination != nil {
+		t.Fatalf("second: expected count 5 and no pagination, found %d and %+v", meta.Count, meta.Pagination)
+	}
+
+	if meta.Cursors.Next == nil || meta.Cursors.Previous == nil {
+		t.Fatalf("second: expected next and previous cursors: %+v", meta.Cursors)
+	}
+
+	previous := *meta.Cursors.Previous
+	events, meta = mustFindEvents(t, s, &store.WhereEvents{After: *meta.Cursors.Next, Limit: 2})
+	assertIDs(t, "last", eventIDs(events), ids[4])
+	if meta.Cursors.Next != nil || meta.Cursors.Previous == nil {
+		t.Fatalf("last: unexpected cursors: %+v", meta.Cursors)
+	}
+
+	events, meta = mustFindEvents(t, s, &store.WhereEvents{Before: previous, Limit: 1})
+	assertIDs(t, "backward", eventIDs(events), ids[1])
+	if meta.Cursors.Next == nil || meta.Cursors.Previous == nil {
+		t.Fatalf("backward: unexpected cursors: %+v", meta.Cursors)
+	}
+
+	events, _ = mustFindEvents(t, s, &store.WhereEvents{
+		After:  (rest.Cursor{At: at(0), ID: ids[0]}).String(),
+		Before: (rest.Cursor{At: at(4), ID: ids[4]}).String(),
+	})
+
+	assertIDs(t, "between", eventIDs(events), ids[1:4]...)
+
+	same := []string{}
+	for i := 0; i < 3; i++ {
+		e := event("crm", "identify", at(10))
+		mustAddEvents(t, s, e)
+		same = append(same, e.ID)
+	}
+
+	sort.Strings(same)
+	events, meta = mustFindEvents(t, s, &store.WhereEvents{
+		TriggersIn: []string{"identify"},
+		Limit:      2,
+	})
+
+	assertIDs(t, "same instant", eventIDs(events), same[0:2]...)
+	events, _ = mustFindEvents(t, s, &store.WhereEvents{
+		TriggersIn: []string{"identify"},
+		After:      *meta.Cursors.Next,
+	})
+
+	assertIDs(t, "same instant next", eventIDs(events), same[2])
+
+	_, _, err := s.FindEvents(toolkit(), &store.WhereEvents{After: "not a cursor"})
+	if err == nil {
+		t.Fatalf("malformed: expected an error")
+	}
+}
+
+/*
+testFindEventByIdempotencyKey makes sure duplicate events are detected given their
+tenant, source, and idempotency key, only within the idempotency window of the
+store.
+*/
+func testFindEventByIdempotencyKey(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	now := time.Now().UTC()
+	expired := event("crm", "register", now.Add(-s.Options().IdempotencyWindow-time.Hour))
+	expired.IdempotencyKey = "delivery-1"
+	original := event("crm", "register", now.Add(-time.Minute), job("warehouse", "load", store.StatusAcknowledged))
+	original.IdempotencyKey = "delivery-1"
+	other := event("shop", "order", now.Add(-time.Second))
+	other.IdempotencyKey = "delivery-1"
+	anonymous := event("crm", "register", now)
+	mustAddEvents(t, s, expired, original, other, anonymous)
+
+	found, err := s.FindEventByIdempotencyKey(toolkit(), "", "crm", "delivery-1")
+	if err != nil {
+		t.Fatalf("duplicate: unexpected error: %v", err)
+	}
+
+	if found.ID != original.ID || found.IdempotencyKey != "delivery-1" || len(found.Jobs) != 1 {
+		t.Fatalf("duplicate: expected the original event with its jobs, found %+v", found)
+	}
+
+	found, err = s.FindEventByIdempotencyKey(toolkit(), "", "shop", "delivery-1")
+	if err != nil || found.ID != other.ID {
+		t.Fatalf("source: expected keys to be scoped by source, found %+v and %v", found, err)
+	}
+
+	acme := event("crm", "register", now.Add(-time.Second))
+	acme.Tenant = "acme"
+	acme.IdempotencyKey = "delivery-1"
+	globex := event("crm", "register", now)
+	globex.Tenant = "globex"
+	globex.IdempotencyKey = "delivery-1"
+	mustAddEvents(t, s, acme, globex)
+
+	found, err = s.FindEventByIdempotencyKey(toolkit(), "acme", "crm", "delivery-1")
+	if err != nil || found.ID != acme.ID {
+		t.Fatalf("tenant: expected keys to be scoped by tenant, found %+v and %v", found, err)
+	}
+
+	found, err = s.FindEventByIdempotencyKey(tenantOf("globex"), "globex", "crm", "delivery-1")
+	if err != nil || found.ID != globex.ID {
+		t.Fatalf("tenant: expected keys to be scoped by tenant, found %+v and %v", found, err)
+	}
+
+	found, err = s.FindEventByIdempotencyKey(toolkit(), "", "crm", "delivery-1")
+	if err != nil || found.ID != original.ID {
+		t.Fatalf("tenant: expected keys to be scoped by tenant, found %+v and %v", found, err)
+	}
+
+	_, err = s.FindEventByIdempotencyKey(tenantOf("globex"), "acme", "crm", "delivery-1")
+	if err == nil {
+		t.Fatalf("tenant: expected an error for an event of another tenant")
+	}
+
+	_, err = s.FindEventByIdempotencyKey(toolkit(), "", "crm", "delivery-2")
+	if err == nil {
+		t.Fatalf("unknown: expected an error")
+	}
+
+	_, err = s.FindEventByIdempotencyKey(toolkit(), "", "crm", "")
+	if err == nil {
+		t.Fatalf("empty: expected an error since events without key are never duplicates")
+	}
+}
+
+/*
+testAddEventsIdempotency makes sure duplicate events are not inserted by AddEvents,
+whether the original event is in the store or earlier in the queue, and that their
+ID is replaced by the one of the original event.
+*/
+func testAddEventsIdempotency(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	now := time.Now().UTC()
+	original := event("crm", "register", now.Add(-time.Minute), job("warehouse", "load", store.StatusAcknowledged))
+	original.IdempotencyKey = "delivery-1"
+	mustAddEvents(t, s, original)
+
+	duplicate := event("crm", "register", now, job("warehouse", "load", store.StatusAcknowledged))
+	duplicate.IdempotencyKey = "delivery-1"
+	parent := duplicate.ID
+	sub := event("crm", "register", now)
+	sub.ParentEventID = &parent
+	first := event("crm", "register", now)
+	first.IdempotencyKey = "delivery-2"
+	second := event("crm", "register", now, job("warehouse", "load", store.StatusAcknowledged))
+	second.IdempotencyKey = "delivery-2"
+	subID := sub.ID
+	mustAddEvents(t, s, duplicate, sub, first, second)
+
+	if duplicate.ID != original.ID {
+		t.Fatalf("duplicate: expected ID %q of the original event, found %q", original.ID, duplicate.ID)
+	}
+
+	if second.ID != first.ID {
+		t.Fatalf("queue: expected ID %q of the first event, found %q", first.ID, second.ID)
+	}
+
+	if sub.ID != subID || *sub.ParentEventID != parent {
+		t.Fatalf("sub-event: expected the queue to be left untouched, found %+v", sub)
+	}
+
+	events, _ := mustFindEvents(t, s, nil)
+	assertSet(t, "events", eventIDs(events), original.ID, subID, first.ID)
+
+	jobs, _ := mustFindJobs(t, s, nil)
+	assertIDs(t, "jobs", jobIDs(jobs), original.Jobs[0].ID)
+
+	found, err := s.FindEvent(toolkit(), subID)
+	if err != nil {
+		t.Fatalf("sub-event: unexpected error: %v", err)
+	}
+
+	if found.ParentEventID == nil || *found.ParentEventID != original.ID {
+		t.Fatalf("sub-event: expected to be related to the original event, found %+v", found.ParentEventID)
+	}
+}
+
+/*
+testAddEventsIdempotencyConcurrent makes sure a single event is inserted when
+duplicates are added concurrently.
+*/
+func testAddEventsIdempotencyConcurrent(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	now := time.Now().UTC()
+	duplicates := []*store.Event{}
+	for i := 0; i < 8; i++ {
+		e := event("crm", "register", now, job("warehouse", "load", store.StatusAcknowledged))
+		e.IdempotencyKey = "delivery-1"
+		e.Jobs[0].EventID = e.ID
+		duplicates = append(duplicates, e)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(duplicates))
+	for _, e := range duplicates {
+		wg.Add(1)
+		go func(e *store.Event) {
+			defer wg.Done()
+			errs <- s.AddEvents(toolkit(), []*store.Event{e})
+		}(e)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("AddEvents: unexpected error: %v", err)
+		}
+	}
+
+	events, _ := mustFindEvents(t, s, nil)
+	if len(events) != 1 || len(events[0].Jobs) != 1 {
+		t.Fatalf("concurrent: expected a single event with its job, found %d events", len(events))
+	}
+
+	for _, e := range duplicates {
+		if e.ID != events[0].ID {
+			t.Fatalf("concurrent: expected ID %q of the original event, found %q", events[0].ID, e.ID)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package storetest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+testIterate makes sure iterating over events, jobs, and transitions visits every
+entries matching the constraints in chronological order, regardless of the offset
+and limit, and stops as soon as the function returns an error. Enough entries are
+inserted to span across several batches.
+*/
+func testIterate(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	events := []*store.Event{}
+	ids := []string{}
+	for i := 0; i < 250; i++ {
+		e := event("crm", "register", at(i), job("warehouse", "load", store.StatusAcknowledged))
+		events = append(events, e)
+		ids = append(ids, e.ID)
+	}
+
+	events = append(events, event("api", "register", at(0)))
+	mustAddEvents(t, s, events...)
+
+	where := &store.WhereEvents{
+		SourcesIn: []string{"crm"},
+		Offset:    10,
+		Limit:     1,
+	}
+
+	visited := []string{}
+	err := s.IterateEvents(toolkit(), where, func(e *store.Event) error {
+		if len(e.Jobs) != 1 || e.Jobs[0].Transitions[0] == nil {
+			t.Fatalf("events: expected event %s to have its job with its latest transition", e.ID)
+		}
+
+		visited = append(visited, e.ID)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("events: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "events", visited, ids...)
+
+	count := 0
+	err = s.IterateJobs(toolkit(), where, func(j *store.Job) error {
+		count++
+		return nil
+	})
+
+	if err != nil || count != 250 {
+		t.Fatalf("jobs: expected 250 jobs and no error, found %d and %v", count, err)
+	}
+
+	count = 0
+	err = s.IterateTransitions(toolkit(), where, func(tr *store.Transition) error {
+		count++
+		return nil
+	})
+
+	if err != nil || count != 250 {
+		t.Fatalf("transitions: expected 250 transitions and no error, found %d and %v", count, err)
+	}
+
+	stop := errors.New("stop")
+	count = 0
+	err = s.IterateEvents(toolkit(), where, func(e *store.Event) error {
+		count++
+		if count == 120 {
+			return stop
+		}
+
+		return nil
+	})
+
+	if err != stop || count != 120 {
+		t.Fatalf("stop: expected to stop after 120 events with the error returned, found %d and %v", count, err)
+	}
+}
@@ -0,0 +1,383 @@
+package storetest
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+testAddJobs makes sure jobs can be added to existing events, and are rejected for
+unknown events.
+*/
+func testAddJobs(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	e := event("crm", "register", at(0))
+	mustAddEvents(t, s, e)
+
+	j := job("zendesk", "identify", store.StatusAcknowledged)
+	j.EventID = e.ID
+	if err := s.AddJobs(toolkit(), []*store.Job{j}); err != nil {
+		t.Fatalf("AddJobs: unexpected error: %v", err)
+	}
+
+	child := job("zendesk", "notify", store.StatusAcknowledged)
+	child.EventID = e.ID
+	child.ParentJobID = &j.ID
+	if err := s.AddJobs(toolkit(), []*store.Job{child}); err != nil {
+		t.Fatalf("AddJobs: unexpected error: %v", err)
+	}
+
+	found, err := s.FindJob(toolkit(), child.ID)
+	if err != nil {
+		t.Fatalf("FindJob: unexpected error: %v", err)
+	}
+
+	if found.Destination != "zendesk" || found.Action != "notify" || found.EventID != e.ID {
+		t.Fatalf("FindJob: unexpected job: %+v", found)
+	}
+
+	if found.ParentJobID == nil || *found.ParentJobID != j.ID {
+		t.Fatalf("FindJob: expected parent job ID %s", j.ID)
+	}
+
+	if found.Transitions[0] == nil || found.Transitions[0].StateAfter != store.StatusAcknowledged {
+		t.Fatalf("FindJob: expected the job's transition to be returned")
+	}
+
+	if _, err := s.FindJob(toolkit(), "1UYc8EebLqCAFMOSkbYZdJwNLAJ"); err == nil {
+		t.Fatalf("FindJob: expected an error for an unknown job")
+	}
+
+	orphan := job("zendesk", "identify", store.StatusAcknowledged)
+	orphan.EventID = "1UYc8EebLqCAFMOSkbYZdJwNLAJ"
+	if err := s.AddJobs(toolkit(), []*store.Job{orphan}); err == nil {
+		t.Fatalf("AddJobs: expected an error for a job related to an unknown event")
+	}
+}
+
+/*
+testFindJobsLatestTransition makes sure only the latest transition of a job is
+returned in Transitions[0], regardless of the method used.
+*/
+func testFindJobsLatestTransition(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	j := job("zendesk", "identify", store.StatusAcknowledged)
+	e := event("crm", "register", at(0), j)
+	mustAddEvents(t, s, e)
+	mustAddTransitions(t, s,
+		transition(j, 0, store.StatusAcknowledged, store.StatusAwaiting, at(1)),
+		transition(j, 1, store.StatusAwaiting, store.StatusExecuting, at(2)),
+		transition(j, 1, store.StatusExecuting, store.StatusFailed, at(3)),
+	)
+
+	check := func(method string, found *store.Job) {
+		t.Helper()
+
+		latest := found.Transitions[0]
+		if latest == nil || latest.StateAfter != store.StatusFailed || latest.Attempt != 1 {
+			t.Fatalf("%s: expected the latest transition, found %+v", method, latest)
+		}
+
+		if latest.StateBefore == nil || *latest.StateBefore != store.StatusExecuting {
+			t.Fatalf("%s: expected state before %q", method, store.StatusExecuting)
+		}
+	}
+
+	found, err := s.FindJob(toolkit(), j.ID)
+	if err != nil {
+		t.Fatalf("FindJob: unexpected error: %v", err)
+	}
+
+	check("FindJob", found)
+
+	jobs, _ := mustFindJobs(t, s, nil)
+	assertIDs(t, "FindJobs", jobIDs(jobs), j.ID)
+	check("FindJobs", jobs[0])
+
+	evt, err := s.FindEvent(toolkit(), e.ID)
+	if err != nil {
+		t.Fatalf("FindEvent: unexpected error: %v", err)
+	}
+
+	check("FindEvent", evt.Jobs[0])
+
+	events, _ := mustFindEvents(t, s, nil)
+	check("FindEvents", events[0].Jobs[0])
+}
+
+/*
+testFindJobsFilters makes sure every constraints at the job level are applied,
+alongside the ones at the event level.
+*/
+func testFindJobsFilters(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	a := job("zendesk", "identify", store.StatusSucceeded)
+	b := job("zendesk", "track", store.StatusFailed)
+	b.CreatedAt = at(10)
+	c := job("mailchimp", "subscribe", store.StatusDiscarded)
+	c.Version = "v2"
+	c.CreatedAt = at(20)
+	mustAddEvents(t, s,
+		event("crm", "register", at(0), a, b),
+		event("shop", "order", at(0), c),
+	)
+
+	mustAddTransitions(t, s, transition(b, 3, store.StatusExecuting, store.StatusFailed, at(30)))
+
+	before := at(10)
+	after := at(0)
+	tests := []struct {
+		name     string
+		where    *store.WhereJobs
+		expected []string
+	}{
+		{"DestinationsIn", &store.WhereJobs{DestinationsIn: []string{"zendesk"}}, []string{a.ID, b.ID}},
+		{"DestinationsNotIn", &store.WhereJobs{DestinationsNotIn: []string{"zendesk"}}, []string{c.ID}},
+		{"ActionsIn", &store.WhereJobs{ActionsIn: []string{"track", "subscribe"}}, []string{b.ID, c.ID}},
+		{"ActionsNotIn", &store.WhereJobs{ActionsNotIn: []string{"track"}}, []string{a.ID, c.ID}},
+		{"VersionsIn", &store.WhereJobs{VersionsIn: []string{"v2"}}, []string{c.ID}},
+		{"VersionsNotIn", &store.WhereJobs{VersionsNotIn: []string{"v2"}}, []string{a.ID, b.ID}},
+		{"CreatedBefore", &store.WhereJobs{CreatedBefore: &before}, []string{a.ID}},
+		{"CreatedAfter", &store.WhereJobs{CreatedAfter: &after}, []string{b.ID, c.ID}},
+		{"StatusIn", &store.WhereJobs{AndWhereTransitions: &store.WhereTransitions{
+			StatusIn: []string{store.StatusFailed, store.StatusDiscarded},
+		}}, []string{b.ID, c.ID}},
+		{"StatusNotIn", &store.WhereJobs{AndWhereTransitions: &store.WhereTransitions{
+			StatusNotIn: []string{store.StatusFailed},
+		}}, []string{a.ID, c.ID}},
+		{"MinAttempts", &store.WhereJobs{AndWhereTransitions: &store.WhereTransitions{
+			MinAttempts: 2,
+		}}, []string{b.ID}},
+		{"MaxAttempts", &store.WhereJobs{AndWhereTransitions: &store.WhereTransitions{
+			MaxAttempts: 2,
+		}}, []string{a.ID, c.ID}},
+	}
+
+	for _, test := range tests {
+		jobs, meta := mustFindJobs(t, s, &store.WhereEvents{AndWhereJobs: test.where})
+		assertIDs(t, test.name, jobIDs(jobs), test.expected...)
+
+		if int(meta.Count) != len(test.expected) {
+			t.Fatalf("%s: expected count %d, found %d", test.name, len(test.expected), meta.Count)
+		}
+	}
+
+	jobs, _ := mustFindJobs(t, s, &store.WhereEvents{SourcesIn: []string{"crm"}})
+	assertIDs(t, "SourcesIn", jobIDs(jobs), a.ID, b.ID)
+
+	jobs, _ = mustFindJobs(t, s, &store.WhereEvents{
+		SourcesIn: []string{"crm"},
+		AndWhereJobs: &store.WhereJobs{
+			ActionsIn: []string{"identify"},
+		},
+	})
+
+	assertIDs(t, "SourcesIn and ActionsIn", jobIDs(jobs), a.ID)
+
+	jobs, meta := mustFindJobs(t, s, &store.WhereEvents{Offset: 1, Limit: 1})
+	assertIDs(t, "pagination", jobIDs(jobs), b.ID)
+	if meta.Count != 3 {
+		t.Fatalf("pagination: expected count 3, found %d", meta.Count)
+	}
+}
+
+/*
+testFindJobsByEventID makes sure every jobs of an event are returned when the
+event ID is set, regardless the other constraints.
+*/
+func testFindJobsByEventID(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	a := job("zendesk", "identify", store.StatusSucceeded)
+	b := job("mailchimp", "subscribe", store.StatusFailed)
+	b.CreatedAt = at(1)
+	e := event("crm", "register", at(0), a, b)
+	mustAddEvents(t, s, e, event("crm", "register", at(1), job("zendesk", "identify", store.StatusSucceeded)))
+
+	jobs, _ := mustFindJobs(t, s, &store.WhereEvents{
+		SourcesIn: []string{"unknown"},
+		AndWhereJobs: &store.WhereJobs{
+			EventID:        e.ID,
+			DestinationsIn: []string{"unknown"},
+		},
+	})
+
+	assertIDs(t, "EventID", jobIDs(jobs), a.ID, b.ID)
+
+	jobs, _ = mustFindJobs(t, s, &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			EventID: e.ID,
+		},
+		Limit: 1,
+	})
+
+	assertIDs(t, "EventID with limit", jobIDs(jobs), a.ID)
+}
+
+/*
+testStatusInAndNotIn makes sure inclusion and exclusion conditions on status are
+combined as documented for purge policies: an event matches if at least one of its
+jobs has a status in StatusIn, and none of its jobs has a status in StatusNotIn.
+Jobs are only matched against their own latest transition.
+*/
+func testStatusInAndNotIn(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	succeeded := job("zendesk", "identify", store.StatusSucceeded)
+	mixedSucceeded := job("zendesk", "identify", store.StatusSucceeded)
+	mixedFailed := job("zendesk", "track", store.StatusFailed)
+	failed := job("zendesk", "identify", store.StatusFailed)
+
+	onlySucceeded := event("crm", "register", at(0), succeeded)
+	mixed := event("crm", "register", at(1), mixedSucceeded, mixedFailed)
+	onlyFailed := event("crm", "register", at(2), failed)
+	noJobs := event("crm", "register", at(3))
+	mustAddEvents(t, s, onlySucceeded, mixed, onlyFailed, noJobs)
+
+	in := []string{store.StatusSucceeded}
+	notin := []string{store.StatusFailed}
+
+	events, _ := mustFindEvents(t, s, whereStatus(in, nil))
+	assertIDs(t, "events with StatusIn", eventIDs(events), onlySucceeded.ID, mixed.ID)
+
+	events, _ = mustFindEvents(t, s, whereStatus(in, notin))
+	assertIDs(t, "events with StatusIn and StatusNotIn", eventIDs(events), onlySucceeded.ID)
+
+	events, _ = mustFindEvents(t, s, whereStatus(nil, notin))
+	assertIDs(t, "events with StatusNotIn", eventIDs(events), onlySucceeded.ID, noJobs.ID)
+
+	jobs, _ := mustFindJobs(t, s, whereStatus(in, notin))
+	assertSet(t, "jobs with StatusIn and StatusNotIn", jobIDs(jobs), succeeded.ID, mixedSucceeded.ID)
+
+	jobs, _ = mustFindJobs(t, s, whereStatus(nil, notin))
+	assertSet(t, "jobs with StatusNotIn", jobIDs(jobs), succeeded.ID, mixedSucceeded.ID)
+}
+
+/*
+testFindJobsCursors makes sure cursors returned in the meta allow to walk through
+the jobs forward and backward.
+*/
+func testFindJobsCursors(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	e := event("crm", "register", at(0))
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		j := job("warehouse", "load", "")
+		j.CreatedAt = at(i)
+		e.Jobs = append(e.Jobs, j)
+		ids = append(ids, j.ID)
+	}
+
+	mustAddEvents(t, s, e)
+
+	jobs, meta := mustFindJobs(t, s, &store.WhereEvents{Limit: 2})
+	assertIDs(t, "first", jobIDs(jobs), ids[0:2]...)
+	if meta.Cursors == nil || meta.Cursors.Next == nil {
+		t.Fatalf("first: expected a next cursor: %+v", meta.Cursors)
+	}
+
+	jobs, meta = mustFindJobs(t, s, &store.WhereEvents{After: *meta.Cursors.Next, Limit: 2})
+	assertIDs(t, "second", jobIDs(jobs), ids[2])
+	if meta.Cursors.Next != nil || meta.Cursors.Previous == nil {
+		t.Fatalf("second: unexpected cursors: %+v", meta.Cursors)
+	}
+
+	jobs, _ = mustFindJobs(t, s, &store.WhereEvents{Before: *meta.Cursors.Previous, Limit: 1})
+	assertIDs(t, "backward", jobIDs(jobs), ids[1])
+}
+
+/*
+testFindJobHistory makes sure the history of a job holds every transitions in
+chronological order, including their errors, while FindJob only returns the
+latest transition.
+*/
+func testFindJobHistory(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	j := job("warehouse", "load", store.StatusAcknowledged)
+	e := event("crm", "register", at(0), j)
+	mustAddEvents(t, s, e)
+
+	failure := transition(j, 1, store.StatusExecuting, store.StatusFailed, at(3))
+	failure.Error = &errors.Error{
+		StatusCode: 503,
+		Message:    "Service Unavailable",
+		Validations: []errors.Validation{
+			{
+				Message: "Destination is temporarily unavailable",
+				Path:    []string{"warehouse", "load"},
+			},
+		},
+		Retryable: true,
+	}
+
+	steps := []*store.Transition{
+		transition(j, 0, store.StatusAcknowledged, store.StatusAwaiting, at(1)),
+		transition(j, 1, store.StatusAwaiting, store.StatusExecuting, at(2)),
+		failure,
+		transition(j, 1, store.StatusFailed, store.StatusAwaiting, at(4)),
+		transition(j, 2, store.StatusAwaiting, store.StatusExecuting, at(5)),
+		transition(j, 2, store.StatusExecuting, store.StatusSucceeded, at(6)),
+	}
+
+	mustAddTransitions(t, s, steps[3], steps[0], steps[5], steps[1], steps[4], steps[2])
+
+	found, err := s.FindJob(toolkit(), j.ID)
+	if err != nil {
+		t.Fatalf("find: unexpected error: %v", err)
+	}
+
+	if len(found.History) != 0 {
+		t.Fatalf("find: expected no history, found %d transitions", len(found.History))
+	}
+
+	found, err = s.FindJobHistory(toolkit(), j.ID)
+	if err != nil {
+		t.Fatalf("history: unexpected error: %v", err)
+	}
+
+	if found.Transitions[0] == nil || found.Transitions[0].ID != steps[5].ID {
+		t.Fatalf("history: expected the latest transition to be set")
+	}
+
+	ids := []string{j.Transitions[0].ID}
+	for _, step := range steps {
+		ids = append(ids, step.ID)
+	}
+
+	assertIDs(t, "history", transitionIDs(found.History), ids...)
+	if !reflect.DeepEqual(found.History[3].Error, failure.Error) {
+		t.Fatalf("history: expected the failure to keep its error, found %v", found.History[3].Error)
+	}
+
+	b, err := json.Marshal(found.History[3])
+	if err != nil {
+		t.Fatalf("json: unexpected error: %v", err)
+	}
+
+	decoded := &store.Transition{}
+	if err := json.Unmarshal(b, decoded); err != nil {
+		t.Fatalf("json: unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded.Error, failure.Error) {
+		t.Fatalf("json: expected the error to round trip, found %v", decoded.Error)
+	}
+
+	if found.History[4].Error != nil {
+		t.Fatalf("history: expected no error, found %v", found.History[4].Error)
+	}
+
+	_, err = s.FindJobHistory(toolkit(), "1UYc8EebLqCAFMOSkbYZdJwNLAJ")
+	if err == nil {
+		t.Fatalf("not found: expected an error")
+	}
+}
@@ -0,0 +1,125 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+testLifecycle makes sure a job can go through every status of its lifecycle, as
+done by the gateway and the scheduler:
+
+  acknowledged -> awaiting -> executing -> succeeded
+  acknowledged -> awaiting -> executing -> failed -> executing -> discarded
+
+At each step, the job is only found given its latest status.
+*/
+func testLifecycle(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	ok := job("zendesk", "identify", store.StatusAcknowledged)
+	ko := job("zendesk", "track", store.StatusAcknowledged)
+	ko.CreatedAt = at(1)
+	mustAddEvents(t, s, event("crm", "register", at(0), ok, ko))
+
+	status := func(name string, expected map[string][]string) {
+		t.Helper()
+
+		for state, ids := range expected {
+			jobs, _ := mustFindJobs(t, s, whereStatus([]string{state}, nil))
+			assertIDs(t, name+": "+state, jobIDs(jobs), ids...)
+		}
+	}
+
+	status("gateway", map[string][]string{
+		store.StatusAcknowledged: {ok.ID, ko.ID},
+		store.StatusAwaiting:     {},
+	})
+
+	mustAddTransitions(t, s,
+		transition(ok, 0, store.StatusAcknowledged, store.StatusAwaiting, at(10)),
+		transition(ko, 0, store.StatusAcknowledged, store.StatusAwaiting, at(10)),
+	)
+
+	status("awaiting", map[string][]string{
+		store.StatusAcknowledged: {},
+		store.StatusAwaiting:     {ok.ID, ko.ID},
+	})
+
+	mustAddTransitions(t, s,
+		transition(ok, 1, store.StatusAwaiting, store.StatusExecuting, at(20)),
+		transition(ko, 1, store.StatusAwaiting, store.StatusExecuting, at(20)),
+	)
+
+	status("executing", map[string][]string{
+		store.StatusAwaiting:  {},
+		store.StatusExecuting: {ok.ID, ko.ID},
+	})
+
+	mustAddTransitions(t, s,
+		transition(ok, 1, store.StatusExecuting, store.StatusSucceeded, at(30)),
+		transition(ko, 1, store.StatusExecuting, store.StatusFailed, at(30)),
+	)
+
+	status("first attempt", map[string][]string{
+		store.StatusExecuting: {},
+		store.StatusSucceeded: {ok.ID},
+		store.StatusFailed:    {ko.ID},
+	})
+
+	mustAddTransitions(t, s,
+		transition(ko, 2, store.StatusFailed, store.StatusExecuting, at(40)),
+	)
+
+	mustAddTransitions(t, s,
+		transition(ko, 2, store.StatusExecuting, store.StatusDiscarded, at(50)),
+	)
+
+	status("second attempt", map[string][]string{
+		store.StatusExecuting: {},
+		store.StatusFailed:    {},
+		store.StatusSucceeded: {ok.ID},
+		store.StatusDiscarded: {ko.ID},
+	})
+
+	found, err := s.FindJob(toolkit(), ko.ID)
+	if err != nil {
+		t.Fatalf("FindJob: unexpected error: %v", err)
+	}
+
+	if found.Transitions[0].Attempt != 2 {
+		t.Fatalf("FindJob: expected attempt 2, found %d", found.Transitions[0].Attempt)
+	}
+
+	history, meta := mustFindTransitions(t, s, &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			AndWhereTransitions: &store.WhereTransitions{
+				JobID: ko.ID,
+			},
+		},
+	})
+
+	if meta.Count != 6 || len(history) != 6 {
+		t.Fatalf("FindTransitions: expected the 6 transitions of the job, found %d", len(history))
+	}
+
+	expected := []string{
+		store.StatusAcknowledged,
+		store.StatusAwaiting,
+		store.StatusExecuting,
+		store.StatusFailed,
+		store.StatusExecuting,
+		store.StatusDiscarded,
+	}
+
+	for i, tr := range history {
+		if tr.StateAfter != expected[i] {
+			t.Fatalf("FindTransitions: expected history %v, found %q at index %d", expected, tr.StateAfter, i)
+		}
+
+		if i > 0 && (tr.StateBefore == nil || *tr.StateBefore != expected[i-1]) {
+			t.Fatalf("FindTransitions: transition %d must start from %q", i, expected[i-1])
+		}
+	}
+}
@@ -0,0 +1,21 @@
+/*
+Package storetest provides a conformance test suite for store drivers. It is the
+executable contract of the store.Store interface: every drivers shall pass it so
+the same constraints mean the same thing regardless the datastore being used.
+
+Usage from a driver's test file:
+
+  func TestStore(t *testing.T) {
+    storetest.RunSuite(t, func(t *testing.T) store.Store {
+      s, err := mydriver.New(&store.Options{})
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      return s
+    })
+  }
+
+The factory is called once per test and must return an empty store.
+*/
+package storetest
@@ -0,0 +1,191 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+withData returns the event with its data replaced, and the same data for its jobs.
+*/
+func withData(e *store.Event, data string) *store.Event {
+	e.Data = []byte(data)
+	for _, j := range e.Jobs {
+		j.Data = []byte(data)
+	}
+
+	return e
+}
+
+/*
+predicate returns a predicate parsed from its string representation and fails
+the test if an error occurred.
+*/
+func predicate(t *testing.T, s string) *store.Predicate {
+	t.Helper()
+
+	p, err := store.ParsePredicate(s)
+	if err != nil {
+		t.Fatalf("ParsePredicate: unexpected error for %q: %v", s, err)
+	}
+
+	return p
+}
+
+/*
+testPredicates makes sure predicates on the JSON payloads of events and jobs are
+applied for every operators, and that values only match values of the same type.
+*/
+func testPredicates(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	alice := withData(event("crm", "register", at(0), job("warehouse", "load", store.StatusSucceeded)),
+		`{"user":{"id":42,"email":"alice@example.com"},"items":[{"sku":"A"}],"amount":10,"vip":true}`)
+	bob := withData(event("crm", "register", at(1), job("warehouse", "load", store.StatusSucceeded)),
+		`{"user":{"id":"42","email":"bob@example.com"},"items":[{"sku":"B"}],"amount":25.5,"vip":null}`)
+	carol := withData(event("crm", "register", at(2), job("warehouse", "load", store.StatusSucceeded)),
+		`{"user":{"id":7},"amount":"100","vip":false}`)
+	invalid := withData(event("crm", "register", at(3), job("warehouse", "load", store.StatusSucceeded)),
+		`not a json`)
+
+	mustAddEvents(t, s, alice, bob, carol, invalid)
+
+	tests := []struct {
+		predicate string
+		expected  []string
+	}{
+		{"data.user.id:eq:42", []string{alice.ID}},
+		{`data.user.id:eq:"42"`, []string{bob.ID}},
+		{"data.user.id:in:42,7", []string{alice.ID, carol.ID}},
+		{"data.user.email:eq:bob@example.com", []string{bob.ID}},
+		{"data.items[0].sku:eq:B", []string{bob.ID}},
+		{"data.items[1].sku:exists", []string{}},
+		{"data.items:exists", []string{alice.ID, bob.ID}},
+		{"data.vip:exists", []string{alice.ID, bob.ID, carol.ID}},
+		{"data.vip:eq:true", []string{alice.ID}},
+		{"data.vip:eq:false", []string{carol.ID}},
+		{"data.vip:eq:null", []string{bob.ID}},
+		{"data.amount:range:10,25.5", []string{alice.ID, bob.ID}},
+		{"data.amount:range:11,", []string{bob.ID}},
+		{"data.amount:range:,10", []string{alice.ID}},
+		{`data.amount:range:"1",`, []string{carol.ID}},
+		{"context.ip:eq:127.0.0.1", []string{alice.ID, bob.ID, carol.ID, invalid.ID}},
+	}
+
+	for _, test := range tests {
+		p := predicate(t, test.predicate)
+		events, meta := mustFindEvents(t, s, &store.WhereEvents{
+			Predicates: []*store.Predicate{p},
+		})
+
+		assertIDs(t, "events "+test.predicate, eventIDs(events), test.expected...)
+		if meta.Count != uint64(len(test.expected)) {
+			t.Fatalf("events %s: expected a count of %d, found %d", test.predicate, len(test.expected), meta.Count)
+		}
+
+		jobs, _ := mustFindJobs(t, s, &store.WhereEvents{
+			AndWhereJobs: &store.WhereJobs{
+				Predicates: []*store.Predicate{p},
+			},
+		})
+
+		expected := []string{}
+		for _, e := range []*store.Event{alice, bob, carol, invalid} {
+			for _, id := range test.expected {
+				if e.ID == id {
+					expected = append(expected, e.Jobs[0].ID)
+				}
+			}
+		}
+
+		assertSet(t, "jobs "+test.predicate, jobIDs(jobs), expected...)
+	}
+
+	events, _ := mustFindEvents(t, s, &store.WhereEvents{
+		Predicates: []*store.Predicate{
+			predicate(t, "data.user.id:in:42,\"42\""),
+			predicate(t, "data.amount:range:20,"),
+		},
+	})
+
+	assertIDs(t, "every predicates", eventIDs(events), bob.ID)
+
+	events, _ = mustFindEvents(t, s, &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			Predicates: []*store.Predicate{
+				{
+					Field:    store.FieldData,
+					Path:     "user.id",
+					Operator: store.OperatorEquals,
+					Values:   []interface{}{uint8(7)},
+				},
+			},
+		},
+	})
+
+	assertIDs(t, "events by jobs", eventIDs(events), carol.ID)
+
+	_, err := s.Purge(toolkit(), &store.WhereEvents{
+		Predicates: []*store.Predicate{predicate(t, "data.user.id:eq:42")},
+	}, false)
+
+	if err != nil {
+		t.Fatalf("purge: unexpected error: %v", err)
+	}
+
+	events, _ = mustFindEvents(t, s, nil)
+	assertIDs(t, "purge", eventIDs(events), bob.ID, carol.ID, invalid.ID)
+}
+
+/*
+testPredicatesNotValid makes sure predicates that are not valid are rejected with
+a 400 error, and can not be parsed.
+*/
+func testPredicatesNotValid(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	predicates := []*store.Predicate{
+		{Field: "metadata", Path: "user.id", Operator: store.OperatorExists},
+		{Field: store.FieldData, Path: "user..id", Operator: store.OperatorExists},
+		{Field: store.FieldData, Path: "user.id", Operator: "like", Values: []interface{}{"4%"}},
+		{Field: store.FieldData, Path: "user.id", Operator: store.OperatorEquals},
+		{Field: store.FieldData, Path: "user.id", Operator: store.OperatorIn},
+		{Field: store.FieldData, Path: "user.id", Operator: store.OperatorExists, Values: []interface{}{true}},
+		{Field: store.FieldData, Path: "user.id", Operator: store.OperatorRange, Values: []interface{}{1, "2"}},
+		{Field: store.FieldData, Path: "user.id", Operator: store.OperatorRange, Values: []interface{}{nil, nil}},
+		{Field: store.FieldData, Path: "user.id", Operator: store.OperatorEquals, Values: []interface{}{[]int{42}}},
+	}
+
+	for _, p := range predicates {
+		where := &store.WhereEvents{
+			Predicates: []*store.Predicate{p},
+		}
+
+		_, _, err := s.FindEvents(toolkit(), where)
+		if fail, ok := err.(*errors.Error); !ok || fail.StatusCode != 400 {
+			t.Fatalf("find events: expected a 400 error for %+v, found %v", p, err)
+		}
+
+		_, _, err = s.FindJobs(toolkit(), &store.WhereEvents{
+			AndWhereJobs: &store.WhereJobs{
+				Predicates: []*store.Predicate{p},
+			},
+		})
+
+		if fail, ok := err.(*errors.Error); !ok || fail.StatusCode != 400 {
+			t.Fatalf("find jobs: expected a 400 error for %+v, found %v", p, err)
+		}
+
+		if _, err := s.Purge(toolkit(), where, false); err == nil {
+			t.Fatalf("purge: expected an error for %+v", p)
+		}
+	}
+
+	for _, s := range []string{"data", "data.user.id", "data.user.id:between:1,2", "user.id:exists"} {
+		if _, err := store.ParsePredicate(s); err == nil {
+			t.Fatalf("parse: expected an error for %q", s)
+		}
+	}
+}
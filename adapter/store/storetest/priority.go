@@ -0,0 +1,102 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+testPriorities makes sure the priority and the instant before which a job must not
+run are persisted, and that jobs can be found given them.
+*/
+func testPriorities(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	later := at(3600)
+	low := job("warehouse", "load", store.StatusAwaiting)
+	low.Priority = -1
+	normal := job("warehouse", "load", store.StatusAwaiting)
+	high := job("warehouse", "load", store.StatusAwaiting)
+	high.Priority = 10
+	delayed := job("warehouse", "load", store.StatusAwaiting)
+	delayed.NotBefore = &later
+	mustAddEvents(t, s, event("crm", "register", at(0), low, normal, high, delayed))
+
+	found, err := s.FindJob(toolkit(), delayed.ID)
+	if err != nil {
+		t.Fatalf("find: unexpected error: %v", err)
+	}
+
+	if found.NotBefore == nil || !found.NotBefore.Equal(later) || found.Priority != 0 {
+		t.Fatalf("find: expected the job to be delayed, found %+v", found)
+	}
+
+	found, err = s.FindJob(toolkit(), high.ID)
+	if err != nil || found.Priority != 10 || found.NotBefore != nil {
+		t.Fatalf("find: expected the job to have a priority of 10, found %+v and %v", found, err)
+	}
+
+	zero, ten := 0, 10
+	where := func(wj *store.WhereJobs) *store.WhereEvents {
+		return &store.WhereEvents{
+			AndWhereJobs: wj,
+		}
+	}
+
+	jobs, _ := mustFindJobs(t, s, where(&store.WhereJobs{MinPriority: &zero}))
+	assertSet(t, "min priority", jobIDs(jobs), normal.ID, high.ID, delayed.ID)
+
+	jobs, _ = mustFindJobs(t, s, where(&store.WhereJobs{MaxPriority: &zero}))
+	assertSet(t, "max priority", jobIDs(jobs), low.ID, normal.ID, delayed.ID)
+
+	jobs, _ = mustFindJobs(t, s, where(&store.WhereJobs{MinPriority: &ten, MaxPriority: &ten}))
+	assertSet(t, "exact priority", jobIDs(jobs), high.ID)
+
+	now := at(60)
+	jobs, _ = mustFindJobs(t, s, where(&store.WhereJobs{ReadyAt: &now}))
+	assertSet(t, "ready", jobIDs(jobs), low.ID, normal.ID, high.ID)
+
+	jobs, _ = mustFindJobs(t, s, where(&store.WhereJobs{ReadyAt: &later}))
+	assertSet(t, "ready later", jobIDs(jobs), low.ID, normal.ID, high.ID, delayed.ID)
+
+	events, _ := mustFindEvents(t, s, where(&store.WhereJobs{MinPriority: &ten}))
+	if len(events) != 1 {
+		t.Fatalf("events: expected 1 event, found %d", len(events))
+	}
+}
+
+/*
+testClaimJobsPriority makes sure jobs are claimed by descending priority and then
+in chronological order, and that jobs having a NotBefore in the future are not
+claimed.
+*/
+func testClaimJobsPriority(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	future := time.Now().Add(time.Hour)
+	past := at(0)
+	first := job("warehouse", "load", store.StatusAwaiting)
+	second := job("warehouse", "load", store.StatusAwaiting)
+	urgent := job("mailer", "reset-password", store.StatusAwaiting)
+	urgent.Priority = 100
+	delayed := job("warehouse", "load", store.StatusAwaiting)
+	delayed.Priority = 200
+	delayed.NotBefore = &future
+	due := job("warehouse", "load", store.StatusAwaiting)
+	due.NotBefore = &past
+	for i, j := range []*store.Job{first, second, urgent, delayed, due} {
+		j.CreatedAt = at(i)
+		j.Transitions[0].CreatedAt = at(i)
+	}
+
+	mustAddEvents(t, s, event("crm", "register", at(0), first, second, urgent, delayed, due))
+
+	claimed, err := s.ClaimJobs(toolkit(), nil, "scheduler-1", time.Minute)
+	if err != nil {
+		t.Fatalf("claim: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "claim", jobIDs(claimed), urgent.ID, first.ID, second.ID, due.ID)
+}
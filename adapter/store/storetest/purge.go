@@ -0,0 +1,176 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+testPurge makes sure the purge deletes the entries matching the constraints of a
+purge policy, ignoring the offset and limit.
+*/
+func testPurge(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	succeeded := event("crm", "register", at(0), job("zendesk", "identify", store.StatusSucceeded))
+	mixed := event("crm", "register", at(1),
+		job("zendesk", "identify", store.StatusSucceeded),
+		job("zendesk", "track", store.StatusFailed),
+	)
+
+	other := event("shop", "order", at(2), job("zendesk", "identify", store.StatusSucceeded))
+	awaiting := event("crm", "register", at(3), job("zendesk", "identify", store.StatusAwaiting))
+	mustAddEvents(t, s, succeeded, mixed, other, awaiting)
+
+	policy := &store.PurgePolicy{
+		Interval: "@weekly",
+		WhereEvents: &store.WhereEvents{
+			SourcesIn: []string{"crm"},
+			AndWhereJobs: &store.WhereJobs{
+				AndWhereTransitions: &store.WhereTransitions{
+					StatusIn: []string{
+						store.StatusSucceeded,
+					},
+					StatusNotIn: []string{
+						store.StatusAcknowledged,
+						store.StatusAwaiting,
+						store.StatusExecuting,
+						store.StatusFailed,
+						store.StatusDiscarded,
+						store.StatusUnknown,
+					},
+				},
+			},
+			Limit: 1,
+		},
+	}
+
+	purged, err := s.Purge(toolkit(), policy.WhereEvents, false)
+	if err != nil {
+		t.Fatalf("Purge: unexpected error: %v", err)
+	}
+
+	assertPurged(t, "Purge", purged, 1, 1, 1)
+
+	events, _ := mustFindEvents(t, s, nil)
+	assertIDs(t, "remaining events", eventIDs(events), mixed.ID, other.ID, awaiting.ID)
+
+	if _, err := s.FindJob(toolkit(), succeeded.Jobs[0].ID); err == nil {
+		t.Fatalf("Purge: jobs of purged events must be deleted")
+	}
+
+	if _, err := s.FindTransition(toolkit(), succeeded.Jobs[0].Transitions[0].ID); err == nil {
+		t.Fatalf("Purge: transitions of purged events must be deleted")
+	}
+
+	jobs, _ := mustFindJobs(t, s, nil)
+	if len(jobs) != 4 {
+		t.Fatalf("Purge: expected 4 remaining jobs, found %d", len(jobs))
+	}
+
+	transitions, _ := mustFindTransitions(t, s, nil)
+	if len(transitions) != 4 {
+		t.Fatalf("Purge: expected 4 remaining transitions, found %d", len(transitions))
+	}
+
+	purged, err = s.Purge(toolkit(), &store.WhereEvents{}, false)
+	if err != nil {
+		t.Fatalf("Purge: unexpected error: %v", err)
+	}
+
+	assertPurged(t, "purge without constraints", purged, 3, 4, 4)
+
+	events, _ = mustFindEvents(t, s, nil)
+	assertIDs(t, "purge without constraints", eventIDs(events))
+}
+
+/*
+testPurgeCascade makes sure sub-events and child jobs are purged along their
+parent.
+*/
+func testPurgeCascade(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	parent := event("crm", "register", at(0), job("zendesk", "identify", store.StatusSucceeded))
+	sub := event("crm", "batch", at(0), job("zendesk", "identify", store.StatusFailed))
+	sub.ParentEventID = &parent.ID
+	mustAddEvents(t, s, parent, sub)
+
+	purged, err := s.Purge(toolkit(), &store.WhereEvents{TriggersIn: []string{"register"}}, false)
+	if err != nil {
+		t.Fatalf("Purge: unexpected error: %v", err)
+	}
+
+	assertPurged(t, "Purge", purged, 2, 2, 2)
+
+	if _, err := s.FindEvent(toolkit(), sub.ID); err == nil {
+		t.Fatalf("Purge: sub-events must be purged along their parent")
+	}
+
+	if _, err := s.FindJob(toolkit(), sub.Jobs[0].ID); err == nil {
+		t.Fatalf("Purge: jobs of sub-events must be purged along their event")
+	}
+}
+
+/*
+testPurgeEntries makes sure an event is purged only when every entries deleted in
+cascade along it are part of the entries passed, such as a new transition added
+after the entries have been archived.
+*/
+func testPurgeEntries(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	parent := event("crm", "register", at(0), job("zendesk", "identify", store.StatusFailed))
+	sub := event("crm", "batch", at(0), job("zendesk", "identify", store.StatusSucceeded))
+	sub.ParentEventID = &parent.ID
+	mustAddEvents(t, s, parent, sub)
+
+	entries := &store.Entries{
+		Events:      []string{parent.ID},
+		SubEvents:   []string{sub.ID},
+		Jobs:        []string{parent.Jobs[0].ID, sub.Jobs[0].ID},
+		Transitions: []string{parent.Jobs[0].Transitions[0].ID, sub.Jobs[0].Transitions[0].ID},
+	}
+
+	partial := &store.Entries{
+		Events:      entries.Events,
+		Jobs:        entries.Jobs,
+		Transitions: entries.Transitions,
+	}
+
+	purged, err := s.PurgeEntries(toolkit(), partial)
+	if err != nil {
+		t.Fatalf("PurgeEntries: unexpected error: %v", err)
+	}
+
+	assertPurged(t, "PurgeEntries without sub-event", purged, 0, 0, 0)
+
+	retry := transition(parent.Jobs[0], 1, store.StatusFailed, store.StatusAwaiting, at(1))
+	mustAddTransitions(t, s, retry)
+
+	purged, err = s.PurgeEntries(toolkit(), entries)
+	if err != nil {
+		t.Fatalf("PurgeEntries: unexpected error: %v", err)
+	}
+
+	assertPurged(t, "PurgeEntries without new transition", purged, 0, 0, 0)
+
+	entries.Transitions = append(entries.Transitions, retry.ID)
+	purged, err = s.PurgeEntries(tenantOf("acme"), entries)
+	if err != nil {
+		t.Fatalf("PurgeEntries: unexpected error: %v", err)
+	}
+
+	assertPurged(t, "PurgeEntries of another tenant", purged, 0, 0, 0)
+
+	purged, err = s.PurgeEntries(toolkit(), entries)
+	if err != nil {
+		t.Fatalf("PurgeEntries: unexpected error: %v", err)
+	}
+
+	assertPurged(t, "PurgeEntries", purged, 2, 2, 3)
+
+	events, _ := mustFindEvents(t, s, nil)
+	assertIDs(t, "PurgeEntries", eventIDs(events))
+}
@@ -0,0 +1,105 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+testRequeue makes sure only failed and discarded jobs matching the constraints
+are requeued, that the attempt counter is continued or reset, and that the
+identity of who triggered the requeue is recorded.
+*/
+func testRequeue(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	discarded := job("warehouse", "load", "")
+	failed := job("warehouse", "load", "")
+	succeeded := job("warehouse", "load", "")
+	other := job("crm", "sync", "")
+	e := event("crm", "register", at(0), discarded, failed, succeeded, other)
+	mustAddEvents(t, s, e)
+
+	mustAddTransitions(t, s,
+		transition(discarded, 3, store.StatusExecuting, store.StatusDiscarded, at(1)),
+		transition(failed, 2, store.StatusExecuting, store.StatusFailed, at(2)),
+		transition(succeeded, 1, store.StatusExecuting, store.StatusSucceeded, at(3)),
+		transition(other, 3, store.StatusExecuting, store.StatusDiscarded, at(4)),
+	)
+
+	_, err := s.Requeue(toolkit(), nil, &store.Requeue{})
+	if err == nil {
+		t.Fatalf("anonymous: expected an error when TriggeredBy is not set")
+	}
+
+	where := &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			DestinationsIn: []string{"warehouse"},
+		},
+	}
+
+	transitions, err := s.Requeue(toolkit(), where, &store.Requeue{
+		TriggeredBy: "john@example.com",
+	})
+
+	if err != nil {
+		t.Fatalf("requeue: unexpected error: %v", err)
+	}
+
+	assertSet(t, "requeue", jobIDsOf(transitions), discarded.ID, failed.ID)
+	for _, tr := range transitions {
+		if tr.StateAfter != store.StatusAwaiting || tr.StateBefore == nil || tr.TriggeredBy != "john@example.com" {
+			t.Fatalf("requeue: unexpected transition: %+v", tr)
+		}
+	}
+
+	found, err := s.FindJob(toolkit(), discarded.ID)
+	if err != nil {
+		t.Fatalf("requeue: unexpected error: %v", err)
+	}
+
+	latest := found.Transitions[0]
+	if latest == nil || latest.StateAfter != store.StatusAwaiting || latest.Attempt != 3 {
+		t.Fatalf("requeue: expected the job to be awaiting with attempts continued, found %+v", latest)
+	}
+
+	if *latest.StateBefore != store.StatusDiscarded || latest.TriggeredBy != "john@example.com" {
+		t.Fatalf("requeue: expected the transition to be recorded, found %+v", latest)
+	}
+
+	transitions, err = s.Requeue(toolkit(), where, &store.Requeue{
+		TriggeredBy: "john@example.com",
+	})
+
+	if err != nil || len(transitions) != 0 {
+		t.Fatalf("again: expected no job to requeue, found %d and %v", len(transitions), err)
+	}
+
+	transitions, err = s.Requeue(toolkit(), nil, &store.Requeue{
+		ResetAttempts: true,
+		TriggeredBy:   "admin",
+	})
+
+	if err != nil {
+		t.Fatalf("reset: unexpected error: %v", err)
+	}
+
+	assertSet(t, "reset", jobIDsOf(transitions), other.ID)
+	found, _ = s.FindJob(toolkit(), other.ID)
+	if found.Transitions[0].Attempt != 0 || found.Transitions[0].StateAfter != store.StatusAwaiting {
+		t.Fatalf("reset: expected the attempts to be reset, found %+v", found.Transitions[0])
+	}
+}
+
+/*
+jobIDsOf returns the job IDs of transitions.
+*/
+func jobIDsOf(transitions []*store.Transition) []string {
+	ids := []string{}
+	for _, t := range transitions {
+		ids = append(ids, t.JobID)
+	}
+
+	return ids
+}
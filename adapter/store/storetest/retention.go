@@ -0,0 +1,118 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+assertPurged fails the test if the number of entries purged is not the one
+expected.
+*/
+func assertPurged(t *testing.T, what string, purged *store.Purged, events uint64, jobs uint64, transitions uint64) {
+	t.Helper()
+
+	if purged == nil {
+		t.Fatalf("%s: expected the number of entries purged, found nil", what)
+	}
+
+	if purged.Events != events || purged.Jobs != jobs || purged.Transitions != transitions {
+		t.Fatalf("%s: expected %d events, %d jobs, and %d transitions purged, found %+v",
+			what, events, jobs, transitions, *purged)
+	}
+}
+
+/*
+testRelativeRetention makes sure OlderThan and NewerThan are resolved given the
+instant the query runs, and are combined with absolute instants.
+*/
+func testRelativeRetention(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	old := event("crm", "register", now.Add(-48*time.Hour), job("zendesk", "identify", store.StatusSucceeded))
+	older := event("crm", "register", now.Add(-96*time.Hour), job("zendesk", "identify", store.StatusSucceeded))
+	recent := event("crm", "register", now.Add(-time.Hour), job("zendesk", "identify", store.StatusSucceeded))
+	mustAddEvents(t, s, older, old, recent)
+
+	events, _ := mustFindEvents(t, s, &store.WhereEvents{OlderThan: 24 * time.Hour})
+	assertIDs(t, "older than", eventIDs(events), older.ID, old.ID)
+
+	events, _ = mustFindEvents(t, s, &store.WhereEvents{NewerThan: 24 * time.Hour})
+	assertIDs(t, "newer than", eventIDs(events), recent.ID)
+
+	events, _ = mustFindEvents(t, s, &store.WhereEvents{OlderThan: 24 * time.Hour, NewerThan: 72 * time.Hour})
+	assertIDs(t, "window", eventIDs(events), old.ID)
+
+	before := now.Add(-72 * time.Hour)
+	events, _ = mustFindEvents(t, s, &store.WhereEvents{OlderThan: 24 * time.Hour, ReceivedBefore: &before})
+	assertIDs(t, "older than and received before", eventIDs(events), older.ID)
+
+	jobs, _ := mustFindJobs(t, s, &store.WhereEvents{OlderThan: 24 * time.Hour})
+	assertSet(t, "jobs older than", jobIDs(jobs), older.Jobs[0].ID, old.Jobs[0].ID)
+
+	where := (&store.WhereEvents{OlderThan: 24 * time.Hour}).Resolve(now)
+	if where.ReceivedBefore == nil || !where.ReceivedBefore.Equal(now.Add(-24*time.Hour)) {
+		t.Fatalf("resolve: expected received before %v, found %v", now.Add(-24*time.Hour), where.ReceivedBefore)
+	}
+
+	if _, _, err := s.FindEvents(toolkit(), &store.WhereEvents{OlderThan: -time.Hour}); err == nil {
+		t.Fatalf("negative: expected an error")
+	}
+
+	purged, err := s.Purge(toolkit(), &store.WhereEvents{OlderThan: 24 * time.Hour}, false)
+	if err != nil {
+		t.Fatalf("purge: unexpected error: %v", err)
+	}
+
+	assertPurged(t, "purge", purged, 2, 2, 2)
+	events, _ = mustFindEvents(t, s, nil)
+	assertIDs(t, "purge", eventIDs(events), recent.ID)
+}
+
+/*
+testPurgeDryRun makes sure a dry run counts the entries that would be purged,
+including the ones deleted in cascade, without deleting any of them.
+*/
+func testPurgeDryRun(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	parent := event("crm", "register", at(0), job("zendesk", "identify", store.StatusSucceeded))
+	sub := event("crm", "batch", at(1), job("zendesk", "identify", store.StatusFailed))
+	sub.ParentEventID = &parent.ID
+	other := event("shop", "order", at(2), job("zendesk", "identify", store.StatusSucceeded))
+	mustAddEvents(t, s, parent, sub, other)
+
+	child := job("zendesk", "track", store.StatusAcknowledged)
+	child.EventID = other.ID
+	child.ParentJobID = &parent.Jobs[0].ID
+	if err := s.AddJobs(toolkit(), []*store.Job{child}); err != nil {
+		t.Fatalf("AddJobs: unexpected error: %v", err)
+	}
+
+	mustAddTransitions(t, s, transition(parent.Jobs[0], 1, store.StatusSucceeded, store.StatusSucceeded, at(3)))
+
+	where := &store.WhereEvents{TriggersIn: []string{"register"}}
+	purged, err := s.Purge(toolkit(), where, true)
+	if err != nil {
+		t.Fatalf("dry run: unexpected error: %v", err)
+	}
+
+	assertPurged(t, "dry run", purged, 2, 3, 4)
+	events, _ := mustFindEvents(t, s, nil)
+	assertIDs(t, "dry run", eventIDs(events), parent.ID, sub.ID, other.ID)
+
+	purged, err = s.Purge(toolkit(), where, false)
+	if err != nil {
+		t.Fatalf("purge: unexpected error: %v", err)
+	}
+
+	assertPurged(t, "purge", purged, 2, 3, 4)
+	events, _ = mustFindEvents(t, s, nil)
+	assertIDs(t, "purge", eventIDs(events), other.ID)
+
+	jobs, _ := mustFindJobs(t, s, nil)
+	assertIDs(t, "purge", jobIDs(jobs), other.Jobs[0].ID)
+}
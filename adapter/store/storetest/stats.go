@@ -0,0 +1,75 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+testStats makes sure jobs are counted per time bucket and group of dimensions,
+and that the latency is computed for succeeded jobs only.
+*/
+func testStats(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	a := job("warehouse", "load", "")
+	b := job("warehouse", "load", "")
+	c := job("warehouse", "load", "")
+	d := job("crm", "sync", "")
+	d.CreatedAt = base.Add(time.Hour)
+	mustAddEvents(t, s, event("crm", "register", base, a, b, c, d))
+
+	mustAddTransitions(t, s,
+		transition(a, 1, store.StatusExecuting, store.StatusSucceeded, at(10)),
+		transition(b, 1, store.StatusExecuting, store.StatusSucceeded, at(30)),
+		transition(c, 1, store.StatusExecuting, store.StatusFailed, at(20)),
+		transition(d, 1, store.StatusExecuting, store.StatusSucceeded, base.Add(time.Hour+time.Minute)),
+	)
+
+	stats, err := s.Stats(toolkit(), nil, []store.Dimension{store.DimensionDestination, store.DimensionStatus}, time.Hour)
+	if err != nil {
+		t.Fatalf("stats: unexpected error: %v", err)
+	}
+
+	if len(stats) != 3 {
+		t.Fatalf("stats: expected 3 aggregates, found %d", len(stats))
+	}
+
+	succeeded := stats[1]
+	if !succeeded.Bucket.Equal(base) || succeeded.Group[store.DimensionDestination] != "warehouse" ||
+		succeeded.Group[store.DimensionStatus] != store.StatusSucceeded || succeeded.Count != 2 {
+		t.Fatalf("stats: unexpected aggregate for succeeded jobs: %+v", succeeded)
+	}
+
+	l := succeeded.Latency
+	if l == nil || l.Min != 10*time.Second || l.Max != 30*time.Second || l.Avg != 20*time.Second || l.P95 != 30*time.Second {
+		t.Fatalf("stats: unexpected latency: %+v", l)
+	}
+
+	failed := stats[0]
+	if failed.Group[store.DimensionStatus] != store.StatusFailed || failed.Count != 1 || failed.Latency != nil {
+		t.Fatalf("stats: unexpected aggregate for failed jobs: %+v", failed)
+	}
+
+	next := stats[2]
+	if !next.Bucket.Equal(base.Add(time.Hour)) || next.Group[store.DimensionDestination] != "crm" || next.Count != 1 {
+		t.Fatalf("stats: unexpected aggregate for the next bucket: %+v", next)
+	}
+
+	stats, err = s.Stats(toolkit(), &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			DestinationsIn: []string{"warehouse"},
+		},
+	}, nil, 0)
+
+	if err != nil || len(stats) != 1 || stats[0].Count != 3 || !stats[0].Bucket.IsZero() {
+		t.Fatalf("filtered: expected a single aggregate of 3 jobs, found %+v and %v", stats, err)
+	}
+
+	_, err = s.Stats(toolkit(), nil, []store.Dimension{"unknown"}, 0)
+	if err == nil {
+		t.Fatalf("unknown: expected an error for an unsupported dimension")
+	}
+}
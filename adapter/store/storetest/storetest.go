@@ -0,0 +1,343 @@
+package storetest
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+
+	"github.com/segmentio/ksuid"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+Factory returns a new and empty store for a test. The store shall be cleaned up
+by the factory itself if needed, using t.Cleanup.
+*/
+type Factory func(t *testing.T) store.Store
+
+/*
+base is the instant used as reference for every timestamps in the suite. It is
+truncated to the microsecond so SQL drivers can safely round-trip it.
+*/
+var base = time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+/*
+RunSuite runs the conformance test suite against the store returned by the factory.
+Each test is run as a subtest with its own store.
+*/
+func RunSuite(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		run  func(*testing.T, Factory)
+	}{
+		{"AddEvents", testAddEvents},
+		{"AddEventsAtomic", testAddEventsAtomic},
+		{"FindEventNotFound", testFindEventNotFound},
+		{"FindEventByIdempotencyKey", testFindEventByIdempotencyKey},
+		{"AddEventsIdempotency", testAddEventsIdempotency},
+		{"AddEventsIdempotencyConcurrent", testAddEventsIdempotencyConcurrent},
+		{"FindEventsFilters", testFindEventsFilters},
+		{"FindEventsPagination", testFindEventsPagination},
+		{"FindEventsCursors", testFindEventsCursors},
+		{"FindJobsCursors", testFindJobsCursors},
+		{"AddJobs", testAddJobs},
+		{"FindJobsLatestTransition", testFindJobsLatestTransition},
+		{"FindJobsFilters", testFindJobsFilters},
+		{"FindJobsByEventID", testFindJobsByEventID},
+		{"FindJobHistory", testFindJobHistory},
+		{"FindEventTree", testFindEventTree},
+		{"Tenants", testTenants},
+		{"TenantsIsolation", testTenantsIsolation},
+		{"StatusInAndNotIn", testStatusInAndNotIn},
+		{"Predicates", testPredicates},
+		{"PredicatesNotValid", testPredicatesNotValid},
+		{"AddTransitions", testAddTransitions},
+		{"FindTransitions", testFindTransitions},
+		{"Iterate", testIterate},
+		{"Requeue", testRequeue},
+		{"ClaimJobs", testClaimJobs},
+		{"ClaimJobsConcurrent", testClaimJobsConcurrent},
+		{"ExpireLeases", testExpireLeases},
+		{"LeaseOwnership", testLeaseOwnership},
+		{"Priorities", testPriorities},
+		{"ClaimJobsPriority", testClaimJobsPriority},
+		{"Stats", testStats},
+		{"Purge", testPurge},
+		{"PurgeCascade", testPurgeCascade},
+		{"PurgeDryRun", testPurgeDryRun},
+		{"PurgeEntries", testPurgeEntries},
+		{"ArchiveRestore", testArchiveRestore},
+		{"RelativeRetention", testRelativeRetention},
+		{"Lifecycle", testLifecycle},
+		{"Watch", testWatch},
+	}
+
+	for _, test := range tests {
+		run := test.run
+		t.Run(test.name, func(t *testing.T) {
+			run(t, factory)
+		})
+	}
+}
+
+/*
+toolkit returns the toolkit passed to the store in every tests. Logs are discarded.
+*/
+func toolkit() *store.Toolkit {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	return &store.Toolkit{
+		Logger: logger,
+	}
+}
+
+/*
+at returns the instant n seconds after the base instant.
+*/
+func at(n int) time.Time {
+	return base.Add(time.Duration(n) * time.Second)
+}
+
+/*
+event returns a new event with a unique ID and the jobs passed.
+*/
+func event(source string, trigger string, received time.Time, jobs ...*store.Job) *store.Event {
+	return &store.Event{
+		ID:         ksuid.New().String(),
+		Source:     source,
+		Trigger:    trigger,
+		Version:    "v1",
+		Context:    []byte(`{"ip":"127.0.0.1"}`),
+		Data:       []byte(`{"user":42}`),
+		Jobs:       jobs,
+		ReceivedAt: received,
+	}
+}
+
+/*
+job returns a new job with a unique ID. When status is not empty, the job has a
+first transition with this status.
+*/
+func job(destination string, action string, status string) *store.Job {
+	j := &store.Job{
+		ID:          ksuid.New().String(),
+		Destination: destination,
+		Action:      action,
+		Version:     "v1",
+		Context:     []byte(`{"ip":"127.0.0.1"}`),
+		Data:        []byte(`{"user":42}`),
+		CreatedAt:   base,
+	}
+
+	if status != "" {
+		j.Transitions[0] = &store.Transition{
+			ID:         ksuid.New().String(),
+			Attempt:    0,
+			StateAfter: status,
+			CreatedAt:  base,
+		}
+	}
+
+	return j
+}
+
+/*
+transition returns a new transition for a job, from a state to another.
+*/
+func transition(j *store.Job, attempt uint16, before string, after string, created time.Time) *store.Transition {
+	t := &store.Transition{
+		ID:         ksuid.New().String(),
+		Attempt:    attempt,
+		StateAfter: after,
+		CreatedAt:  created,
+		EventID:    j.EventID,
+		JobID:      j.ID,
+	}
+
+	if before != "" {
+		t.StateBefore = &before
+	}
+
+	return t
+}
+
+/*
+mustAddEvents adds events to the store and fails the test if an error occurred.
+Jobs are updated with the ID of their event.
+*/
+func mustAddEvents(t *testing.T, s store.Store, events ...*store.Event) {
+	t.Helper()
+
+	for _, e := range events {
+		for _, j := range e.Jobs {
+			j.EventID = e.ID
+		}
+	}
+
+	if err := s.AddEvents(toolkit(), events); err != nil {
+		t.Fatalf("AddEvents: unexpected error: %v", err)
+	}
+}
+
+/*
+mustAddTransitions adds transitions to the store and fails the test if an error
+occurred.
+*/
+func mustAddTransitions(t *testing.T, s store.Store, transitions ...*store.Transition) {
+	t.Helper()
+
+	if err := s.AddTransitions(toolkit(), transitions); err != nil {
+		t.Fatalf("AddTransitions: unexpected error: %v", err)
+	}
+}
+
+/*
+mustFindEvents returns the events matching the constraints and fails the test if
+an error occurred.
+*/
+func mustFindEvents(t *testing.T, s store.Store, where *store.WhereEvents) ([]*store.Event, *store.Meta) {
+	t.Helper()
+
+	events, meta, err := s.FindEvents(toolkit(), where)
+	if err != nil {
+		t.Fatalf("FindEvents: unexpected error: %v", err)
+	}
+
+	if meta == nil {
+		t.Fatalf("FindEvents: meta must not be nil")
+	}
+
+	return events, meta
+}
+
+/*
+mustFindJobs returns the jobs matching the constraints and fails the test if an
+error occurred.
+*/
+func mustFindJobs(t *testing.T, s store.Store, where *store.WhereEvents) ([]*store.Job, *store.Meta) {
+	t.Helper()
+
+	jobs, meta, err := s.FindJobs(toolkit(), where)
+	if err != nil {
+		t.Fatalf("FindJobs: unexpected error: %v", err)
+	}
+
+	if meta == nil {
+		t.Fatalf("FindJobs: meta must not be nil")
+	}
+
+	return jobs, meta
+}
+
+/*
+mustFindTransitions returns the transitions matching the constraints and fails
+the test if an error occurred.
+*/
+func mustFindTransitions(t *testing.T, s store.Store, where *store.WhereEvents) ([]*store.Transition, *store.Meta) {
+	t.Helper()
+
+	transitions, meta, err := s.FindTransitions(toolkit(), where)
+	if err != nil {
+		t.Fatalf("FindTransitions: unexpected error: %v", err)
+	}
+
+	if meta == nil {
+		t.Fatalf("FindTransitions: meta must not be nil")
+	}
+
+	return transitions, meta
+}
+
+/*
+whereStatus returns constraints on the jobs' status.
+*/
+func whereStatus(in []string, notin []string) *store.WhereEvents {
+	return &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			AndWhereTransitions: &store.WhereTransitions{
+				StatusIn:    in,
+				StatusNotIn: notin,
+			},
+		},
+	}
+}
+
+/*
+eventIDs returns the IDs of events, in the same order.
+*/
+func eventIDs(events []*store.Event) []string {
+	ids := []string{}
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+
+	return ids
+}
+
+/*
+jobIDs returns the IDs of jobs, in the same order.
+*/
+func jobIDs(jobs []*store.Job) []string {
+	ids := []string{}
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+	}
+
+	return ids
+}
+
+/*
+transitionIDs returns the IDs of transitions, in the same order.
+*/
+func transitionIDs(transitions []*store.Transition) []string {
+	ids := []string{}
+	for _, t := range transitions {
+		ids = append(ids, t.ID)
+	}
+
+	return ids
+}
+
+/*
+assertIDs fails the test if the IDs found are not the ones expected, in the same
+order.
+*/
+func assertIDs(t *testing.T, what string, found []string, expected ...string) {
+	t.Helper()
+
+	if len(found) != len(expected) {
+		t.Fatalf("%s: expected %d entries, found %d: %v", what, len(expected), len(found), found)
+	}
+
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Fatalf("%s: expected %v, found %v", what, expected, found)
+		}
+	}
+}
+
+/*
+assertSet fails the test if the IDs found are not the ones expected, regardless
+their order.
+*/
+func assertSet(t *testing.T, what string, found []string, expected ...string) {
+	t.Helper()
+
+	if len(found) != len(expected) {
+		t.Fatalf("%s: expected %d entries, found %d: %v", what, len(expected), len(found), found)
+	}
+
+	set := map[string]bool{}
+	for _, id := range found {
+		set[id] = true
+	}
+
+	for _, id := range expected {
+		if !set[id] {
+			t.Fatalf("%s: expected %v, found %v", what, expected, found)
+		}
+	}
+}
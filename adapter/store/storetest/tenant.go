@@ -0,0 +1,235 @@
+package storetest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+tenantOf returns a copy of the toolkit used in every tests, scoped to a tenant.
+*/
+func tenantOf(tenant string) *store.Toolkit {
+	tk := toolkit()
+	tk.Tenant = tenant
+
+	return tk
+}
+
+/*
+testTenants makes sure jobs belong to the tenant of their event, that tenant
+filters apply even with the event and job shortcuts, and that a toolkit scoped to
+a tenant never reaches entries of another tenant.
+*/
+func testTenants(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	acme := event("crm", "register", at(0), job("warehouse", "load", store.StatusAwaiting))
+	acme.Tenant = "acme"
+	globex := event("crm", "register", at(10), job("warehouse", "load", store.StatusAwaiting))
+	globex.Tenant = "globex"
+	shared := event("crm", "register", at(20), job("warehouse", "load", store.StatusAwaiting))
+	mustAddEvents(t, s, acme, globex, shared)
+
+	found, err := s.FindJob(toolkit(), globex.Jobs[0].ID)
+	if err != nil {
+		t.Fatalf("FindJob: unexpected error: %v", err)
+	}
+
+	if found.Tenant != "globex" {
+		t.Fatalf("FindJob: expected the job to belong to the tenant of its event, found %q", found.Tenant)
+	}
+
+	events, _ := mustFindEvents(t, s, &store.WhereEvents{TenantsIn: []string{"acme", "globex"}})
+	assertIDs(t, "tenants in", eventIDs(events), acme.ID, globex.ID)
+
+	events, _ = mustFindEvents(t, s, &store.WhereEvents{TenantsNotIn: []string{"acme"}})
+	assertIDs(t, "tenants not in", eventIDs(events), globex.ID, shared.ID)
+
+	events, _ = mustFindEvents(t, s, &store.WhereEvents{
+		TenantsIn: []string{"acme"},
+		AndWhereJobs: &store.WhereJobs{
+			EventID: globex.ID,
+		},
+	})
+
+	assertIDs(t, "tenants with event ID", eventIDs(events))
+
+	tk := tenantOf("acme")
+	events, meta, err := s.FindEvents(tk, nil)
+	if err != nil {
+		t.Fatalf("FindEvents: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "scoped events", eventIDs(events), acme.ID)
+	if len(meta.Where.TenantsIn) != 1 || meta.Where.TenantsIn[0] != "acme" {
+		t.Fatalf("scoped events: expected the tenant to be applied, found %+v", meta.Where.TenantsIn)
+	}
+
+	events, _, err = s.FindEvents(tk, &store.WhereEvents{TenantsIn: []string{"globex"}})
+	if err != nil {
+		t.Fatalf("FindEvents: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "scoped events of another tenant", eventIDs(events))
+
+	jobs, _, err := s.FindJobs(tk, &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			AndWhereTransitions: &store.WhereTransitions{
+				JobID: globex.Jobs[0].ID,
+			},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("FindJobs: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "scoped jobs with job ID of another tenant", jobIDs(jobs))
+
+	transitions, _, err := s.FindTransitions(tk, nil)
+	if err != nil {
+		t.Fatalf("FindTransitions: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "scoped transitions", jobIDsOf(transitions), acme.Jobs[0].ID)
+
+	if found, err := s.FindEvent(tk, globex.ID); err == nil {
+		t.Fatalf("FindEvent: expected an error for another tenant, found %+v", found)
+	}
+
+	if found, err := s.FindJob(tk, globex.Jobs[0].ID); err == nil {
+		t.Fatalf("FindJob: expected an error for another tenant, found %+v", found)
+	}
+
+	if found, err := s.FindJobHistory(tk, shared.Jobs[0].ID); err == nil {
+		t.Fatalf("FindJobHistory: expected an error for another tenant, found %+v", found)
+	}
+
+	if found, err := s.FindTransition(tk, globex.Jobs[0].Transitions[0].ID); err == nil {
+		t.Fatalf("FindTransition: expected an error for another tenant, found %+v", found)
+	}
+
+	if found, err := s.FindEventTree(tk, globex.ID); err == nil {
+		t.Fatalf("FindEventTree: expected an error for another tenant, found %+v", found)
+	}
+
+	if _, err := s.FindEvent(tk, acme.ID); err != nil {
+		t.Fatalf("FindEvent: unexpected error for the same tenant: %v", err)
+	}
+
+	stats, err := s.Stats(toolkit(), nil, []store.Dimension{store.DimensionTenant}, 0)
+	if err != nil {
+		t.Fatalf("Stats: unexpected error: %v", err)
+	}
+
+	if len(stats) != 3 {
+		t.Fatalf("Stats: expected 3 aggregates, found %d", len(stats))
+	}
+
+	for _, stat := range stats {
+		if stat.Count != 1 {
+			t.Fatalf("Stats: unexpected aggregate: %+v", stat)
+		}
+	}
+
+	purged, err := s.Purge(tk, nil, false)
+	if err != nil {
+		t.Fatalf("Purge: unexpected error: %v", err)
+	}
+
+	assertPurged(t, "scoped purge", purged, 1, 1, 1)
+	events, _ = mustFindEvents(t, s, nil)
+	assertIDs(t, "after scoped purge", eventIDs(events), globex.ID, shared.ID)
+}
+
+/*
+assertValidation makes sure an error is a 400 error holding a validation error at
+the path passed.
+*/
+func assertValidation(t *testing.T, what string, err error, path ...string) {
+	t.Helper()
+
+	fail, ok := err.(*errors.Error)
+	if !ok || fail.StatusCode != 400 {
+		t.Fatalf("%s: expected a 400 error, found %v", what, err)
+	}
+
+	for _, v := range fail.Validations {
+		if strings.Join(v.Path, ".") == strings.Join(path, ".") {
+			return
+		}
+	}
+
+	t.Fatalf("%s: expected a validation error at %v, found %+v", what, path, fail.Validations)
+}
+
+/*
+testTenantsIsolation makes sure entries can not be added into another tenant than
+the one of the toolkit, and that sub-events and child jobs can not cross tenants.
+*/
+func testTenantsIsolation(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	acme := event("crm", "register", at(0), job("warehouse", "load", store.StatusAwaiting))
+	acme.Tenant = "acme"
+	globex := event("crm", "register", at(10), job("warehouse", "load", store.StatusAwaiting))
+	globex.Tenant = "globex"
+	mustAddEvents(t, s, acme, globex)
+
+	tk := tenantOf("acme")
+	other := event("crm", "register", at(20))
+	other.Tenant = "globex"
+	err := s.AddEvents(tk, []*store.Event{other})
+	assertValidation(t, "AddEvents for another tenant", err, "Event", other.ID, "Tenant")
+
+	sub := event("crm", "enrich", at(20))
+	sub.Tenant = "acme"
+	sub.ParentEventID = &globex.ID
+	err = s.AddEvents(toolkit(), []*store.Event{sub})
+	assertValidation(t, "AddEvents for a parent event of another tenant", err, "Event", sub.ID, "ParentEventID")
+
+	misplaced := job("mailer", "notify", "")
+	misplaced.EventID = globex.ID
+	err = s.AddJobs(tk, []*store.Job{misplaced})
+	assertValidation(t, "AddJobs for an event of another tenant", err, "Job", misplaced.ID, "EventID")
+
+	child := job("mailer", "notify", "")
+	child.EventID = acme.ID
+	child.ParentJobID = &globex.Jobs[0].ID
+	err = s.AddJobs(toolkit(), []*store.Job{child})
+	assertValidation(t, "AddJobs for a parent job of another tenant", err, "Job", child.ID, "ParentJobID")
+
+	stolen := transition(globex.Jobs[0], 1, store.StatusAwaiting, store.StatusExecuting, at(30))
+	if err := s.AddTransitions(tk, []*store.Transition{stolen}); err == nil {
+		t.Fatalf("AddTransitions: expected an error for a job of another tenant")
+	}
+
+	events, _ := mustFindEvents(t, s, nil)
+	assertIDs(t, "after rejected inserts", eventIDs(events), acme.ID, globex.ID)
+	for _, e := range events {
+		if len(e.Jobs) != 1 || e.Jobs[0].Transitions[0].StateAfter != store.StatusAwaiting {
+			t.Fatalf("after rejected inserts: unexpected jobs for %s: %+v", e.ID, e.Jobs)
+		}
+	}
+
+	sub.ParentEventID = &acme.ID
+	child.ParentJobID = &acme.Jobs[0].ID
+	if err := s.AddEvents(tk, []*store.Event{sub}); err != nil {
+		t.Fatalf("AddEvents: unexpected error for the same tenant: %v", err)
+	}
+
+	if err := s.AddJobs(tk, []*store.Job{child}); err != nil {
+		t.Fatalf("AddJobs: unexpected error for the same tenant: %v", err)
+	}
+
+	claimed, err := s.ClaimJobs(tk, nil, "scheduler-1", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimJobs: unexpected error: %v", err)
+	}
+
+	assertIDs(t, "scoped claim", jobIDs(claimed), acme.Jobs[0].ID)
+}
@@ -0,0 +1,106 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+testAddTransitions makes sure transitions are related to their job and event, and
+are rejected for unknown jobs.
+*/
+func testAddTransitions(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	j := job("zendesk", "identify", store.StatusAcknowledged)
+	e := event("crm", "register", at(0), j)
+	mustAddEvents(t, s, e)
+
+	tr := transition(j, 0, store.StatusAcknowledged, store.StatusAwaiting, at(1))
+	mustAddTransitions(t, s, tr)
+
+	found, err := s.FindTransition(toolkit(), tr.ID)
+	if err != nil {
+		t.Fatalf("FindTransition: unexpected error: %v", err)
+	}
+
+	if found.JobID != j.ID || found.EventID != e.ID || found.StateAfter != store.StatusAwaiting {
+		t.Fatalf("FindTransition: unexpected transition: %+v", found)
+	}
+
+	if found.StateBefore == nil || *found.StateBefore != store.StatusAcknowledged {
+		t.Fatalf("FindTransition: expected state before %q", store.StatusAcknowledged)
+	}
+
+	if !found.CreatedAt.Equal(at(1)) {
+		t.Fatalf("FindTransition: expected created at %v, found %v", at(1), found.CreatedAt)
+	}
+
+	if _, err := s.FindTransition(toolkit(), "1UYc8EebLqCAFMOSkbYZdJwNLAJ"); err == nil {
+		t.Fatalf("FindTransition: expected an error for an unknown transition")
+	}
+
+	orphan := transition(j, 0, store.StatusAwaiting, store.StatusExecuting, at(2))
+	orphan.JobID = "1UYc8EebLqCAFMOSkbYZdJwNLAJ"
+	if err := s.AddTransitions(toolkit(), []*store.Transition{orphan}); err == nil {
+		t.Fatalf("AddTransitions: expected an error for a transition related to an unknown job")
+	}
+}
+
+/*
+testFindTransitions makes sure transitions can be found for a given job, and that
+constraints on status and attempts are applied on the transitions themselves.
+*/
+func testFindTransitions(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	a := job("zendesk", "identify", store.StatusAcknowledged)
+	b := job("mailchimp", "subscribe", store.StatusAcknowledged)
+	mustAddEvents(t, s, event("crm", "register", at(0), a, b))
+
+	first := transition(a, 0, store.StatusAcknowledged, store.StatusAwaiting, at(1))
+	second := transition(a, 1, store.StatusAwaiting, store.StatusExecuting, at(2))
+	third := transition(a, 1, store.StatusExecuting, store.StatusFailed, at(3))
+	other := transition(b, 0, store.StatusAcknowledged, store.StatusAwaiting, at(4))
+	mustAddTransitions(t, s, first, second, third, other)
+
+	transitions, meta := mustFindTransitions(t, s, &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			AndWhereTransitions: &store.WhereTransitions{
+				JobID: a.ID,
+			},
+		},
+	})
+
+	assertIDs(t, "JobID", transitionIDs(transitions), a.Transitions[0].ID, first.ID, second.ID, third.ID)
+	if meta.Count != 4 {
+		t.Fatalf("JobID: expected count 4, found %d", meta.Count)
+	}
+
+	transitions, _ = mustFindTransitions(t, s, &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			AndWhereTransitions: &store.WhereTransitions{
+				JobID: a.ID,
+			},
+		},
+		Offset: 1,
+		Limit:  2,
+	})
+
+	assertIDs(t, "JobID with pagination", transitionIDs(transitions), first.ID, second.ID)
+
+	transitions, _ = mustFindTransitions(t, s, whereStatus([]string{store.StatusAwaiting}, nil))
+	assertIDs(t, "StatusIn", transitionIDs(transitions), first.ID, other.ID)
+
+	transitions, _ = mustFindTransitions(t, s, &store.WhereEvents{
+		AndWhereJobs: &store.WhereJobs{
+			DestinationsIn: []string{"zendesk"},
+			AndWhereTransitions: &store.WhereTransitions{
+				MinAttempts: 1,
+			},
+		},
+	})
+
+	assertIDs(t, "MinAttempts", transitionIDs(transitions), second.ID, third.ID)
+}
@@ -0,0 +1,107 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+testFindEventTree makes sure the tree of an event includes its sub-events and all
+their jobs, with child jobs placed under their parent job, in chronological order.
+Unrelated entries must not be part of the tree.
+*/
+func testFindEventTree(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	first := job("warehouse", "load", store.StatusSucceeded)
+	second := job("crm", "sync", store.StatusFailed)
+	second.CreatedAt = at(1)
+	root := event("crm", "register", at(0), first, second)
+
+	sub := event("crm", "enrich", at(10), job("warehouse", "load", store.StatusAwaiting))
+	sub.ParentEventID = &root.ID
+	subsub := event("crm", "score", at(20))
+	subsub.ParentEventID = &sub.ID
+	unrelated := event("shop", "order", at(5), job("warehouse", "load", store.StatusAwaiting))
+	mustAddEvents(t, s, root, sub, subsub, unrelated)
+
+	child := job("mailer", "notify", store.StatusAwaiting)
+	child.EventID = root.ID
+	child.ParentJobID = &first.ID
+	child.CreatedAt = at(2)
+	grandchild := job("mailer", "remind", "")
+	grandchild.EventID = root.ID
+	grandchild.ParentJobID = &child.ID
+	grandchild.CreatedAt = at(3)
+	elsewhere := job("crm", "alert", store.StatusAwaiting)
+	elsewhere.EventID = unrelated.ID
+	elsewhere.ParentJobID = &second.ID
+	if err := s.AddJobs(toolkit(), []*store.Job{child, grandchild, elsewhere}); err != nil {
+		t.Fatalf("AddJobs: unexpected error: %v", err)
+	}
+
+	if found, err := s.FindEventTree(toolkit(), "1UYc8EebLqCAFMOSkbYZdJwNLAJ"); err == nil {
+		t.Fatalf("not found: expected an error, found %+v", found)
+	}
+
+	tree, err := s.FindEventTree(toolkit(), root.ID)
+	if err != nil {
+		t.Fatalf("FindEventTree: unexpected error: %v", err)
+	}
+
+	if tree.Event.ID != root.ID || len(tree.Event.Jobs) != 0 {
+		t.Fatalf("root: unexpected event: %+v", tree.Event)
+	}
+
+	assertIDs(t, "root jobs", jobIDsOfTrees(tree.Jobs), first.ID, second.ID)
+	assertIDs(t, "first children", jobIDsOfTrees(tree.Jobs[0].Children), child.ID)
+	assertIDs(t, "child children", jobIDsOfTrees(tree.Jobs[0].Children[0].Children), grandchild.ID)
+	assertIDs(t, "grandchild children", jobIDsOfTrees(tree.Jobs[0].Children[0].Children[0].Children))
+	assertIDs(t, "second children", jobIDsOfTrees(tree.Jobs[1].Children), elsewhere.ID)
+
+	latest := tree.Jobs[1].Job.Transitions[0]
+	if latest == nil || latest.StateAfter != store.StatusFailed {
+		t.Fatalf("second: expected the latest transition to be returned, found %+v", latest)
+	}
+
+	if tree.Jobs[0].Children[0].Children[0].Job.Transitions[0] != nil {
+		t.Fatalf("grandchild: expected no transition")
+	}
+
+	if len(tree.Children) != 1 || tree.Children[0].Event.ID != sub.ID {
+		t.Fatalf("sub-events: expected %s, found %+v", sub.ID, tree.Children)
+	}
+
+	assertIDs(t, "sub jobs", jobIDsOfTrees(tree.Children[0].Jobs), sub.Jobs[0].ID)
+	if len(tree.Children[0].Children) != 1 || tree.Children[0].Children[0].Event.ID != subsub.ID {
+		t.Fatalf("sub-sub-events: expected %s, found %+v", subsub.ID, tree.Children[0].Children)
+	}
+
+	leaf := tree.Children[0].Children[0]
+	if len(leaf.Jobs) != 0 || len(leaf.Children) != 0 {
+		t.Fatalf("leaf: expected no job nor sub-event, found %+v", leaf)
+	}
+
+	tree, err = s.FindEventTree(toolkit(), sub.ID)
+	if err != nil {
+		t.Fatalf("sub: unexpected error: %v", err)
+	}
+
+	if tree.Event.ID != sub.ID || len(tree.Children) != 1 || len(tree.Jobs) != 1 {
+		t.Fatalf("sub: expected the tree to start at the sub-event, found %+v", tree)
+	}
+}
+
+/*
+jobIDsOfTrees returns the IDs of the jobs at the root of job trees, in the same
+order.
+*/
+func jobIDsOfTrees(trees []*store.JobTree) []string {
+	ids := []string{}
+	for _, tree := range trees {
+		ids = append(ids, tree.Job.ID)
+	}
+
+	return ids
+}
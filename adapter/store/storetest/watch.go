@@ -0,0 +1,77 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/adapter/store"
+)
+
+/*
+testWatch makes sure a store implementing the store.Watcher interface notifies
+every entries added, in order, and closes the channel once the context is done.
+The test is skipped for stores not implementing the interface.
+*/
+func testWatch(t *testing.T, factory Factory) {
+	s := factory(t)
+
+	watcher, ok := s.(store.Watcher)
+	if !ok {
+		t.Skip("store does not implement store.Watcher")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notifications, err := watcher.Watch(ctx, toolkit())
+	if err != nil {
+		t.Fatalf("Watch: unexpected error: %v", err)
+	}
+
+	j := job("warehouse", "load", store.StatusAwaiting)
+	e := event("crm", "register", at(0), j)
+	mustAddEvents(t, s, e)
+
+	tr := transition(j, 1, store.StatusAwaiting, store.StatusFailed, at(1))
+	mustAddTransitions(t, s, tr)
+
+	requeued, err := s.Requeue(toolkit(), nil, &store.Requeue{
+		TriggeredBy: "john@example.com",
+	})
+
+	if err != nil || len(requeued) != 1 {
+		t.Fatalf("Requeue: expected 1 transition, found %d and %v", len(requeued), err)
+	}
+
+	expected := []*store.Notification{
+		{Kind: store.KindEvent, ID: e.ID, EventID: e.ID},
+		{Kind: store.KindJob, ID: j.ID, EventID: e.ID, JobID: j.ID},
+		{Kind: store.KindTransition, ID: j.Transitions[0].ID, EventID: e.ID, JobID: j.ID, Status: store.StatusAwaiting},
+		{Kind: store.KindTransition, ID: tr.ID, EventID: e.ID, JobID: j.ID, Status: store.StatusFailed},
+		{Kind: store.KindTransition, ID: requeued[0].ID, EventID: e.ID, JobID: j.ID, Status: store.StatusAwaiting},
+	}
+
+	for i, exp := range expected {
+		select {
+		case n := <-notifications:
+			if n == nil || *n != *exp {
+				t.Fatalf("notification %d: expected %+v, found %+v", i, exp, n)
+			}
+
+		case <-time.After(time.Second):
+			t.Fatalf("notification %d: expected %+v, found none", i, exp)
+		}
+	}
+
+	cancel()
+	select {
+	case n, open := <-notifications:
+		if open {
+			t.Fatalf("cancel: expected the channel to be closed, found %+v", n)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("cancel: expected the channel to be closed")
+	}
+}
@@ -0,0 +1,49 @@
+package store
+
+/*
+Scope returns the constraints restricted to the tenant of the toolkit. When the
+toolkit has no tenant, the constraints are returned as is. Otherwise, a copy is
+returned with TenantsIn only holding the toolkit's tenant. If the constraints were
+already restricted to other tenants, the copy matches nothing. Drivers shall call
+it before applying the constraints, so entries of a tenant never leak in queries
+scoped to another one.
+*/
+func (tk *Toolkit) Scope(where *WhereEvents) *WhereEvents {
+	if tk == nil || tk.Tenant == "" {
+		return where
+	}
+
+	out := &WhereEvents{}
+	if where != nil {
+		*out = *where
+	}
+
+	out.TenantsIn = []string{tk.Tenant}
+	if where != nil && len(where.TenantsIn) > 0 && !containsString(where.TenantsIn, tk.Tenant) {
+		out.TenantsNotIn = append(append([]string{}, where.TenantsNotIn...), tk.Tenant)
+	}
+
+	return out
+}
+
+/*
+Owns reports if an entry belonging to the tenant passed in params is within the
+scope of the toolkit. Every entries are within the scope of a toolkit without
+tenant.
+*/
+func (tk *Toolkit) Owns(tenant string) bool {
+	return tk == nil || tk.Tenant == "" || tk.Tenant == tenant
+}
+
+/*
+containsString reports if a value is present in a slice.
+*/
+func containsString(slice []string, value string) bool {
+	for _, v := range slice {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -13,4 +13,12 @@ type Toolkit struct {
 	// Logger gives access to the logrus Logger passed in options when creating the
 	// Blacksmith application.
 	Logger *logrus.Logger
+
+	// Tenant is the tenant the store functions are scoped to. When set, queries
+	// only return the entries of this tenant, entries of other tenants are not
+	// found, and entries added must belong to this tenant. When empty, the store
+	// functions are not scoped. See Scope and Owns for more details.
+	//
+	// Example: "acme"
+	Tenant string
 }
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"sort"
+)
+
+/*
+EventTree is the lineage of an event: the event itself, its jobs, and its
+sub-events, recursively. It allows to follow the full fan-out of an event.
+*/
+type EventTree struct {
+
+	// Event is the event at the root of this tree. Its jobs are not set, since
+	// they are available in Jobs.
+	Event *Event `json:"event"`
+
+	// Jobs are the jobs of the event having no parent job in the tree, in
+	// chronological order. Each one includes its latest transition.
+	Jobs []*JobTree `json:"jobs"`
+
+	// Children are the trees of the sub-events, in chronological order.
+	Children []*EventTree `json:"children"`
+}
+
+/*
+JobTree is the lineage of a job: the job itself and the jobs created from it,
+such as the ones created by the scheduler for OnSucceeded, OnFailed, and
+OnDiscarded, recursively.
+*/
+type JobTree struct {
+
+	// Job is the job at the root of this tree, including its latest transition.
+	Job *Job `json:"job"`
+
+	// Children are the trees of the child jobs, in chronological order.
+	Children []*JobTree `json:"children"`
+}
+
+/*
+NewEventTree returns the tree of an event given every events and jobs of its
+lineage, as found by a driver. Events must include the root event and its
+descendants. Jobs must include every jobs of these events and their descendants.
+A job is placed under its parent job when the parent is part of the tree, and
+under its event otherwise. Entries not related to the root event are ignored.
+*/
+func NewEventTree(id string, events []*Event, jobs []*Job) *EventTree {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].ReceivedAt.Equal(events[j].ReceivedAt) {
+			return events[i].ReceivedAt.Before(events[j].ReceivedAt)
+		}
+
+		return events[i].ID < events[j].ID
+	})
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+
+		return jobs[i].ID < jobs[j].ID
+	})
+
+	eventTrees := map[string]*EventTree{}
+	for _, e := range events {
+		e.Jobs = nil
+		eventTrees[e.ID] = &EventTree{
+			Event:    e,
+			Jobs:     []*JobTree{},
+			Children: []*EventTree{},
+		}
+	}
+
+	root := eventTrees[id]
+	if root == nil {
+		return nil
+	}
+
+	for _, e := range events {
+		if e.ID == id || e.ParentEventID == nil {
+			continue
+		}
+
+		if parent := eventTrees[*e.ParentEventID]; parent != nil {
+			parent.Children = append(parent.Children, eventTrees[e.ID])
+		}
+	}
+
+	jobTrees := map[string]*JobTree{}
+	for _, j := range jobs {
+		jobTrees[j.ID] = &JobTree{
+			Job:      j,
+			Children: []*JobTree{},
+		}
+	}
+
+	for _, j := range jobs {
+		if j.ParentJobID != nil && *j.ParentJobID != j.ID {
+			if parent := jobTrees[*j.ParentJobID]; parent != nil {
+				parent.Children = append(parent.Children, jobTrees[j.ID])
+				continue
+			}
+		}
+
+		if e := eventTrees[j.EventID]; e != nil {
+			e.Jobs = append(e.Jobs, jobTrees[j.ID])
+		}
+	}
+
+	return root
+}
@@ -0,0 +1,228 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+Kind is a custom type allowing the user to only pass supported kinds of entries
+when receiving notifications from the store.
+*/
+type Kind string
+
+/*
+KindEvent is used for notifications about an event added into the store.
+*/
+var KindEvent Kind = "event"
+
+/*
+KindJob is used for notifications about a job added into the store.
+*/
+var KindJob Kind = "job"
+
+/*
+KindTransition is used for notifications about a transition added into the store.
+*/
+var KindTransition Kind = "transition"
+
+/*
+WatchBuffer is the number of notifications buffered for each watcher. When the
+buffer of a watcher is full, new notifications are dropped for this watcher.
+*/
+var WatchBuffer = 256
+
+/*
+Notification is emitted by a store implementing the Watcher interface every time
+an entry is added. It only holds the identifiers of the entry, which must be
+retrieved from the store if needed.
+*/
+type Notification struct {
+
+	// Kind is the kind of entry added.
+	Kind Kind `json:"kind"`
+
+	// Tenant is the tenant the entry belongs to, if any.
+	Tenant string `json:"tenant,omitempty"`
+
+	// ID is the ID of the entry added.
+	ID string `json:"id"`
+
+	// EventID is the ID of the event the entry is related to. For an event, it is
+	// the same as ID.
+	EventID string `json:"event_id"`
+
+	// JobID is the ID of the job the entry is related to. It is empty for events.
+	// For a job, it is the same as ID.
+	JobID string `json:"job_id,omitempty"`
+
+	// Status is the status of the job after the transition. It is only set for
+	// transitions.
+	Status string `json:"status,omitempty"`
+}
+
+/*
+Watcher can be implemented by store drivers able to notify when events, jobs, or
+transitions are added. The scheduler can then wake up as soon as jobs are awaiting
+instead of waiting for its next interval, and UIs can tail the store.
+
+Notifications are a best effort: they are emitted once the entries are persisted,
+but can be dropped for a watcher not receiving them fast enough. A watcher must
+therefore not replace polling entirely.
+*/
+type Watcher interface {
+
+	// Watch returns a channel receiving a notification for every entries added into
+	// the store, in the order they have been added. When the toolkit is scoped to a
+	// tenant, only the notifications of this tenant are received. The channel is
+	// closed once the context passed in params is done.
+	Watch(context.Context, *Toolkit) (<-chan *Notification, error)
+}
+
+/*
+Notifier dispatches notifications to every watchers. Drivers implementing the
+Watcher interface can rely on it to manage their watchers. The zero value is ready
+to use and it is safe for concurrent use.
+*/
+type Notifier struct {
+
+	// mutex protects the channels below.
+	mutex sync.Mutex
+
+	// channels are the channels of the current watchers, along the tenant they
+	// are scoped to.
+	channels map[chan *Notification]string
+}
+
+/*
+Watch returns a new channel receiving every notifications dispatched. If tenant
+is not empty, only the notifications of this tenant are received. The channel is
+closed and removed from the watchers once the context is done.
+*/
+func (n *Notifier) Watch(ctx context.Context, tenant string) <-chan *Notification {
+	ch := make(chan *Notification, WatchBuffer)
+
+	n.mutex.Lock()
+	if n.channels == nil {
+		n.channels = map[chan *Notification]string{}
+	}
+
+	n.channels[ch] = tenant
+	n.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		n.mutex.Lock()
+		delete(n.channels, ch)
+		close(ch)
+		n.mutex.Unlock()
+	}()
+
+	return ch
+}
+
+/*
+Notify dispatches notifications to every watchers. It never blocks: notifications
+are dropped for watchers having a full buffer.
+*/
+func (n *Notifier) Notify(notifications ...*Notification) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for ch, tenant := range n.channels {
+		for _, notification := range notifications {
+			if tenant != "" && notification.Tenant != tenant {
+				continue
+			}
+
+			select {
+			case ch <- notification:
+			default:
+			}
+		}
+	}
+}
+
+/*
+NotifyEvents dispatches a notification for every events, followed by one for each
+of their jobs and the jobs' transition if any.
+*/
+func (n *Notifier) NotifyEvents(events []*Event) {
+	notifications := []*Notification{}
+	for _, e := range events {
+		notifications = append(notifications, &Notification{
+			Kind:    KindEvent,
+			Tenant:  e.Tenant,
+			ID:      e.ID,
+			EventID: e.ID,
+		})
+
+		for _, j := range e.Jobs {
+			notifications = append(notifications, jobNotifications(j, e.ID, e.Tenant)...)
+		}
+	}
+
+	n.Notify(notifications...)
+}
+
+/*
+NotifyJobs dispatches a notification for every jobs, followed by one for their
+transition if any. Their tenant must be set.
+*/
+func (n *Notifier) NotifyJobs(jobs []*Job) {
+	notifications := []*Notification{}
+	for _, j := range jobs {
+		notifications = append(notifications, jobNotifications(j, j.EventID, j.Tenant)...)
+	}
+
+	n.Notify(notifications...)
+}
+
+/*
+NotifyTransitions dispatches a notification for every transitions. Their event ID
+must be set. tenants maps the IDs of the jobs to the tenant they belong to.
+*/
+func (n *Notifier) NotifyTransitions(transitions []*Transition, tenants map[string]string) {
+	notifications := []*Notification{}
+	for _, t := range transitions {
+		notifications = append(notifications, transitionNotification(t, t.EventID, t.JobID, tenants[t.JobID]))
+	}
+
+	n.Notify(notifications...)
+}
+
+/*
+jobNotifications returns the notifications for a job and its transition if any.
+*/
+func jobNotifications(j *Job, eventID string, tenant string) []*Notification {
+	notifications := []*Notification{
+		{
+			Kind:    KindJob,
+			Tenant:  tenant,
+			ID:      j.ID,
+			EventID: eventID,
+			JobID:   j.ID,
+		},
+	}
+
+	if t := j.Transitions[0]; t != nil {
+		notifications = append(notifications, transitionNotification(t, eventID, j.ID, tenant))
+	}
+
+	return notifications
+}
+
+/*
+transitionNotification returns the notification for a transition.
+*/
+func transitionNotification(t *Transition, eventID string, jobID string, tenant string) *Notification {
+	return &Notification{
+		Kind:    KindTransition,
+		Tenant:  tenant,
+		ID:      t.ID,
+		EventID: eventID,
+		JobID:   jobID,
+		Status:  t.StateAfter,
+	}
+}
@@ -13,12 +13,18 @@ looking for entries (migrations or transitions).
 type Meta struct {
 
 	// Count is the number of entries found that match the constraints applied to
-	// the query (without the limit).
-	Count uint16 `json:"count"`
+	// the query (without the limit and cursors).
+	Count uint64 `json:"count"`
 
 	// Pagination is the pagination details based on the count, offset, and limit.
+	// It is nil when the query uses a cursor, since pages can not be computed.
 	Pagination *rest.Pagination `json:"pagination"`
 
+	// Cursors holds the cursors to retrieve the next and previous entries of the
+	// query. They are set regardless of the query using offset or cursors, so a
+	// client can switch to keyset pagination at any time.
+	Cursors *rest.Cursors `json:"cursors"`
+
 	// Where is the constraints applied to the query to find migrations or transitions.
 	// This is included in the meta because the wanderer can set defaults or override
 	// some constraints (such as a maximum limit). This allows to be aware of the
@@ -52,13 +58,28 @@ type WhereMigrations struct {
 	// transitions for the migrations you are looking for.
 	AndWhereTransitions *WhereTransitions `json:"transitions,omitempty"`
 
+	// After is an opaque cursor returned in a query's meta. When set, only the
+	// entries positioned after the cursor are returned. Migrations are positioned
+	// given their version and then their ID, and transitions given their creation
+	// date and then their ID.
+	//
+	// Note: When a cursor is set, the offset is not applied.
+	After string `json:"after,omitempty"`
+
+	// Before is an opaque cursor returned in a query's meta. When set, only the
+	// entries positioned before the cursor are returned. When After is not set,
+	// the entries returned are the closest ones to the cursor.
+	//
+	// Note: When a cursor is set, the offset is not applied.
+	Before string `json:"before,omitempty"`
+
 	// Offset specifies the number of entries to skip before starting to return entries
 	// from the query.
-	Offset uint16 `json:"offset"`
+	Offset uint64 `json:"offset"`
 
 	// Limit specifies the number of entries to return after the offset clause has
 	// been processed.
-	Limit uint16 `json:"limit"`
+	Limit uint64 `json:"limit"`
 }
 
 /*
@@ -2,6 +2,8 @@ package wanderer
 
 import (
 	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
 )
 
 /*
@@ -110,8 +112,10 @@ type Transition struct {
 	// StateAfter is the state of the migration after running the new transition.
 	StateAfter string `json:"state_after"`
 
-	// Error keeps track of encountered if any.
-	Error error `json:"error"`
+	// Error keeps track of encountered error if any. It is structured so it can be
+	// marshaled as JSON without losing any detail. Use errors.From to convert any
+	// error.
+	Error *errors.Error `json:"error"`
 
 	// CreatedAt is a timestamp of the transition creation date into the wanderer
 	// datastore.
@@ -89,6 +89,17 @@ type Job struct {
 	// SentAt allows you to keep track of the timestamp when the event was originally
 	// sent.
 	SentAt *time.Time `json:"sent_at,omitempty"`
+
+	// Priority is the priority of the job. Jobs with a higher priority are run
+	// before the others, no matter when they have been created. Defaults to 0 and
+	// can be negative to run a job after the others.
+	//
+	// Example: 10
+	Priority int `json:"priority,omitempty"`
+
+	// NotBefore is the instant before which the job must not run. When nil, the
+	// job can run as soon as it is scheduled.
+	NotBefore *time.Time `json:"not_before,omitempty"`
 }
 
 /*
@@ -129,4 +140,32 @@ type Then struct {
 
 	// List of destinations actions to run in case the job has been discarded.
 	OnDiscarded []Action `json:"on_discarded,omitempty"`
+
+	// Delay delays the jobs of the actions to run in OnSucceeded, OnFailed, and
+	// OnDiscarded: they will not run before this duration has elapsed. It is not
+	// applied on jobs already having a NotBefore. It is applied by MarshalFollowUp
+	// when the scheduler builds the follow-up jobs.
+	//
+	// Example: 24 * time.Hour
+	Delay time.Duration `json:"delay,omitempty"`
+}
+
+/*
+MarshalFollowUp marshals an action of OnSucceeded, OnFailed, or OnDiscarded into
+the job the scheduler creates for it. Delay is applied from the instant passed in
+params to the NotBefore of the job, unless the action already set one. The
+scheduler builds every follow-up job with it.
+*/
+func (t *Then) MarshalFollowUp(tk *Toolkit, action Action, now time.Time) (*Job, error) {
+	job, err := action.Marshal(tk)
+	if err != nil {
+		return nil, err
+	}
+
+	if job != nil && job.NotBefore == nil && t.Delay > 0 {
+		notBefore := now.Add(t.Delay)
+		job.NotBefore = &notBefore
+	}
+
+	return job, nil
 }
@@ -41,4 +41,13 @@ type Toolkit struct {
 	//
 	// Example: "1UYc8EebLqCAFMOSkbYZdJwNLAJ"
 	JobID string
+
+	// Tenant is the tenant of the event and job being marshaled, if any.
+	//
+	// Note: This is not applicable when using the Load function, since the queue
+	// can hold events of several tenants. The tenant of each event and job is then
+	// available in the queue.
+	//
+	// Example: "acme"
+	Tenant string
 }
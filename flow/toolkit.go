@@ -27,4 +27,9 @@ type Toolkit struct {
 	//
 	// Example: "1UYc8EebLqCAFMOSkbYZdJwNLAJ"
 	EventID string
+
+	// Tenant is the tenant of the event being processed by the flow, if any.
+	//
+	// Example: "acme"
+	Tenant string
 }
@@ -5,8 +5,12 @@ go 1.16
 require (
 	github.com/flosch/pongo2-addons v0.0.0-20210526150811-f969446c5b72
 	github.com/flosch/pongo2/v4 v4.0.2
+	github.com/klauspost/compress v1.15.15
 	github.com/segmentio/ksuid v1.0.3
 	github.com/sirupsen/logrus v1.8.1
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	google.golang.org/protobuf v1.28.1
+	modernc.org/sqlite v1.14.0
 )
 
 replace golang.org/x/net => golang.org/x/net v0.0.0-20201202161906-c7110b5ffcbb
@@ -2,6 +2,7 @@ package errors
 
 import (
 	"encoding/json"
+	stderrors "errors"
 )
 
 /*
@@ -22,6 +23,10 @@ type Error struct {
 	// Meta includes meta details about the error. It is only used when dealing
 	// with HTTP errors to provide a consistent HTTP response across adapters.
 	Meta *Meta `json:"meta,omitempty"`
+
+	// Retryable indicates if the operation that failed can be retried, such as
+	// when a destination is temporarily unavailable.
+	Retryable bool `json:"retryable,omitempty"`
 }
 
 /*
@@ -37,6 +42,27 @@ type Validation struct {
 	Path []string `json:"path"`
 }
 
+/*
+From returns the structured representation of any error. It returns the error as
+is if it already is an *Error, or the first *Error it wraps so its status code and
+retryability are kept, and nil if err is nil. Otherwise, the message of the error
+is kept.
+*/
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var fail *Error
+	if stderrors.As(err, &fail) {
+		return fail
+	}
+
+	return &Error{
+		Message: err.Error(),
+	}
+}
+
 /*
 Error returns a stringified representation of the marshalled error. This allows
 to use Error as a standard error across Blacksmith packages and can be unmarshall
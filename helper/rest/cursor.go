@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+Cursor is the position of an entry in a collection ordered by a timestamp, and
+then by ID. It is used for keyset pagination, which remains fast regardless of the
+number of entries to skip.
+*/
+type Cursor struct {
+
+	// At is the timestamp of the entry, such as the date an event has been received.
+	At time.Time
+
+	// ID is the unique identifier of the entry.
+	ID string
+}
+
+/*
+Cursors holds the cursors to use for retrieving the next and previous entries of
+a query.
+*/
+type Cursors struct {
+
+	// Next is the cursor to pass as "after" to retrieve the next entries. It will
+	// be nil if there is no next entry.
+	Next *string `json:"next"`
+
+	// Previous is the cursor to pass as "before" to retrieve the previous entries.
+	// It will be nil if there is no previous entry.
+	Previous *string `json:"previous"`
+}
+
+/*
+String returns the opaque representation of the cursor. This is the value clients
+shall pass back to retrieve the next or previous entries.
+*/
+func (c Cursor) String() string {
+	raw := strconv.FormatInt(c.At.UnixNano(), 10) + "." + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+/*
+Before reports if the cursor is positioned before another one.
+*/
+func (c Cursor) Before(other Cursor) bool {
+	if !c.At.Equal(other.At) {
+		return c.At.Before(other.At)
+	}
+
+	return c.ID < other.ID
+}
+
+/*
+ParseCursor returns the cursor given its opaque representation. It returns an
+error if the cursor is malformed.
+*/
+func ParseCursor(s string) (*Cursor, error) {
+	fail := &errors.Error{
+		StatusCode: 400,
+		Message:    "Bad Request",
+		Validations: []errors.Validation{
+			{
+				Message: "Cursor is malformed",
+				Path:    []string{"cursor"},
+			},
+		},
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fail
+	}
+
+	parts := strings.SplitN(string(raw), ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fail
+	}
+
+	ns, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fail
+	}
+
+	c := &Cursor{
+		At: time.Unix(0, ns).UTC(),
+		ID: parts[1],
+	}
+
+	return c, nil
+}
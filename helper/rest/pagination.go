@@ -10,46 +10,46 @@ Pagination holds the pagination details when looking for entries in the REST API
 type Pagination struct {
 
 	// Current is the current page.
-	Current uint16 `json:"current"`
+	Current uint64 `json:"current"`
 
 	// Previous is the previous page. It will be nil if there is no previous page.
-	Previous *uint16 `json:"previous"`
+	Previous *uint64 `json:"previous"`
 
 	// Next is the next page. It will be nil if there is no next page.
-	Next *uint16 `json:"next"`
+	Next *uint64 `json:"next"`
 
 	// First is the first page. It will always be 1.
-	First uint16 `json:"first"`
+	First uint64 `json:"first"`
 
 	// Last is the last page.
-	Last uint16 `json:"last"`
+	Last uint64 `json:"last"`
 }
 
 /*
 Paginate returns the appropriate pagination details given the count, offset, and
-limit of a query.
+limit of a query. The limit must be greater than zero.
 */
-func Paginate(count, offset, limit uint16) *Pagination {
+func Paginate(count, offset, limit uint64) *Pagination {
 	p := &Pagination{
 		First: 1,
 	}
 
 	// Calcul the current page number.
-	p.Current = uint16(math.Ceil(float64(offset) / float64(limit)))
+	p.Current = uint64(math.Ceil(float64(offset) / float64(limit)))
 	p.Current += p.First
 
 	// Calcul the last page number.
-	p.Last = uint16(math.Ceil(float64(count) / float64(limit)))
+	p.Last = uint64(math.Ceil(float64(count) / float64(limit)))
 
 	// Calcul the previous page number if applicable.
 	if (p.Current - 1) >= p.First {
-		p.Previous = new(uint16)
+		p.Previous = new(uint64)
 		*p.Previous = p.Current - 1
 	}
 
 	// Calcul the next page number if applicable.
 	if (p.Current + 1) <= p.Last {
-		p.Next = new(uint16)
+		p.Next = new(uint64)
 		*p.Next = p.Current + 1
 	}
 
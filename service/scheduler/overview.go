@@ -5,5 +5,8 @@ store package, is in charge of the reliability of the event delivery to destinat
 
 Whereas the gateway takes care of incoming events, the scheduler is in charge of
 handling jobs to destinations in an asynchronous way.
+
+Jobs discarded after reaching their maximum number of retries can be brought back
+to the scheduler with the store's Requeue method, which marks them as awaiting.
 */
 package scheduler
@@ -29,4 +29,12 @@ type Toolkit struct {
 	//
 	// Example: "1UYc8EebLqCAFMOSkbYZdJwNLAJ"
 	EventID string
+
+	// Tenant is the tenant of the event being processed, if any.
+	//
+	// Note: This is not applicable for triggers using the CDC mode, since the tenant
+	// is only known once the event is returned.
+	//
+	// Example: "acme"
+	Tenant string
 }
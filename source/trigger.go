@@ -65,6 +65,14 @@ type Event struct {
 	// Examples: "v1.0", "2020-10-01"
 	Version string `json:"version,omitempty"`
 
+	// Tenant is the tenant the event belongs to, such as the customer who sent it.
+	// Its sub-events and jobs always belong to the same tenant. Entries of a tenant
+	// never appear in queries scoped to another one. It can be empty when the
+	// application is not multi-tenant.
+	//
+	// Example: "acme"
+	Tenant string `json:"tenant,omitempty"`
+
 	// Context is a dictionary of information that provides useful context about an
 	// event. The context should be used inside every events for consistency.
 	//
@@ -95,6 +103,14 @@ type Event struct {
 	// SentAt allows you to keep track of the timestamp when the event was originally
 	// sent.
 	SentAt *time.Time `json:"sent_at,omitempty"`
+
+	// IdempotencyKey is an optional key uniquely identifying the event for the
+	// source, such as the delivery ID of a webhook. When an event with the same key
+	// has already been received by the source within the store's idempotency window,
+	// the gateway returns the original event ID instead of creating duplicate jobs.
+	//
+	// Example: "crm-delivery-4f8a2c"
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 /*
@@ -134,4 +150,9 @@ type SubEvent struct {
 	// The jobs created by the actions returned are related to the sub-event, not
 	// the parent event.
 	Flows []flow.Flow `json:"-"`
+
+	// IdempotencyKey is an optional key uniquely identifying the sub-event for the
+	// source. It follows the same rules as the one of Event. Sub-events already
+	// received are skipped, even if their parent event is new.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
@@ -1,7 +1,10 @@
 package source
 
 import (
+	"time"
+
 	"github.com/nunchistudio/blacksmith/adapter/pubsub"
+	"github.com/nunchistudio/blacksmith/helper/errors"
 )
 
 /*
@@ -24,6 +27,82 @@ type TriggerSubscription interface {
 	Extract(*Toolkit, *pubsub.Message) (*Event, error)
 }
 
+/*
+TriggerSubscriptionBatch is the interface used for triggers using a Pub / Sub
+topic and extracting messages by batches, such as for high-volume topics. It uses
+the mode ModeSubscription as well. When a trigger implements it, the gateway
+groups the messages received into batches bounded by the BatchSize and BatchWait
+of the subscription.
+
+The events of a batch are persisted in the store at once, and each message is
+then acknowledged individually: a message which failed to be extracted is
+delivered again, or forwarded to the dead-letter topic, without affecting the
+other messages of the batch.
+*/
+type TriggerSubscriptionBatch interface {
+
+	// ExtractBatch in charge of the "E" in the ETL process: it Extracts the data
+	// from the source for a batch of messages. It returns the result of each
+	// message, at the same index. An error fails every message of the batch.
+	ExtractBatch(*Toolkit, []*pubsub.Message) ([]*BatchResult, error)
+}
+
+/*
+BatchResult is the result of the extraction of a message of a batch.
+*/
+type BatchResult struct {
+
+	// Event is the event extracted from the message. When nil and without error,
+	// the message is acknowledged without creating an event.
+	Event *Event `json:"event,omitempty"`
+
+	// Error is the error which occurred when extracting the message, if any. The
+	// message then fails given the dead-letter policy of the subscription.
+	Error error `json:"-"`
+}
+
+/*
+SplitBatchResults returns the events to persist and the error of each message of
+a batch of n messages, given the results and the error returned by ExtractBatch.
+Events are nil for messages without event. If results do not match the messages,
+every message fails with a 400 error.
+*/
+func SplitBatchResults(n int, results []*BatchResult, err error) ([]*Event, []error) {
+	events := make([]*Event, n)
+	fails := make([]error, n)
+	if err == nil && len(results) != n {
+		err = &errors.Error{
+			StatusCode: 400,
+			Message:    "source: Failed to extract batch",
+			Validations: []errors.Validation{
+				{
+					Message: "Results do not match the messages of the batch",
+					Path:    []string{"ExtractBatch", "Results"},
+				},
+			},
+		}
+	}
+
+	for i := range fails {
+		if err != nil {
+			fails[i] = err
+			continue
+		}
+
+		if results[i] == nil {
+			continue
+		}
+
+		events[i] = results[i].Event
+		fails[i] = results[i].Error
+		if fails[i] != nil {
+			events[i] = nil
+		}
+	}
+
+	return events, fails
+}
+
 /*
 Subscription contains the details about a subscription used by the gateway and
 the pubsub adapter.
@@ -51,4 +130,80 @@ type Subscription struct {
 	// Format for NATS: "<queue>"
 	// Format for RabbitMQ: "<queue>"
 	Subscription string `json:"subscription"`
+
+	// MaxDeliveries is the maximum number of times a message is delivered to the
+	// trigger. Once Extract has returned an error this many times for a message,
+	// it is forwarded to the dead-letter topic. When zero, messages are delivered
+	// again until they succeed.
+	MaxDeliveries uint16 `json:"max_deliveries,omitempty"`
+
+	// DeadLetterTopic is the topic messages are forwarded to once they have failed
+	// MaxDeliveries times, with the failure details in their metadata. When empty,
+	// such messages are dropped. Another subscription trigger can then subscribe
+	// to it for replaying the dead letters.
+	//
+	// Format: Same as the adapter's topic.
+	DeadLetterTopic string `json:"dead_letter_topic,omitempty"`
+
+	// MaxOutstandingMessages is the maximum number of messages received by the
+	// gateway but not extracted yet. No more messages are received until some have
+	// been extracted. When zero, defaults to 1000. When negative, there is no limit.
+	MaxOutstandingMessages int `json:"max_outstanding_messages,omitempty"`
+
+	// MaxOutstandingBytes is the maximum size of the bodies of the messages received
+	// by the gateway but not extracted yet. When zero, defaults to 100 MiB. When
+	// negative, there is no limit.
+	MaxOutstandingBytes int `json:"max_outstanding_bytes,omitempty"`
+
+	// Concurrency is the number of messages extracted at the same time. When zero,
+	// defaults to 10.
+	Concurrency int `json:"concurrency,omitempty"`
+
+	// OrderingKey is the key of the messages' metadata holding their ordering key.
+	// Messages with the same ordering key are extracted one at a time, in the order
+	// they have been received. When empty, messages are extracted in any order.
+	//
+	// Example: "user_id"
+	OrderingKey string `json:"ordering_key,omitempty"`
+
+	// BatchSize is the maximum number of messages of a batch, for triggers
+	// implementing TriggerSubscriptionBatch. When zero, defaults to 100.
+	BatchSize int `json:"batch_size,omitempty"`
+
+	// BatchWait is the maximum duration to wait for a batch to be full once it holds
+	// a message, for triggers implementing TriggerSubscriptionBatch. The batch is
+	// extracted once the duration has passed, no matter its size. When zero,
+	// defaults to 1s.
+	BatchWait time.Duration `json:"batch_wait,omitempty"`
+}
+
+/*
+DeadLetterPolicy returns the dead-letter policy of the subscription for the
+messages received by the trigger. Dead letters are forwarded with the forwarder
+passed, which is usually the publisher of the Pub / Sub adapter. The gateway
+validates it with pubsub.ValidateDeadLetter when loading the trigger, so a
+trigger can not start with a dead-letter topic it is unable to forward to.
+*/
+func (s *Subscription) DeadLetterPolicy(f pubsub.Forwarder) *pubsub.DeadLetterPolicy {
+	return &pubsub.DeadLetterPolicy{
+		MaxDeliveries:      s.MaxDeliveries,
+		Topic:              s.DeadLetterTopic,
+		SourceTopic:        s.Topic,
+		SourceSubscription: s.Subscription,
+		Forwarder:          f,
+	}
+}
+
+/*
+FlowControl returns the flow control of the subscription, used by the gateway to
+limit the messages received but not extracted yet and to extract them
+concurrently.
+*/
+func (s *Subscription) FlowControl() *pubsub.FlowControl {
+	return &pubsub.FlowControl{
+		MaxOutstandingMessages: s.MaxOutstandingMessages,
+		MaxOutstandingBytes:    s.MaxOutstandingBytes,
+		Concurrency:            s.Concurrency,
+		OrderingKey:            s.OrderingKey,
+	}
 }
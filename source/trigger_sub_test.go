@@ -0,0 +1,63 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/nunchistudio/blacksmith/helper/errors"
+)
+
+/*
+TestSplitBatchResults makes sure the results of a batch are split into the events
+to persist and the error of each message, at the same index.
+*/
+func TestSplitBatchResults(t *testing.T) {
+	fail := &errors.Error{Message: "boom"}
+	results := []*BatchResult{
+		{Event: &Event{Tenant: "acme"}},
+		nil,
+		{Event: &Event{Tenant: "ignored"}, Error: fail},
+		{},
+	}
+
+	events, fails := SplitBatchResults(4, results, nil)
+	if len(events) != 4 || len(fails) != 4 {
+		t.Fatalf("SplitBatchResults: expected 4 events and errors, found %d and %d", len(events), len(fails))
+	}
+
+	if events[0] == nil || events[0].Tenant != "acme" || fails[0] != nil {
+		t.Fatalf("SplitBatchResults: expected the event of the first message, found %+v and %v", events[0], fails[0])
+	}
+
+	if events[1] != nil || fails[1] != nil || events[3] != nil || fails[3] != nil {
+		t.Fatalf("SplitBatchResults: expected messages without event to succeed, found %v", fails)
+	}
+
+	if events[2] != nil || fails[2] != fail {
+		t.Fatalf("SplitBatchResults: expected the event of a failed message to be dropped, found %+v and %v", events[2], fails[2])
+	}
+}
+
+/*
+TestSplitBatchResultsFail makes sure every message fails with the error returned
+by ExtractBatch, or with a 400 error if the results do not match the messages.
+*/
+func TestSplitBatchResultsFail(t *testing.T) {
+	fail := &errors.Error{Message: "boom"}
+	events, fails := SplitBatchResults(2, []*BatchResult{{Event: &Event{}}, {Event: &Event{}}}, fail)
+	for i := range fails {
+		if events[i] != nil || fails[i] != fail {
+			t.Fatalf("SplitBatchResults: expected message %d to fail with the batch's error, found %+v and %v", i, events[i], fails[i])
+		}
+	}
+
+	events, fails = SplitBatchResults(3, []*BatchResult{{Event: &Event{}}}, nil)
+	for i := range fails {
+		if events[i] != nil || fails[i] == nil || errors.From(fails[i]).StatusCode != 400 {
+			t.Fatalf("SplitBatchResults: expected message %d to fail with a 400 error, found %+v and %v", i, events[i], fails[i])
+		}
+	}
+
+	if events, fails := SplitBatchResults(0, nil, nil); len(events) != 0 || len(fails) != 0 {
+		t.Fatalf("SplitBatchResults: expected an empty batch to be left empty, found %d and %d", len(events), len(fails))
+	}
+}